@@ -10,6 +10,16 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	maxRemoveRounds     = 5
+	removeRetryInterval = 20 * time.Millisecond
+)
+
+var (
+	ErrCgroupNotEmpty = errors.New("Control group is not empty")
 )
 
 type Cgroup interface {
@@ -17,9 +27,13 @@ type Cgroup interface {
 
 	Get(*Config) error
 
+	GetStats(*Stats) error
+
 	GetPath() string
 }
 
+// NewGroup creates control group in hierarchy of the subsystem, then moves the
+// process into it unless pid is 0
 func NewGroup(subpath string, subsystem string, pid int) (Cgroup, error) {
 	subsystemPath, err := GetSubsystemMountpoint(subsystem)
 	if err != nil {
@@ -32,19 +46,31 @@ func NewGroup(subpath string, subsystem string, pid int) (Cgroup, error) {
 		return nil, err
 	}
 
-	if err := writeValue(path, "cgroup.procs", strconv.Itoa(pid)); err != nil {
-		return nil, err
+	if pid != 0 {
+		if err := writeValue(path, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return nil, err
+		}
 	}
 	if subsystem == "cpu" {
 		return Cgroup(&CpuGroup{path}), nil
+	} else if subsystem == "cpuacct" {
+		return Cgroup(&CpuacctGroup{path}), nil
 	} else if subsystem == "memory" {
 		return Cgroup(&MemoryGroup{path}), nil
+	} else if subsystem == "pids" {
+		return Cgroup(&PidsGroup{path}), nil
 	} else {
 		return nil, errors.New("Invalid subsystem")
 	}
 }
 
 func LookupCgroupByPid(pid int, subsystem string) (Cgroup, error) {
+	if mode, err := GetCgroupMode(); err != nil {
+		return nil, err
+	} else if mode == Unified {
+		return lookupUnifiedGroupByPid(pid)
+	}
+
 	subsystemPath, err := GetSubsystemMountpoint(subsystem)
 	if err != nil {
 		return nil, err
@@ -62,8 +88,12 @@ func LookupCgroupByPid(pid int, subsystem string) (Cgroup, error) {
 	switch subsystem {
 	case "cpu":
 		g = Cgroup(&CpuGroup{path})
+	case "cpuacct":
+		g = Cgroup(&CpuacctGroup{path})
 	case "memory":
 		g = Cgroup(&MemoryGroup{path})
+	case "pids":
+		g = Cgroup(&PidsGroup{path})
 	default:
 		return nil, NewUnsupportedError(subsystem)
 	}
@@ -71,18 +101,55 @@ func LookupCgroupByPid(pid int, subsystem string) (Cgroup, error) {
 	return g, nil
 }
 
+// DestroyCgroup removes the control group. Processes left in it are not killed,
+// and ErrCgroupNotEmpty is returned since the control group could not be
+// removed then.
 func DestroyCgroup(path string) error {
-	os.RemoveAll(path)
+	var removeErr error
+	var pids []string
+	for round := 0; round < maxRemoveRounds; round++ {
+		if round > 0 {
+			time.Sleep(removeRetryInterval)
+		}
+		// Control files could not be removed from cgroupfs, while the
+		// directory itself is removed once no process is left in it
+		removeErr = os.RemoveAll(path)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
 
-	if _, err := os.Stat(path); err != nil && !os.IsNotExist(err) {
-		return err
+		// Killed processes may take a while to leave the control group
+		procs, err := readStringValue(path, "cgroup.procs")
+		if err != nil {
+			return err
+		}
+		pids = strings.Fields(procs)
+		if len(pids) == 0 {
+			break
+		}
 	}
 
-	return nil
+	if len(pids) > 0 {
+		return fmt.Errorf("%w: processes %v are left in %s", ErrCgroupNotEmpty, pids, path)
+	}
+	if removeErr == nil {
+		removeErr = fmt.Errorf("Cannot remove control group %s", path)
+	}
+	return removeErr
 }
 
 func GetEnabledSubsystems() (map[string]int, error) {
-	cgroupsFile, err := os.Open("/proc/cgroups")
+	mode, err := GetCgroupMode()
+	if err != nil {
+		return nil, err
+	}
+	if mode == Unified {
+		return getUnifiedEnabledControllers()
+	}
+
+	cgroupsFile, err := os.Open(procCgroupsPath)
 	if err != nil {
 		return nil, err
 	}
@@ -107,31 +174,28 @@ func GetEnabledSubsystems() (map[string]int, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("Cannot parsing /proc/cgroups: %s", err)
+		return nil, fmt.Errorf("Cannot parsing %s: %s", procCgroupsPath, err)
 	}
 
 	return cgroups, nil
 }
 
 func GetSubsystemMountpoint(subsystem string) (string, error) {
-	f, err := os.Open("/proc/self/mountinfo")
+	mounts, err := parseMountinfo()
 	if err != nil {
 		return "", err
 	}
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		txt := scanner.Text()
-		fields := strings.Split(txt, " ")
-		for _, opt := range strings.Split(fields[len(fields)-1], ",") {
+	for _, m := range mounts {
+		if m.fstype != "cgroup" {
+			continue
+		}
+		for _, opt := range m.superOptions {
 			if opt == subsystem {
-				return fields[4], nil
+				return m.mountpoint, nil
 			}
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return "", err
-	}
 
 	return "", fmt.Errorf("Mountpoint not found: %s", subsystem)
 }
@@ -152,7 +216,7 @@ func GetCgroupPathByPid(pid int, subsystem string) (string, error) {
 }
 
 func GetProcessCgroups(pid int) (map[string]string, error) {
-	fname := fmt.Sprintf("/proc/%d/cgroup", pid)
+	fname := fmt.Sprintf(procPidCgroupFormat, pid)
 
 	cgroups := make(map[string]string)
 
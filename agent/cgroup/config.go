@@ -16,4 +16,10 @@ type Config struct {
 
 	//限制最大内存使用量
 	MemoryLimit int64 `json:"memory_quota"`
+
+	//内存使用量软限制，超过后将被限流并优先回收
+	MemoryHigh int64 `json:"memory_high"`
+
+	//限制最大进程数
+	PidsLimit int64 `json:"pids_limit"`
 }
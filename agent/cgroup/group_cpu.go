@@ -3,8 +3,10 @@
 package cgroup
 
 import (
+	"bufio"
 	"errors"
 	"os"
+	"path/filepath"
 	"strconv"
 )
 
@@ -110,6 +112,34 @@ func (g *CpuGroup) Get(c *Config) error {
 	return nil
 }
 
+func (g *CpuGroup) GetStats(s *Stats) error {
+	f, err := os.Open(filepath.Join(g.path, "cpu.stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, err := parsePairValue(scanner.Text())
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "nr_periods":
+			s.CpuStats.ThrottlingData.Periods = value
+		case "nr_throttled":
+			s.CpuStats.ThrottlingData.ThrottledPeriods = value
+		case "throttled_time":
+			s.CpuStats.ThrottlingData.ThrottledTime = value
+		}
+	}
+	return scanner.Err()
+}
+
 func (g *CpuGroup) GetPath() string {
 	return g.path
 }
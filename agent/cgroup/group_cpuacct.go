@@ -0,0 +1,68 @@
+//+build linux
+
+package cgroup
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// USER_HZ used by cpuacct.stat, which is 100 on almost all platforms
+const clockTicks = 100
+
+type CpuacctGroup struct {
+	path string
+}
+
+func NewCpuacctGroup(subpath string, pid int) (Cgroup, error) {
+	return NewGroup(subpath, "cpuacct", pid)
+}
+
+// Set does nothing since cpuacct subsystem only accounts CPU usage
+func (g *CpuacctGroup) Set(c *Config) error {
+	return nil
+}
+
+func (g *CpuacctGroup) Get(c *Config) error {
+	return nil
+}
+
+func (g *CpuacctGroup) GetStats(s *Stats) error {
+	switch v, err := readInt64Value(g.path, "cpuacct.usage"); {
+	case err == nil:
+		s.CpuStats.CpuUsage.TotalUsage = uint64(v)
+	default:
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(g.path, "cpuacct.stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, err := parsePairValue(scanner.Text())
+		if err != nil {
+			return err
+		}
+		// Values in cpuacct.stat are in USER_HZ, convert them into nanoseconds
+		switch strings.TrimSpace(key) {
+		case "user":
+			s.CpuStats.CpuUsage.UsageInUsermode = value * 1000000000 / clockTicks
+		case "system":
+			s.CpuStats.CpuUsage.UsageInKernelmode = value * 1000000000 / clockTicks
+		}
+	}
+	return scanner.Err()
+}
+
+func (g *CpuacctGroup) GetPath() string {
+	return g.path
+}
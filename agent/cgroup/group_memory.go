@@ -3,6 +3,9 @@
 package cgroup
 
 import (
+	"bufio"
+	"os"
+	"path/filepath"
 	"strconv"
 )
 
@@ -20,8 +23,14 @@ func (g *MemoryGroup) Set(c *Config) error {
 		if err := writeValue(g.path, "memory.limit_in_bytes", strconv.FormatInt(c.MemoryLimit, 10)); err != nil {
 			return err
 		}
-		//物理内存+交换文件限制
-		if err := writeValue(g.path, "memory.memsw.limit_in_bytes", strconv.FormatInt(c.MemoryLimit*2, 10)); err != nil {
+		//物理内存+交换文件限制，未开启swap accounting时不存在该文件
+		if err := writeValue(g.path, "memory.memsw.limit_in_bytes", strconv.FormatInt(c.MemoryLimit*2, 10)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if c.MemoryHigh != 0 {
+		//cgroup v1中没有memory.high，以软限制代替
+		if err := writeValue(g.path, "memory.soft_limit_in_bytes", strconv.FormatInt(c.MemoryHigh, 10)); err != nil {
 			return err
 		}
 	}
@@ -38,6 +47,53 @@ func (g *MemoryGroup) Get(c *Config) error {
 	return nil
 }
 
+func (g *MemoryGroup) GetStats(s *Stats) error {
+	switch v, err := readInt64Value(g.path, "memory.usage_in_bytes"); {
+	case err == nil:
+		s.MemoryStats.Usage = uint64(v)
+	default:
+		return err
+	}
+
+	switch v, err := readInt64Value(g.path, "memory.max_usage_in_bytes"); {
+	case err == nil:
+		s.MemoryStats.MaxUsage = uint64(v)
+	case os.IsNotExist(err):
+	default:
+		return err
+	}
+
+	switch v, err := readInt64Value(g.path, "memory.failcnt"); {
+	case err == nil:
+		s.MemoryStats.Failcnt = uint64(v)
+	case os.IsNotExist(err):
+	default:
+		return err
+	}
+
+	// oom_kill counter in memory.oom_control is only available since Linux 4.13
+	f, err := os.Open(filepath.Join(g.path, "memory.oom_control"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, err := parsePairValue(scanner.Text())
+		if err != nil {
+			return err
+		}
+		if key == "oom_kill" {
+			s.MemoryStats.OomKill = value
+		}
+	}
+	return scanner.Err()
+}
+
 func (g *MemoryGroup) GetPath() string {
 	return g.path
 }
@@ -0,0 +1,57 @@
+//+build linux
+
+package cgroup
+
+import (
+	"strconv"
+	"strings"
+)
+
+type PidsGroup struct {
+	path string
+}
+
+func NewPidsGroup(subpath string, pid int) (Cgroup, error) {
+	return NewGroup(subpath, "pids", pid)
+}
+
+func (g *PidsGroup) Set(c *Config) error {
+	if c.PidsLimit != 0 {
+		if err := writeValue(g.path, "pids.max", strconv.FormatInt(c.PidsLimit, 10)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *PidsGroup) Get(c *Config) error {
+	v, err := readStringValue(g.path, "pids.max")
+	if err != nil {
+		return err
+	}
+	// "max" means no limitation on number of processes
+	if v == "max" {
+		c.PidsLimit = 0
+		return nil
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return err
+	}
+	c.PidsLimit = limit
+	return nil
+}
+
+func (g *PidsGroup) GetStats(s *Stats) error {
+	switch v, err := readInt64Value(g.path, "pids.current"); {
+	case err == nil:
+		s.PidsStats.Current = uint64(v)
+	default:
+		return err
+	}
+	return nil
+}
+
+func (g *PidsGroup) GetPath() string {
+	return g.path
+}
@@ -0,0 +1,328 @@
+//+build linux
+
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	unifiedDefaultCpuPeriod = 100000
+	// Key of control group in /proc/<pid>/cgroup for cgroup v2 hierarchy, whose
+	// line looks like 0::/system.slice/aliyun.service
+	unifiedHierarchyKey = ""
+)
+
+// UnifiedGroup is control group in cgroup v2 hierarchy, where all controllers
+// share the same directory.
+type UnifiedGroup struct {
+	path string
+}
+
+// NewUnifiedGroup creates control group in cgroup v2 hierarchy with specified
+// controllers enabled, then moves the process into it unless pid is 0.
+func NewUnifiedGroup(subpath string, pid int, controllers []string) (Cgroup, error) {
+	mountpoint, err := GetUnifiedMountpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(mountpoint, subpath)
+	if err := os.MkdirAll(path, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	// Controllers must be enabled in cgroup.subtree_control of every ancestor
+	// to be available in the control group
+	if err := enableUnifiedControllers(mountpoint, path, controllers); err != nil {
+		return nil, err
+	}
+
+	if pid != 0 {
+		if err := writeValue(path, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return nil, err
+		}
+	}
+
+	return Cgroup(&UnifiedGroup{path}), nil
+}
+
+func lookupUnifiedGroupByPid(pid int) (Cgroup, error) {
+	mountpoint, err := GetUnifiedMountpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	cgroups, err := GetProcessCgroups(pid)
+	if err != nil {
+		return nil, err
+	}
+	subpath, ok := cgroups[unifiedHierarchyKey]
+	if !ok {
+		return nil, NewCgroupsNotFoundError(pid)
+	}
+
+	return Cgroup(&UnifiedGroup{filepath.Join(mountpoint, subpath)}), nil
+}
+
+func getUnifiedEnabledControllers() (map[string]int, error) {
+	mountpoint, err := GetUnifiedMountpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(mountpoint, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Hierarchy ID is always 0 for cgroup v2
+	controllers := make(map[string]int)
+	for _, c := range strings.Fields(string(content)) {
+		controllers[c] = 0
+	}
+	// CPU usage accounting in cpu.stat is always available in cgroup v2, which
+	// is provided by cpuacct subsystem in cgroup v1
+	controllers["cpuacct"] = 0
+
+	return controllers, nil
+}
+
+func enableUnifiedControllers(mountpoint string, path string, controllers []string) error {
+	relative, err := filepath.Rel(mountpoint, path)
+	if err != nil {
+		return err
+	}
+
+	ancestor := mountpoint
+	parts := strings.Split(relative, string(filepath.Separator))
+	for i := 0; i < len(parts); i++ {
+		for _, c := range controllers {
+			if err := writeValue(ancestor, "cgroup.subtree_control", "+"+c); err != nil {
+				return fmt.Errorf("Cannot enable controller %s in %s: %w", c, ancestor, err)
+			}
+		}
+		ancestor = filepath.Join(ancestor, parts[i])
+	}
+
+	return nil
+}
+
+// toUnifiedControllers converts cgroup v1 subsystem names to cgroup v2
+// controller names
+func toUnifiedControllers(subsystems []string) ([]string, error) {
+	var controllers []string
+	added := make(map[string]bool)
+	for _, s := range subsystems {
+		var c string
+		switch s {
+		case "cpu", "memory", "pids":
+			c = s
+		case "cpuacct":
+			// cpu.stat is always available without enabling any controller
+			continue
+		default:
+			return nil, NewUnsupportedError(s)
+		}
+		if !added[c] {
+			controllers = append(controllers, c)
+			added[c] = true
+		}
+	}
+	return controllers, nil
+}
+
+func (g *UnifiedGroup) Set(c *Config) error {
+	if c.CpuRtPeriod != 0 || c.CpuRtRuntime != 0 {
+		return NewUnsupportedError("cpu.rt")
+	}
+	if c.CpuShares != 0 {
+		// Convert from [2-262144] to [1-10000]
+		weight := 1 + ((c.CpuShares-2)*9999)/262142
+		if err := writeValue(g.path, "cpu.weight", strconv.FormatInt(weight, 10)); err != nil {
+			return err
+		}
+	}
+	if c.CpuQuota != 0 || c.CpuPeriod != 0 {
+		period := c.CpuPeriod
+		if period == 0 {
+			period = unifiedDefaultCpuPeriod
+		}
+		quota := "max"
+		if c.CpuQuota > 0 {
+			quota = strconv.FormatInt(c.CpuQuota, 10)
+		}
+		if err := writeValue(g.path, "cpu.max", fmt.Sprintf("%s %d", quota, period)); err != nil {
+			return err
+		}
+	}
+	if c.MemoryLimit != 0 {
+		if err := writeValue(g.path, "memory.max", strconv.FormatInt(c.MemoryLimit, 10)); err != nil {
+			return err
+		}
+		// memory.swap.max does not exist when swap accounting is disabled
+		if err := writeValue(g.path, "memory.swap.max", strconv.FormatInt(c.MemoryLimit, 10)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if c.MemoryHigh != 0 {
+		if err := writeValue(g.path, "memory.high", strconv.FormatInt(c.MemoryHigh, 10)); err != nil {
+			return err
+		}
+	}
+	if c.PidsLimit != 0 {
+		if err := writeValue(g.path, "pids.max", strconv.FormatInt(c.PidsLimit, 10)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *UnifiedGroup) Get(c *Config) error {
+	switch v, err := readStringValue(g.path, "cpu.max"); {
+	case err == nil:
+		var quota string
+		var period int64
+		if _, err := fmt.Sscanf(v, "%s %d", &quota, &period); err != nil {
+			return fmt.Errorf("Cannot parsing cpu.max: %s", err)
+		}
+		c.CpuPeriod = period
+		if quota == "max" {
+			c.CpuQuota = -1
+		} else if c.CpuQuota, err = strconv.ParseInt(quota, 10, 64); err != nil {
+			return err
+		}
+	case os.IsNotExist(err):
+	default:
+		return err
+	}
+
+	switch v, err := readInt64Value(g.path, "cpu.weight"); {
+	case err == nil:
+		// Convert from [1-10000] to [2-262144]
+		c.CpuShares = 2 + ((v-1)*262142)/9999
+	case os.IsNotExist(err):
+	default:
+		return err
+	}
+
+	for file, field := range map[string]*int64{
+		"memory.max":  &c.MemoryLimit,
+		"memory.high": &c.MemoryHigh,
+		"pids.max":    &c.PidsLimit,
+	} {
+		switch v, err := readMaxableValue(g.path, file); {
+		case err == nil:
+			*field = v
+		case os.IsNotExist(err):
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *UnifiedGroup) GetStats(s *Stats) error {
+	err := readKeyValues(g.path, "cpu.stat", func(key string, value uint64) {
+		// Values in cpu.stat are in microseconds
+		switch key {
+		case "usage_usec":
+			s.CpuStats.CpuUsage.TotalUsage = value * 1000
+		case "user_usec":
+			s.CpuStats.CpuUsage.UsageInUsermode = value * 1000
+		case "system_usec":
+			s.CpuStats.CpuUsage.UsageInKernelmode = value * 1000
+		case "nr_periods":
+			s.CpuStats.ThrottlingData.Periods = value
+		case "nr_throttled":
+			s.CpuStats.ThrottlingData.ThrottledPeriods = value
+		case "throttled_usec":
+			s.CpuStats.ThrottlingData.ThrottledTime = value * 1000
+		}
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	switch v, err := readInt64Value(g.path, "memory.current"); {
+	case err == nil:
+		s.MemoryStats.Usage = uint64(v)
+	case os.IsNotExist(err):
+	default:
+		return err
+	}
+
+	// memory.peak is only available since Linux 5.19
+	switch v, err := readInt64Value(g.path, "memory.peak"); {
+	case err == nil:
+		s.MemoryStats.MaxUsage = uint64(v)
+	case os.IsNotExist(err):
+	default:
+		return err
+	}
+
+	err = readKeyValues(g.path, "memory.events", func(key string, value uint64) {
+		switch key {
+		case "max":
+			s.MemoryStats.Failcnt = value
+		case "oom_kill":
+			s.MemoryStats.OomKill = value
+		}
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	switch v, err := readInt64Value(g.path, "pids.current"); {
+	case err == nil:
+		s.PidsStats.Current = uint64(v)
+	case os.IsNotExist(err):
+	default:
+		return err
+	}
+
+	return nil
+}
+
+func (g *UnifiedGroup) GetPath() string {
+	return g.path
+}
+
+// readMaxableValue reads value of files like memory.max, where "max" means no
+// limitation and is returned as 0
+func readMaxableValue(dir, file string) (int64, error) {
+	v, err := readStringValue(dir, file)
+	if err != nil {
+		return 0, err
+	}
+	if v == "max" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func readKeyValues(dir, file string, callback func(key string, value uint64)) error {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, err := parsePairValue(scanner.Text())
+		if err != nil {
+			return err
+		}
+		callback(key, value)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,124 @@
+// +build linux
+
+package cgroup
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedManager(t *testing.T) {
+	cgroupfsRoot := setupFakeCgroupfs(t, mountinfoRootfs, mountinfoUnified)
+	assert.NoError(t, mkdirAndWrite(cgroupfsRoot, "cgroup.controllers", "cpuset cpu io memory pids\n"))
+
+	subsystems, err := GetEnabledSubsystems()
+	assert.NoError(t, err)
+	for _, s := range []string{"cpu", "cpuacct", "memory", "pids"} {
+		assert.Contains(t, subsystems, s)
+	}
+
+	manager, err := NewManager(1234, "aliyun_assist_task/t-unified", "cpu", "cpuacct", "memory", "pids")
+	assert.NoError(t, err)
+
+	groupPath := filepath.Join(cgroupfsRoot, "aliyun_assist_task", "t-unified")
+	procs, err := readStringValue(groupPath, "cgroup.procs")
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", procs)
+	// Controllers are enabled in every ancestor but not the group itself
+	assert.FileExists(t, filepath.Join(cgroupfsRoot, "cgroup.subtree_control"))
+	assert.FileExists(t, filepath.Join(cgroupfsRoot, "aliyun_assist_task", "cgroup.subtree_control"))
+	assert.NoFileExists(t, filepath.Join(groupPath, "cgroup.subtree_control"))
+
+	assert.NoError(t, manager.Set(&Config{
+		CpuQuota:    50000,
+		MemoryLimit: 64 * 1024 * 1024,
+		MemoryHigh:  48 * 1024 * 1024,
+		PidsLimit:   64,
+	}))
+	cpuMax, _ := readStringValue(groupPath, "cpu.max")
+	assert.Equal(t, "50000 100000", cpuMax)
+	memoryMax, _ := readStringValue(groupPath, "memory.max")
+	assert.Equal(t, "67108864", memoryMax)
+	memoryHigh, _ := readStringValue(groupPath, "memory.high")
+	assert.Equal(t, "50331648", memoryHigh)
+	pidsMax, _ := readStringValue(groupPath, "pids.max")
+	assert.Equal(t, "64", pidsMax)
+
+	assert.Error(t, manager.Set(&Config{
+		CpuRtRuntime: 1000,
+	}))
+
+	assert.NoError(t, writeValue(groupPath, "pids.max", "max"))
+	config := &Config{}
+	assert.NoError(t, manager.Get(config))
+	assert.Equal(t, int64(50000), config.CpuQuota)
+	assert.Equal(t, int64(100000), config.CpuPeriod)
+	assert.Equal(t, int64(64*1024*1024), config.MemoryLimit)
+	assert.Equal(t, int64(48*1024*1024), config.MemoryHigh)
+	assert.Equal(t, int64(0), config.PidsLimit)
+
+	assert.NoError(t, writeValue(groupPath, "cpu.stat", "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\nnr_periods 10\nnr_throttled 2\nthrottled_usec 300\n"))
+	assert.NoError(t, writeValue(groupPath, "memory.current", "4096\n"))
+	assert.NoError(t, writeValue(groupPath, "memory.peak", "8192\n"))
+	assert.NoError(t, writeValue(groupPath, "memory.events", "low 0\nhigh 3\nmax 5\noom 1\noom_kill 1\n"))
+	assert.NoError(t, writeValue(groupPath, "pids.current", "3\n"))
+	stats := &Stats{}
+	assert.NoError(t, manager.GetStats(stats))
+	assert.Equal(t, uint64(1500000), stats.CpuStats.CpuUsage.TotalUsage)
+	assert.Equal(t, uint64(1000000), stats.CpuStats.CpuUsage.UsageInUsermode)
+	assert.Equal(t, uint64(500000), stats.CpuStats.CpuUsage.UsageInKernelmode)
+	assert.Equal(t, uint64(2), stats.CpuStats.ThrottlingData.ThrottledPeriods)
+	assert.Equal(t, uint64(300000), stats.CpuStats.ThrottlingData.ThrottledTime)
+	assert.Equal(t, uint64(4096), stats.MemoryStats.Usage)
+	assert.Equal(t, uint64(8192), stats.MemoryStats.MaxUsage)
+	assert.Equal(t, uint64(5), stats.MemoryStats.Failcnt)
+	assert.Equal(t, uint64(1), stats.MemoryStats.OomKill)
+	assert.Equal(t, uint64(3), stats.PidsStats.Current)
+
+	assert.NoError(t, manager.Destroy())
+	assert.NoDirExists(t, groupPath)
+	assert.Equal(t, ErrCgroupRemoved, manager.Set(&Config{}))
+}
+
+func TestUnifiedManagerApply(t *testing.T) {
+	cgroupfsRoot := setupFakeCgroupfs(t, mountinfoRootfs, mountinfoUnified)
+	assert.NoError(t, mkdirAndWrite(cgroupfsRoot, "cgroup.controllers", "cpu memory pids\n"))
+
+	// Control group is created without any process, which is moved into it
+	// later
+	manager, err := NewManager(0, "aliyun_assist_task/t-apply", "cpu", "memory")
+	assert.NoError(t, err)
+	groupPath := filepath.Join(cgroupfsRoot, "aliyun_assist_task", "t-apply")
+	assert.DirExists(t, groupPath)
+	assert.NoFileExists(t, filepath.Join(groupPath, "cgroup.procs"))
+
+	assert.NoError(t, manager.Apply(1234))
+	procs, err := readStringValue(groupPath, "cgroup.procs")
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", procs)
+	assert.Equal(t, 1234, manager.GetPid())
+
+	assert.NoError(t, manager.Destroy())
+	assert.Equal(t, ErrCgroupRemoved, manager.Apply(1234))
+}
+
+func TestUnifiedManagerUnknownSubsystem(t *testing.T) {
+	cgroupfsRoot := setupFakeCgroupfs(t, mountinfoRootfs, mountinfoUnified)
+	assert.NoError(t, mkdirAndWrite(cgroupfsRoot, "cgroup.controllers", "cpu memory\n"))
+
+	_, err := NewManager(1234, "aliyun_assist_task/t-unknown", "cpu", "pids")
+	assert.Error(t, err)
+}
+
+func TestLoadUnifiedManager(t *testing.T) {
+	cgroupfsRoot := setupFakeCgroupfs(t, mountinfoRootfs, mountinfoUnified)
+	assert.NoError(t, ioutil.WriteFile(fakePidCgroupPath(1234), []byte("0::/system.slice/aliyun.service\n"), 0644))
+
+	manager, err := LoadManager(1234)
+	assert.NoError(t, err)
+	assert.Equal(t, 1234, manager.GetPid())
+	assert.Equal(t, filepath.Join(cgroupfsRoot, "system.slice", "aliyun.service"), manager.cgroups["unified"].GetPath())
+}
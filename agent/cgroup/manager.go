@@ -5,6 +5,7 @@ package cgroup
 import (
 	"errors"
 	"fmt"
+	"strconv"
 )
 
 var (
@@ -18,7 +19,19 @@ type Manager struct {
 	isRemoved bool
 }
 
+// NewManager creates control groups of subsystems and moves the process into
+// them. Control groups are created without any process when pid is 0, and the
+// process could be moved into them later by Apply.
 func NewManager(pid int, subpath string, subsystems ...string) (*Manager, error) {
+	mode, err := GetCgroupMode()
+	if err != nil {
+		return nil, err
+	}
+	// Controllers are still mounted as cgroup v1 hierarchies in hybrid mode
+	if mode == Unified {
+		return newUnifiedManager(pid, subpath, subsystems...)
+	}
+
 	cgroupList, err := GetEnabledSubsystems()
 	if err != nil {
 		return nil, err
@@ -40,12 +53,24 @@ func NewManager(pid int, subpath string, subsystems ...string) (*Manager, error)
 				return nil, NewCgroupInitError(s, err)
 			}
 			cgroups[s] = g
+		case "cpuacct":
+			g, err := NewCpuacctGroup(subpath, pid)
+			if err != nil {
+				return nil, NewCgroupInitError(s, err)
+			}
+			cgroups[s] = g
 		case "memory":
 			g, err := NewMemoryGroup(subpath, pid)
 			if err != nil {
 				return nil, NewCgroupInitError(s, err)
 			}
 			cgroups[s] = g
+		case "pids":
+			g, err := NewPidsGroup(subpath, pid)
+			if err != nil {
+				return nil, NewCgroupInitError(s, err)
+			}
+			cgroups[s] = g
 		default:
 			return nil, NewUnsupportedError(s)
 		}
@@ -54,7 +79,45 @@ func NewManager(pid int, subpath string, subsystems ...string) (*Manager, error)
 	return &Manager{pid: pid, cgroups: cgroups}, nil
 }
 
+func newUnifiedManager(pid int, subpath string, subsystems ...string) (*Manager, error) {
+	cgroupList, err := getUnifiedEnabledControllers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range subsystems {
+		if _, ok := cgroupList[s]; !ok {
+			return nil, fmt.Errorf("Unknown subsystem: %s", s)
+		}
+	}
+
+	controllers, err := toUnifiedControllers(subsystems)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := NewUnifiedGroup(subpath, pid, controllers)
+	if err != nil {
+		return nil, NewCgroupInitError("unified", err)
+	}
+
+	cgroups := map[string]Cgroup{
+		"unified": g,
+	}
+	return &Manager{pid: pid, cgroups: cgroups}, nil
+}
+
 func LoadManager(pid int) (*Manager, error) {
+	if mode, err := GetCgroupMode(); err != nil {
+		return nil, err
+	} else if mode == Unified {
+		g, err := lookupUnifiedGroupByPid(pid)
+		if err != nil {
+			return nil, err
+		}
+		return &Manager{pid: pid, cgroups: map[string]Cgroup{"unified": g}}, nil
+	}
+
 	cgroupList, err := GetProcessCgroups(pid)
 	if err != nil {
 		return nil, err
@@ -84,6 +147,22 @@ func (m *Manager) GetPid() int {
 	return m.pid
 }
 
+// Apply moves the process into the control groups
+func (m *Manager) Apply(pid int) error {
+	if m.isRemoved {
+		return ErrCgroupRemoved
+	}
+
+	for _, g := range m.cgroups {
+		if err := writeValue(g.GetPath(), "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return err
+		}
+	}
+	m.pid = pid
+
+	return nil
+}
+
 func (m *Manager) Set(c *Config) error {
 	if m.isRemoved {
 		return ErrCgroupRemoved
@@ -112,11 +191,13 @@ func (m *Manager) Get(c *Config) error {
 	return nil
 }
 
-func (m *Manager) Destroy() error {
-	m.isRemoved = true
+func (m *Manager) GetStats(s *Stats) error {
+	if m.isRemoved {
+		return ErrCgroupRemoved
+	}
 
 	for _, g := range m.cgroups {
-		if err := DestroyCgroup(g.GetPath()); err != nil {
+		if err := g.GetStats(s); err != nil {
 			return err
 		}
 	}
@@ -124,6 +205,38 @@ func (m *Manager) Destroy() error {
 	return nil
 }
 
+// Kill sends SIGKILL to all processes in the control groups
+func (m *Manager) Kill() error {
+	if m.isRemoved {
+		return ErrCgroupRemoved
+	}
+
+	for _, g := range m.cgroups {
+		if err := killProcesses(g.GetPath()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Destroy removes all control groups, and returns the first error encountered.
+// Manager is still usable when any control group is left, e.g. to kill
+// processes in it.
+func (m *Manager) Destroy() error {
+	var firstErr error
+	for _, g := range m.cgroups {
+		if err := DestroyCgroup(g.GetPath()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		m.isRemoved = true
+	}
+
+	return firstErr
+}
+
 type CgroupInitError struct {
 	Subsystem string
 	Err       error
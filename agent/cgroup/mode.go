@@ -0,0 +1,161 @@
+//+build linux
+
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+)
+
+type CgroupMode int
+
+const (
+	// Unavailable means neither cgroup v1 nor cgroup v2 hierarchy is mounted
+	Unavailable CgroupMode = iota
+	// Legacy means all controllers are mounted as cgroup v1 hierarchies
+	Legacy
+	// Hybrid means controllers are mounted as cgroup v1 hierarchies while a
+	// cgroup v2 hierarchy without controllers is also mounted, e.g., at
+	// /sys/fs/cgroup/unified by systemd
+	Hybrid
+	// Unified means only one cgroup v2 hierarchy is mounted
+	Unified
+)
+
+var (
+	ErrCgroupUnavailable = errors.New("Neither cgroup v1 nor cgroup v2 hierarchy is mounted")
+
+	// Paths of files under procfs, which could be replaced in tests
+	procCgroupsPath       = "/proc/cgroups"
+	procSelfMountinfoPath = "/proc/self/mountinfo"
+	procPidCgroupFormat   = "/proc/%d/cgroup"
+)
+
+func (m CgroupMode) String() string {
+	switch m {
+	case Legacy:
+		return "legacy"
+	case Hybrid:
+		return "hybrid"
+	case Unified:
+		return "unified"
+	default:
+		return "unavailable"
+	}
+}
+
+type mountInfo struct {
+	mountpoint   string
+	fstype       string
+	superOptions []string
+}
+
+// parseMountinfo parses /proc/self/mountinfo, whose line looks like:
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountinfo() ([]mountInfo, error) {
+	f, err := os.Open(procSelfMountinfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []mountInfo
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), " ")
+		if len(fields) < 5 {
+			continue
+		}
+		// Optional fields are terminated by a single hyphen
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 0 || separator+3 >= len(fields) {
+			continue
+		}
+
+		mounts = append(mounts, mountInfo{
+			mountpoint:   fields[4],
+			fstype:       fields[separator+1],
+			superOptions: strings.Split(fields[separator+3], ","),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return mounts, nil
+}
+
+// GetCgroupMode detects how control group hierarchies are mounted
+func GetCgroupMode() (CgroupMode, error) {
+	mounts, err := parseMountinfo()
+	if err != nil {
+		return Unavailable, err
+	}
+
+	hasV1Controllers := false
+	hasV2 := false
+	for _, m := range mounts {
+		switch m.fstype {
+		case "cgroup":
+			for _, opt := range m.superOptions {
+				// Named hierarchy like name=systemd has no controller
+				if _, ok := v1Controllers[opt]; ok {
+					hasV1Controllers = true
+				}
+			}
+		case "cgroup2":
+			hasV2 = true
+		}
+	}
+
+	switch {
+	case hasV1Controllers && hasV2:
+		return Hybrid, nil
+	case hasV1Controllers:
+		return Legacy, nil
+	case hasV2:
+		return Unified, nil
+	default:
+		return Unavailable, ErrCgroupUnavailable
+	}
+}
+
+// GetUnifiedMountpoint returns mountpoint of cgroup v2 hierarchy
+func GetUnifiedMountpoint() (string, error) {
+	mounts, err := parseMountinfo()
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range mounts {
+		if m.fstype == "cgroup2" {
+			return m.mountpoint, nil
+		}
+	}
+
+	return "", ErrCgroupUnavailable
+}
+
+var v1Controllers = map[string]struct{}{
+	"blkio":      {},
+	"cpu":        {},
+	"cpuacct":    {},
+	"cpuset":     {},
+	"devices":    {},
+	"freezer":    {},
+	"hugetlb":    {},
+	"memory":     {},
+	"net_cls":    {},
+	"net_prio":   {},
+	"perf_event": {},
+	"pids":       {},
+	"rdma":       {},
+}
@@ -0,0 +1,165 @@
+// +build linux
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	mountinfoRootfs  = "22 1 253:1 / / rw,relatime shared:1 - ext4 /dev/vda1 rw"
+	mountinfoSystemd = "26 25 0:23 / %s/systemd rw,nosuid,nodev,noexec,relatime shared:5 - cgroup cgroup rw,xattr,name=systemd"
+	mountinfoCpu     = "34 25 0:29 / %s/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:10 - cgroup cgroup rw,cpu,cpuacct"
+	mountinfoMemory  = "35 25 0:30 / %s/memory rw,nosuid,nodev,noexec,relatime shared:11 - cgroup cgroup rw,memory"
+	mountinfoPids    = "36 25 0:31 / %s/pids rw,nosuid,nodev,noexec,relatime shared:12 - cgroup cgroup rw,pids"
+	mountinfoHybrid  = "27 25 0:24 / %s/unified rw,nosuid,nodev,noexec,relatime shared:6 - cgroup2 cgroup2 rw,nsdelegate"
+	mountinfoUnified = "30 23 0:26 / %s rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate,memory_recursiveprot"
+
+	fakeProcCgroups = `#subsys_name	hierarchy	num_cgroups	enabled
+cpu	3	1	1
+cpuacct	3	1	1
+memory	4	1	1
+pids	5	1	1
+`
+)
+
+// setupFakeCgroupfs redirects procfs files read by this package to a fake tree
+// in temporary directory, and returns the root of fake cgroupfs.
+func setupFakeCgroupfs(t *testing.T, mountinfoLines ...string) string {
+	tempDir := t.TempDir()
+	cgroupfsRoot := filepath.Join(tempDir, "sys", "fs", "cgroup")
+
+	var lines []string
+	for _, line := range mountinfoLines {
+		if strings.Contains(line, "%s") {
+			line = fmt.Sprintf(line, cgroupfsRoot)
+		}
+		lines = append(lines, line)
+	}
+	mountinfoPath := filepath.Join(tempDir, "mountinfo")
+	assert.NoError(t, ioutil.WriteFile(mountinfoPath, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	cgroupsPath := filepath.Join(tempDir, "cgroups")
+	assert.NoError(t, ioutil.WriteFile(cgroupsPath, []byte(fakeProcCgroups), 0644))
+
+	originMountinfoPath, originCgroupsPath, originPidCgroupFormat := procSelfMountinfoPath, procCgroupsPath, procPidCgroupFormat
+	procSelfMountinfoPath = mountinfoPath
+	procCgroupsPath = cgroupsPath
+	procPidCgroupFormat = filepath.Join(tempDir, "%d.cgroup")
+	t.Cleanup(func() {
+		procSelfMountinfoPath, procCgroupsPath, procPidCgroupFormat = originMountinfoPath, originCgroupsPath, originPidCgroupFormat
+	})
+
+	return cgroupfsRoot
+}
+
+func mkdirAndWrite(dir, file, data string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeValue(dir, file, data)
+}
+
+func fakePidCgroupPath(pid int) string {
+	return fmt.Sprintf(procPidCgroupFormat, pid)
+}
+
+func TestGetCgroupMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		mountinfo []string
+		want      CgroupMode
+		wantErr   bool
+	}{
+		{
+			name:      "legacy",
+			mountinfo: []string{mountinfoRootfs, mountinfoSystemd, mountinfoCpu, mountinfoMemory},
+			want:      Legacy,
+		},
+		{
+			name:      "hybrid",
+			mountinfo: []string{mountinfoRootfs, mountinfoHybrid, mountinfoCpu, mountinfoMemory},
+			want:      Hybrid,
+		},
+		{
+			name:      "unified",
+			mountinfo: []string{mountinfoRootfs, mountinfoUnified},
+			want:      Unified,
+		},
+		{
+			name:      "namedHierarchyOnly",
+			mountinfo: []string{mountinfoRootfs, mountinfoSystemd, mountinfoUnified},
+			want:      Unified,
+		},
+		{
+			name:      "unavailable",
+			mountinfo: []string{mountinfoRootfs},
+			want:      Unavailable,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupFakeCgroupfs(t, tt.mountinfo...)
+			got, err := GetCgroupMode()
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetSubsystemMountpoint(t *testing.T) {
+	cgroupfsRoot := setupFakeCgroupfs(t, mountinfoRootfs, mountinfoHybrid, mountinfoCpu, mountinfoMemory)
+
+	mountpoint, err := GetSubsystemMountpoint("cpuacct")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(cgroupfsRoot, "cpu,cpuacct"), mountpoint)
+
+	// Options of cgroup2 mount should never be considered as subsystem
+	_, err = GetSubsystemMountpoint("nsdelegate")
+	assert.Error(t, err)
+
+	unifiedMountpoint, err := GetUnifiedMountpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(cgroupfsRoot, "unified"), unifiedMountpoint)
+}
+
+func TestLegacyManager(t *testing.T) {
+	cgroupfsRoot := setupFakeCgroupfs(t, mountinfoRootfs, mountinfoSystemd, mountinfoCpu, mountinfoMemory, mountinfoPids)
+
+	manager, err := NewManager(1234, "aliyun_assist_task/t-legacy", "cpu", "memory", "pids")
+	assert.NoError(t, err)
+
+	cpuPath := filepath.Join(cgroupfsRoot, "cpu,cpuacct", "aliyun_assist_task", "t-legacy")
+	memoryPath := filepath.Join(cgroupfsRoot, "memory", "aliyun_assist_task", "t-legacy")
+	pidsPath := filepath.Join(cgroupfsRoot, "pids", "aliyun_assist_task", "t-legacy")
+	for _, path := range []string{cpuPath, memoryPath, pidsPath} {
+		procs, err := readStringValue(path, "cgroup.procs")
+		assert.NoError(t, err)
+		assert.Equal(t, "1234", procs)
+	}
+
+	assert.NoError(t, manager.Set(&Config{
+		CpuQuota:    50000,
+		CpuPeriod:   100000,
+		MemoryLimit: 64 * 1024 * 1024,
+		PidsLimit:   64,
+	}))
+	quota, _ := readStringValue(cpuPath, "cpu.cfs_quota_us")
+	assert.Equal(t, "50000", quota)
+	memoryLimit, _ := readStringValue(memoryPath, "memory.limit_in_bytes")
+	assert.Equal(t, "67108864", memoryLimit)
+	pidsLimit, _ := readStringValue(pidsPath, "pids.max")
+	assert.Equal(t, "64", pidsLimit)
+
+	assert.NoError(t, manager.Destroy())
+	assert.NoDirExists(t, cpuPath)
+	assert.NoDirExists(t, memoryPath)
+	assert.NoDirExists(t, pidsPath)
+}
@@ -3,7 +3,9 @@
 package cgroup
 
 type Stats struct {
-	CpuStats CpuStats `json:"cpu_stats,omitempty"`
+	CpuStats    CpuStats    `json:"cpu_stats,omitempty"`
+	MemoryStats MemoryStats `json:"memory_stats,omitempty"`
+	PidsStats   PidsStats   `json:"pids_stats,omitempty"`
 }
 
 type CpuUsage struct {
@@ -35,3 +37,22 @@ type CpuStats struct {
 	CpuUsage       CpuUsage       `json:"cpu_usage,omitempty"`
 	ThrottlingData ThrottlingData `json:"throttling_data,omitempty"`
 }
+
+type MemoryStats struct {
+	// Current memory usage (in bytes).
+	Usage uint64 `json:"usage,omitempty"`
+
+	// Maximum memory usage recorded (in bytes).
+	MaxUsage uint64 `json:"max_usage,omitempty"`
+
+	// Number of times memory usage hits limits.
+	Failcnt uint64 `json:"failcnt"`
+
+	// Number of processes killed by OOM killer in the cgroup.
+	OomKill uint64 `json:"oom_kill"`
+}
+
+type PidsStats struct {
+	// Number of processes currently in the cgroup.
+	Current uint64 `json:"current,omitempty"`
+}
@@ -5,11 +5,16 @@ package cgroup
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
+// Processes may fork while being killed, so kill them in several rounds
+const maxKillRounds = 3
+
 func writeValue(dir, file, data string) error {
 	return ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0700)
 }
@@ -22,6 +27,14 @@ func readInt64Value(dir, file string) (int64, error) {
 	return strconv.ParseInt(strings.TrimSpace(string(c)), 10, 64)
 }
 
+func readStringValue(dir, file string) (string, error) {
+	c, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(c)), nil
+}
+
 func parsePairValue(s string) (string, uint64, error) {
 	parts := strings.Fields(s)
 	switch len(parts) {
@@ -36,3 +49,33 @@ func parsePairValue(s string) (string, uint64, error) {
 		return "", 0, fmt.Errorf("incorrect key-value format: %s", s)
 	}
 }
+
+// killProcesses kills all processes in the control group. cgroup.kill is
+// preferred when available, which is provided by cgroup v2 since Linux 5.14
+func killProcesses(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "cgroup.kill")); err == nil {
+		return writeValue(dir, "cgroup.kill", "1")
+	}
+
+	for round := 0; round < maxKillRounds; round++ {
+		c, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.procs"))
+		if err != nil {
+			return err
+		}
+		pids := strings.Fields(string(c))
+		if len(pids) == 0 {
+			return nil
+		}
+		for _, p := range pids {
+			pid, err := strconv.Atoi(p)
+			if err != nil {
+				return fmt.Errorf("Invalid pid %q in cgroup.procs: %v", p, err)
+			}
+			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
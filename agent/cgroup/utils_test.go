@@ -0,0 +1,34 @@
+// +build linux
+
+package cgroup
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKillProcesses(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command("sleep", "60")
+	assert.NoError(t, cmd.Start())
+	assert.NoError(t, writeValue(dir, "cgroup.procs", strconv.Itoa(cmd.Process.Pid)+"\n"))
+
+	assert.NoError(t, killProcesses(dir))
+	err := cmd.Wait()
+	exitErr, ok := err.(*exec.ExitError)
+	assert.True(t, ok)
+	assert.Equal(t, syscall.SIGKILL, exitErr.Sys().(syscall.WaitStatus).Signal())
+}
+
+func TestKillProcessesByCgroupKill(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, writeValue(dir, "cgroup.kill", "0"))
+
+	assert.NoError(t, killProcesses(dir))
+	value, _ := readStringValue(dir, "cgroup.kill")
+	assert.Equal(t, "1", value)
+}
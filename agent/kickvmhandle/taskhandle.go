@@ -14,6 +14,9 @@ func init ()  {
 	taskRoute = map[string]handleFunc{
 		"run": runTask,
 		"stop": stopTask,
+		"output": uploadTaskOutput,
+		"artifacts": uploadTaskArtifacts,
+		"pool": reportTaskPoolStats,
 	}
 }
 
@@ -38,6 +41,37 @@ func stopTask(params []string) error {
 	return nil
 }
 
+func uploadTaskOutput(params []string) error {
+	log.GetLogger().Println("uploadTaskOutput")
+	if len(params) < 1 {
+		return errors.New("params error")
+	}
+
+	go func() {
+		taskengine.UploadSpooledOutput(params[0])
+	}()
+	return nil
+}
+
+func uploadTaskArtifacts(params []string) error {
+	log.GetLogger().Println("uploadTaskArtifacts")
+	if len(params) < 1 {
+		return errors.New("params error")
+	}
+
+	go func() {
+		taskengine.UploadStagedArtifacts(params[0])
+	}()
+	return nil
+}
+
+func reportTaskPoolStats(params []string) error {
+	log.GetLogger().Println("reportTaskPoolStats")
+	go func() {
+		taskengine.ReportTaskPoolStats()
+	}()
+	return nil
+}
 
 type TaskHandle struct {
 	action string
@@ -36,6 +36,7 @@ func InitLog(filename string, logpath string) {
 	Log.SetFormatter(&CustomLogrusTextFormatter{})
 	Log.SetOutput(writer)
 	Log.SetLevel(defaultLevel)
+	Log.AddHook(&secretRedactingHook{})
 }
 
 func GetLogger() *log.Logger {
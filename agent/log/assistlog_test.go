@@ -1,12 +1,55 @@
 package log
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util/stringutil"
 )
 
 func TestGetLogger(t *testing.T) {
 	InitLog("test", "")
 	assert.NotNil(t, GetLogger())
 }
+
+func TestRedactSecretsInLog(t *testing.T) {
+	var output bytes.Buffer
+	logger := logrus.New()
+	logger.SetFormatter(&CustomLogrusTextFormatter{})
+	logger.SetOutput(&output)
+	logger.AddHook(&secretRedactingHook{})
+
+	RegisterSecrets([]string{"p@ssw0rd"})
+	RegisterSecrets([]string{"p@ssw0rd"})
+	logger.WithField("content", "mysql -pp@ssw0rd").Errorln("failed with p@ssw0rd")
+	assert.NotContains(t, output.String(), "p@ssw0rd")
+	assert.Contains(t, output.String(), stringutil.RedactedMask)
+
+	// Still masked until all registrations are removed
+	UnregisterSecrets([]string{"p@ssw0rd"})
+	output.Reset()
+	logger.Infoln("p@ssw0rd")
+	assert.NotContains(t, output.String(), "p@ssw0rd")
+
+	UnregisterSecrets([]string{"p@ssw0rd"})
+	output.Reset()
+	logger.Infoln("p@ssw0rd")
+	assert.Contains(t, output.String(), "p@ssw0rd")
+
+	// Secrets are masked before formatter quotes or escapes them
+	secret := "p@ss\"w0rd\n"
+	RegisterSecrets([]string{secret})
+	defer UnregisterSecrets([]string{secret})
+	output.Reset()
+	logger.WithFields(logrus.Fields{
+		"content": "echo " + secret,
+		"error":   errors.New("invalid password " + secret),
+	}).Errorln("failed with", secret)
+	assert.NotContains(t, output.String(), "w0rd")
+	assert.Equal(t, 3, strings.Count(output.String(), stringutil.RedactedMask))
+}
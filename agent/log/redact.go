@@ -0,0 +1,92 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util/stringutil"
+)
+
+var (
+	// Secrets registered by running invocations with reference count, since
+	// the same secret may be used by concurrent invocations
+	_secretRefs     = map[string]int{}
+	_secretRedactor *stringutil.Redactor
+	_secretLock     sync.RWMutex
+)
+
+// RegisterSecrets registers secret values to be masked in all log lines
+// until UnregisterSecrets is called with them
+func RegisterSecrets(secrets []string) {
+	if len(secrets) == 0 {
+		return
+	}
+	_secretLock.Lock()
+	defer _secretLock.Unlock()
+	for _, secret := range secrets {
+		_secretRefs[secret]++
+	}
+	rebuildSecretRedactor()
+}
+
+func UnregisterSecrets(secrets []string) {
+	if len(secrets) == 0 {
+		return
+	}
+	_secretLock.Lock()
+	defer _secretLock.Unlock()
+	for _, secret := range secrets {
+		if _secretRefs[secret] <= 1 {
+			delete(_secretRefs, secret)
+		} else {
+			_secretRefs[secret]--
+		}
+	}
+	rebuildSecretRedactor()
+}
+
+func rebuildSecretRedactor() {
+	secrets := make([]string, 0, len(_secretRefs))
+	for secret := range _secretRefs {
+		secrets = append(secrets, secret)
+	}
+	_secretRedactor = stringutil.NewRedactor(secrets)
+}
+
+// secretRedactingHook masks registered secrets in message and field values
+// of log entry before it is formatted, so that quoting or escaping done by
+// formatter could not break a secret apart from its mask
+type secretRedactingHook struct{}
+
+func (h *secretRedactingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *secretRedactingHook) Fire(entry *logrus.Entry) error {
+	_secretLock.RLock()
+	redactor := _secretRedactor
+	_secretLock.RUnlock()
+	if redactor.Empty() {
+		return nil
+	}
+
+	entry.Message = redactor.Redact(entry.Message)
+	// Data of entry has been copied by logrus before hooks are fired
+	for key, value := range entry.Data {
+		var formatted string
+		switch v := value.(type) {
+		case string:
+			formatted = v
+		case error:
+			formatted = v.Error()
+		default:
+			formatted = fmt.Sprint(v)
+		}
+		if redacted := redactor.Redact(formatted); redacted != formatted {
+			entry.Data[key] = redacted
+		}
+	}
+	return nil
+}
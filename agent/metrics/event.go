@@ -20,6 +20,9 @@ const (
 	EVENT_CHANNEL_SWITCH    MetricsEventID = "agent.channel.switch"
 	EVENT_UPDATE_FAILED     MetricsEventID = "agent.update.failed"
 	EVENT_TASK_FAILED       MetricsEventID = "agent.task.failed"
+	EVENT_TASK_POOL         MetricsEventID = "agent.task.pool"
+	EVENT_TASK_SKIPPED      MetricsEventID = "agent.task.skipped"
+	EVENT_TASK_REPLACED     MetricsEventID = "agent.task.replaced"
 	EVENT_HYBRID_REGISTER   MetricsEventID = "agent.hybrid.register"
 	EVENT_HYBRID_UNREGISTER MetricsEventID = "agent.hybrid.unregister"
 	EVENT_SESSION_FAILED    MetricsEventID = "agent.session.failed"
@@ -191,6 +194,42 @@ func GetTaskFailedEvent(keywords ...string) *MetricsEvent {
 	return event
 }
 
+func GetTaskPoolEvent(keywords ...string) *MetricsEvent {
+	event := &MetricsEvent{
+		EventId:    EVENT_TASK_POOL,
+		Category:   EVENT_CATEGORY_TASK,
+		EventLevel: EVENT_LEVEL_INFO,
+		EventTime:  time.Now().UnixNano() / 1e6,
+		Common:     getCommonInfoStr(),
+		KeyWords:   genKeyWordsStr(keywords...),
+	}
+	return event
+}
+
+func GetTaskSkippedEvent(keywords ...string) *MetricsEvent {
+	event := &MetricsEvent{
+		EventId:    EVENT_TASK_SKIPPED,
+		Category:   EVENT_CATEGORY_TASK,
+		EventLevel: EVENT_LEVEL_INFO,
+		EventTime:  time.Now().UnixNano() / 1e6,
+		Common:     getCommonInfoStr(),
+		KeyWords:   genKeyWordsStr(keywords...),
+	}
+	return event
+}
+
+func GetTaskReplacedEvent(keywords ...string) *MetricsEvent {
+	event := &MetricsEvent{
+		EventId:    EVENT_TASK_REPLACED,
+		Category:   EVENT_CATEGORY_TASK,
+		EventLevel: EVENT_LEVEL_INFO,
+		EventTime:  time.Now().UnixNano() / 1e6,
+		Common:     getCommonInfoStr(),
+		KeyWords:   genKeyWordsStr(keywords...),
+	}
+	return event
+}
+
 // 混合云系统
 func GetHybridRegisterEvent(success bool, keywords ...string) *MetricsEvent {
 	event := &MetricsEvent{
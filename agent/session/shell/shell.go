@@ -24,6 +24,7 @@ const(
 	Timeout = "Timeout"
 	Notified = "Notified"
 	Unknown_error = "Unknown_error"
+	Policy_denied = "Policy_denied"
 )
 
 type SizeData struct {
@@ -122,7 +122,7 @@ func setupStateConfigTimer(config StateConfiguration) (err error) {
 		}
 		timer, err = timerManager.CreateTimerInSeconds(createStateConfigCallBack(config.StateConfigurationId), intervalSeconds)
 	} else if config.ScheduleType == Cron {
-		timer, err = timerManager.CreateCronTimer(createStateConfigCallBack(config.StateConfigurationId), config.ScheduleExpression)
+		timer, err = timerManager.CreateCronTimer(createStateConfigCallBack(config.StateConfigurationId), config.ScheduleExpression, timermanager.Splay{})
 	} else {
 		err = fmt.Errorf("Invalid schedule type %s", config.ScheduleType)
 	}
@@ -10,45 +10,91 @@ import (
 
 const (
 	invalidParamCron string = "cron"
+	invalidParamMisfire string = "misfirePolicy"
+	invalidParamOverlap string = "overlapPolicy"
 
 	stopReasonKilled string = "killed"
 	stopReasonCompleted string = "completed"
+	stopReasonReplaced string = "replaced"
+	// Reported as timeoutReason parameter when invocation produced no output
+	// during idle timeout
+	timeoutReasonIdle string = "idle"
 )
 
-func reportInvalidTask(taskId string, param string, value string) (string, error) {
-	escapedParam := url.QueryEscape(param)
-	escapedValue := url.QueryEscape(value)
-	path := util.GetInvalidTaskService()
-	querystring := fmt.Sprintf("?taskId=%s&param=%s&value=%s", taskId, escapedParam, escapedValue)
+// Services which final reports of invocation are sent to
+const (
+	reportServiceFinish  = "finish"
+	reportServiceTimeout = "timeout"
+	reportServiceError   = "error"
+	reportServiceStopped = "stopped"
+	reportServiceInvalid = "invalid"
+)
+
+func reportServiceURL(service string) string {
+	switch service {
+	case reportServiceFinish:
+		return util.GetFinishOutputService()
+	case reportServiceTimeout:
+		return util.GetTimeoutOutputService()
+	case reportServiceError:
+		return util.GetErrorOutputService()
+	case reportServiceStopped:
+		return util.GetStoppedOutputService()
+	case reportServiceInvalid:
+		return util.GetInvalidTaskService()
+	default:
+		return ""
+	}
+}
+
+// postTaskReport sends report to specified service with at most 3 retries.
+// Report body is sent as plain text unless contentType is "json".
+func postTaskReport(service string, querystring string, output string, contentType string) (string, error) {
+	if contentType == "" {
+		contentType = "text"
+	}
+	path := reportServiceURL(service)
+	if path == "" {
+		return "", fmt.Errorf("Unknown report service: %s", service)
+	}
 	url := path + querystring
 
 	var response string
 	var err error
-	response, err = util.HttpPost(url, "", "text")
+	response, err = util.HttpPost(url, output, contentType)
 	for i := 0; i < 3 && err != nil; i++ {
 		time.Sleep(time.Duration(2) * time.Second)
-		response, err = util.HttpPost(url, "", "text")
+		response, err = util.HttpPost(url, output, contentType)
 	}
 
 	return response, err
 }
 
-func sendStoppedOutput(taskId string, start int64, end int64, exitcode int,
-	dropped int, output string, reason string) (string, error) {
-	path := util.GetStoppedOutputService()
+func invalidTaskQueryString(taskId string, param string, value string) string {
+	escapedParam := url.QueryEscape(param)
+	escapedValue := url.QueryEscape(value)
+	return fmt.Sprintf("?taskId=%s&param=%s&value=%s", taskId, escapedParam, escapedValue)
+}
+
+func reportInvalidTask(taskId string, param string, value string) (string, error) {
+	return postTaskReport(reportServiceInvalid, invalidTaskQueryString(taskId, param, value), "", "text")
+}
+
+func stoppedOutputQueryString(taskId string, start int64, end int64, exitcode int,
+	dropped int, reason string, terminatedBy string) string {
 	// luban/api/v1/task/stopped API requires extra result=killed parameter in
 	// querystring
 	querystring := fmt.Sprintf("?taskId=%s&start=%d&end=%d&exitcode=%d&dropped=%d&result=%s",
 		taskId, start, end, exitcode, dropped, reason)
-	url := path + querystring
-
-	var response string
-	var err error
-	response, err = util.HttpPost(url, output, "text")
-	for i := 0; i < 3 && err != nil; i++ {
-		time.Sleep(time.Duration(2) * time.Second)
-		response, err = util.HttpPost(url, output, "text")
+	// Which phase terminated the process tree of killed invocation
+	if terminatedBy != "" {
+		querystring += "&terminatedBy=" + terminatedBy
 	}
+	return querystring
+}
 
-	return response, err
+func sendStoppedOutput(taskId string, start int64, end int64, exitcode int,
+	dropped int, output string, reason string, terminatedBy string) (string, error) {
+	querystring := stoppedOutputQueryString(taskId, start, end, exitcode, dropped, reason, terminatedBy)
+	return postTaskReport(reportServiceStopped, querystring, output, "text")
 }
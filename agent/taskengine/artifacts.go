@@ -0,0 +1,498 @@
+package taskengine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	artifactsConfigFilename = "task_artifacts.json"
+
+	artifactsStagingDirName = "task_artifacts"
+
+	// 100MB
+	defaultArtifactsMaxTotalSize   = 100 * 1024 * 1024
+	defaultArtifactsMaxFileCount   = 50
+	defaultArtifactsRetentionHours = 72
+	defaultArtifactsUploadTimeout  = 300
+
+	artifactStateUploaded = "uploaded"
+	artifactStateStaged   = "staged"
+	artifactStateSkipped  = "skipped"
+
+	artifactSkippedSizeLimit   = "sizeLimit"
+	artifactSkippedCountLimit  = "countLimit"
+	artifactSkippedStageFailed = "stageFailed"
+	artifactSkippedNotRegular  = "notRegularFile"
+	artifactSkippedNotOwned    = "notOwned"
+
+	// Header carrying hex encoded SHA-256 digest of uploaded artifact
+	artifactSha256Header = "X-Content-Sha256"
+)
+
+var (
+	ErrInvalidArtifactPattern          = errors.New("Invalid artifact pattern")
+	ErrInvalidTaskIdForArtifacts       = errors.New("Invalid task id for artifacts")
+	ErrArtifactsUploadUrlNotConfigured = errors.New("Upload url of artifacts is not configured")
+	ErrArtifactNotRegular              = errors.New("Artifact is not a regular file")
+	ErrArtifactNotOwned                = errors.New("Artifact is not owned by the user whom invocation runs as")
+)
+
+// ArtifactsInfo declares files produced by invocation which are collected
+// after command process exits
+type ArtifactsInfo struct {
+	// Glob patterns relative to working directory, e.g., reports/*.xml
+	Patterns []string `json:"patterns"`
+	// Limit of total size in bytes, which could only lower the limit in
+	// configuration
+	MaxTotalSize int64 `json:"maxTotalSize"`
+}
+
+// ArtifactsConfig is loaded from task_artifacts.json in config directory
+type ArtifactsConfig struct {
+	// Collected files are uploaded to <uploadUrl>/<taskId>/<name> via HTTP PUT,
+	// and are staged locally for later retrieval when not specified or
+	// uploading fails
+	UploadUrl string `json:"uploadUrl"`
+	// Timeout in seconds of uploading each file
+	UploadTimeout  int   `json:"uploadTimeout"`
+	MaxTotalSize   int64 `json:"maxTotalSize"`
+	MaxFileCount   int   `json:"maxFileCount"`
+	RetentionHours int   `json:"retentionHours"`
+}
+
+// Artifact is listed in final report of invocation
+type Artifact struct {
+	// Path relative to working directory with slash as separator
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256,omitempty"`
+	// uploaded, staged or skipped
+	State  string `json:"state"`
+	Url    string `json:"url,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func loadArtifactsConfig() ArtifactsConfig {
+	config := ArtifactsConfig{}
+	if _, err := loadTaskConfigFile(artifactsConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", artifactsConfigFilename)
+		config = ArtifactsConfig{}
+	}
+	if config.UploadTimeout <= 0 {
+		config.UploadTimeout = defaultArtifactsUploadTimeout
+	}
+	if config.MaxTotalSize <= 0 {
+		config.MaxTotalSize = defaultArtifactsMaxTotalSize
+	}
+	if config.MaxFileCount <= 0 {
+		config.MaxFileCount = defaultArtifactsMaxFileCount
+	}
+	if config.RetentionHours <= 0 {
+		config.RetentionHours = defaultArtifactsRetentionHours
+	}
+	return config
+}
+
+func getArtifactsStagingDir() (string, error) {
+	cacheDir, err := util.GetCachePath()
+	if err != nil {
+		return "", err
+	}
+	stagingDir := filepath.Join(cacheDir, artifactsStagingDirName)
+	if err := util.MakeSurePath(stagingDir); err != nil {
+		return "", err
+	}
+	return stagingDir, nil
+}
+
+// StagedArtifactsPath returns directory where artifacts of the latest
+// invocation of specified task are staged. Parallel runs of periodic task are
+// staged separately by their names like "<taskId>-parallel-<n>".
+func StagedArtifactsPath(taskId string) (string, error) {
+	name, ok := taskIdFileName(taskId)
+	if !ok {
+		return "", ErrInvalidTaskIdForArtifacts
+	}
+	stagingDir, err := getArtifactsStagingDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stagingDir, name), nil
+}
+
+// validateArtifactPatterns rejects malformed patterns and patterns which may
+// match files outside working directory
+func validateArtifactPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" || filepath.IsAbs(pattern) || strings.HasPrefix(pattern, "/") || strings.HasPrefix(pattern, `\`) {
+			return fmt.Errorf("%w: %s", ErrInvalidArtifactPattern, pattern)
+		}
+		cleaned := filepath.ToSlash(filepath.Clean(pattern))
+		if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return fmt.Errorf("%w: %s", ErrInvalidArtifactPattern, pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: %s: %s", ErrInvalidArtifactPattern, pattern, err.Error())
+		}
+	}
+	return nil
+}
+
+// matchArtifacts returns sorted names of regular files matching patterns
+// under baseDir. Symbolic links are not followed, and files resolved outside
+// baseDir through linked directories are ignored.
+func matchArtifacts(baseDir string, patterns []string) ([]string, error) {
+	resolvedBaseDir, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	resolvedBaseDir, err = filepath.Abs(resolvedBaseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make(map[string]bool)
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(filepath.Join(baseDir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidArtifactPattern, pattern, err.Error())
+		}
+		for _, path := range paths {
+			fileInfo, err := os.Lstat(path)
+			if err != nil || !fileInfo.Mode().IsRegular() {
+				continue
+			}
+			resolvedDir, err := filepath.EvalSymlinks(filepath.Dir(path))
+			if err != nil {
+				continue
+			}
+			resolvedDir, err = filepath.Abs(resolvedDir)
+			if err != nil {
+				continue
+			}
+			if resolvedDir != resolvedBaseDir && !strings.HasPrefix(resolvedDir, resolvedBaseDir+string(filepath.Separator)) {
+				continue
+			}
+			name, err := filepath.Rel(baseDir, path)
+			if err != nil {
+				continue
+			}
+			matched[filepath.ToSlash(name)] = true
+		}
+	}
+
+	names := make([]string, 0, len(matched))
+	for name := range matched {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// stageArtifact copies file into staging directory and computes its SHA-256
+// digest. false is returned when file grows beyond limit during copying.
+// Artifacts are read with privilege of agent, thus the file is opened without
+// following symbolic link, checked to be the one matched, and must be owned by
+// owner unless it is negative.
+func stageArtifact(src string, dst string, limit int64, owner int) (int64, string, bool, error) {
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return 0, "", false, err
+	}
+	if !srcInfo.Mode().IsRegular() {
+		return 0, "", false, ErrArtifactNotRegular
+	}
+	srcFile, err := openArtifactFile(src)
+	if err != nil {
+		return 0, "", false, err
+	}
+	defer srcFile.Close()
+	// The file or its parent directories may be replaced between Lstat and
+	// open
+	openedInfo, err := srcFile.Stat()
+	if err != nil {
+		return 0, "", false, err
+	}
+	if !openedInfo.Mode().IsRegular() || !os.SameFile(srcInfo, openedInfo) {
+		return 0, "", false, ErrArtifactNotRegular
+	}
+	if err := checkArtifactOwner(openedInfo, owner); err != nil {
+		return 0, "", false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return 0, "", false, err
+	}
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dstFile, hash), io.LimitReader(srcFile, limit+1))
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || written > limit {
+		os.Remove(dst)
+		return written, "", false, err
+	}
+	return written, hex.EncodeToString(hash.Sum(nil)), true, nil
+}
+
+func artifactUploadUrl(uploadUrl string, taskId string, name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimRight(uploadUrl, "/") + "/" + url.PathEscape(taskId) + "/" + strings.Join(segments, "/")
+}
+
+func uploadArtifact(config ArtifactsConfig, taskId string, name string, path string, sha256Digest string) (string, error) {
+	uploadUrl := artifactUploadUrl(config.UploadUrl, taskId, name)
+	err := util.HttpPutFileWithTimeout(uploadUrl, path, map[string]string{
+		artifactSha256Header: sha256Digest,
+	}, time.Duration(config.UploadTimeout)*time.Second)
+	return uploadUrl, err
+}
+
+// collectArtifacts stages files matching declared patterns under baseDir
+// within limits, and uploads them when upload url is configured. Staged copy
+// of uploaded file is removed, and the rest are kept for later retrieval.
+// Only files owned by specified user are collected for invocation run as the
+// user, which could not read files of others through agent.
+func collectArtifacts(taskId string, username string, baseDir string, info ArtifactsInfo, config ArtifactsConfig, logger logrus.FieldLogger) ([]Artifact, error) {
+	owner, err := artifactOwner(username)
+	if err != nil {
+		return nil, err
+	}
+	names, err := matchArtifacts(baseDir, info.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	stagingPath, err := StagedArtifactsPath(taskId)
+	if err != nil {
+		return nil, err
+	}
+	cleanExpiredArtifacts(filepath.Dir(stagingPath), time.Duration(config.RetentionHours)*time.Hour)
+	// Artifacts of previous invocation of periodic task are overwritten
+	if err := os.RemoveAll(stagingPath); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	maxTotalSize := config.MaxTotalSize
+	if info.MaxTotalSize > 0 && info.MaxTotalSize < maxTotalSize {
+		maxTotalSize = info.MaxTotalSize
+	}
+	var totalSize int64
+	collected := 0
+	artifacts := make([]Artifact, 0, len(names))
+	for _, name := range names {
+		artifact := Artifact{
+			Name: name,
+		}
+		src := filepath.Join(baseDir, filepath.FromSlash(name))
+		if fileInfo, err := os.Lstat(src); err == nil {
+			artifact.Size = fileInfo.Size()
+		}
+		if collected >= config.MaxFileCount {
+			artifact.State, artifact.Reason = artifactStateSkipped, artifactSkippedCountLimit
+			artifacts = append(artifacts, artifact)
+			continue
+		}
+		if artifact.Size > maxTotalSize-totalSize {
+			artifact.State, artifact.Reason = artifactStateSkipped, artifactSkippedSizeLimit
+			artifacts = append(artifacts, artifact)
+			continue
+		}
+
+		staged := filepath.Join(stagingPath, filepath.FromSlash(name))
+		size, digest, withinLimit, err := stageArtifact(src, staged, maxTotalSize-totalSize, owner)
+		if err != nil {
+			logger.WithField("artifact", name).WithError(err).Warningln("Failed to stage artifact")
+			artifact.State, artifact.Reason = artifactStateSkipped, artifactSkippedStageFailed
+			if errors.Is(err, ErrArtifactNotRegular) {
+				artifact.Reason = artifactSkippedNotRegular
+			} else if errors.Is(err, ErrArtifactNotOwned) {
+				artifact.Reason = artifactSkippedNotOwned
+			}
+			artifacts = append(artifacts, artifact)
+			continue
+		}
+		if !withinLimit {
+			artifact.Size = size
+			artifact.State, artifact.Reason = artifactStateSkipped, artifactSkippedSizeLimit
+			artifacts = append(artifacts, artifact)
+			continue
+		}
+		artifact.Size, artifact.Sha256 = size, digest
+		totalSize += size
+		collected++
+
+		artifact.State = artifactStateStaged
+		if config.UploadUrl != "" {
+			uploadUrl, err := uploadArtifact(config, taskId, name, staged, digest)
+			if err != nil {
+				logger.WithField("artifact", name).WithError(err).Warningln("Failed to upload artifact and keep it staged")
+			} else {
+				artifact.State, artifact.Url = artifactStateUploaded, uploadUrl
+				os.Remove(staged)
+			}
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	removeEmptyDirs(stagingPath)
+	return artifacts, nil
+}
+
+// removeEmptyDirs removes directories left empty after staged files of
+// uploaded artifacts are removed
+func removeEmptyDirs(root string) {
+	var dirs []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	// Deeper directories are removed before their parents
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if infos, err := ioutil.ReadDir(dirs[i]); err == nil && len(infos) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+}
+
+func cleanExpiredArtifacts(stagingDir string, retention time.Duration) {
+	infos, err := ioutil.ReadDir(stagingDir)
+	if err != nil {
+		return
+	}
+	expiredBefore := time.Now().Add(-retention)
+	for _, info := range infos {
+		if !info.IsDir() || info.ModTime().After(expiredBefore) {
+			continue
+		}
+		path := filepath.Join(stagingDir, info.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.GetLogger().WithField("directory", path).WithError(err).Warningln("Failed to remove expired staged artifacts")
+		}
+	}
+}
+
+// collectArtifacts collects declared artifacts in working directory of
+// invocation, which must be called before sandbox or private directory is
+// removed
+func (task *Task) collectArtifacts(taskLogger logrus.FieldLogger) {
+	if len(task.taskInfo.Artifacts.Patterns) == 0 {
+		return
+	}
+	baseDir := task.realWorkingDir
+	if baseDir == "" {
+		// Command process runs in working directory of agent
+		var err error
+		if baseDir, err = os.Getwd(); err != nil {
+			taskLogger.WithError(err).Warningln("Failed to detect working directory for collecting artifacts")
+			return
+		}
+	}
+
+	artifacts, err := collectArtifacts(task.runKey(), task.taskInfo.Username, baseDir, task.taskInfo.Artifacts, loadArtifactsConfig(), taskLogger)
+	if err != nil {
+		taskLogger.WithError(err).Warningln("Failed to collect artifacts of invocation")
+		return
+	}
+	task.artifacts = artifacts
+	taskLogger.WithFields(logrus.Fields{
+		"artifacts": len(artifacts),
+	}).Infoln("Collected artifacts of invocation")
+}
+
+// artifactsQueryParams generates additional querystring parameter listing
+// collected artifacts in JSON
+func (task *Task) artifactsQueryParams() string {
+	if len(task.artifacts) == 0 {
+		return ""
+	}
+	content, err := json.Marshal(task.artifacts)
+	if err != nil {
+		return ""
+	}
+	return "&artifacts=" + url.QueryEscape(string(content))
+}
+
+// UploadStagedArtifacts uploads artifacts of specified task staged locally to
+// configured upload url, and removes staged files uploaded successfully
+func UploadStagedArtifacts(taskId string) error {
+	uploadLogger := log.GetLogger().WithFields(logrus.Fields{
+		"TaskId": taskId,
+		"Phase":  "UploadingStagedArtifacts",
+	})
+
+	stagingPath, err := StagedArtifactsPath(taskId)
+	if err != nil {
+		uploadLogger.WithError(err).Errorln("Invalid task id")
+		return err
+	}
+	config := loadArtifactsConfig()
+	if config.UploadUrl == "" {
+		uploadLogger.WithError(ErrArtifactsUploadUrlNotConfigured).Errorln("Failed to upload staged artifacts")
+		return ErrArtifactsUploadUrlNotConfigured
+	}
+
+	var lastErr error
+	uploaded := 0
+	err = filepath.Walk(stagingPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(stagingPath, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		digest, err := util.ComputeSha256(path)
+		if err != nil {
+			lastErr = err
+			uploadLogger.WithField("artifact", name).WithError(err).Errorln("Failed to hash staged artifact")
+			return nil
+		}
+		if _, err := uploadArtifact(config, taskId, name, path, digest); err != nil {
+			lastErr = err
+			uploadLogger.WithField("artifact", name).WithError(err).Errorln("Failed to upload staged artifact")
+			return nil
+		}
+		os.Remove(path)
+		uploaded++
+		return nil
+	})
+	if err != nil {
+		uploadLogger.WithError(err).Errorln("Failed to list staged artifacts")
+		return err
+	}
+	removeEmptyDirs(stagingPath)
+	uploadLogger.Infof("Uploaded %d staged artifacts", uploaded)
+	return lastErr
+}
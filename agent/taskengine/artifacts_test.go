@@ -0,0 +1,294 @@
+package taskengine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+)
+
+func writeArtifactFiles(t *testing.T, baseDir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(baseDir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func sha256Hex(content string) string {
+	digest := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestValidateArtifactPatterns(t *testing.T) {
+	assert.NoError(t, validateArtifactPatterns(nil))
+	assert.NoError(t, validateArtifactPatterns([]string{"report.xml", "out/*.log", "dumps/core.[0-9]*", "a/../b"}))
+
+	for _, pattern := range []string{"", "/etc/passwd", "..", "../secret", "a/../../b", "[", "out/[a-"} {
+		assert.ErrorIs(t, validateArtifactPatterns([]string{"report.xml", pattern}), ErrInvalidArtifactPattern, pattern)
+	}
+}
+
+func TestMatchArtifacts(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+	outsideDir, err := ioutil.TempDir("", "outside")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outsideDir)
+
+	writeArtifactFiles(t, baseDir, map[string]string{
+		"report.xml":       "<ok/>",
+		"out/a.log":        "a",
+		"out/b.log":        "b",
+		"out/c.txt":        "c",
+		"out/nested/d.log": "d",
+	})
+	writeArtifactFiles(t, outsideDir, map[string]string{
+		"secret.log": "secret",
+	})
+	assert.NoError(t, os.MkdirAll(filepath.Join(baseDir, "out", "dir.log"), 0755))
+
+	names, err := matchArtifacts(baseDir, []string{"out/*.log", "report.xml", "out/a.log", "missing/*"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"out/a.log", "out/b.log", "report.xml"}, names)
+
+	if runtime.GOOS != "windows" {
+		// Neither linked files nor files in linked directories outside are
+		// collected
+		assert.NoError(t, os.Symlink(filepath.Join(outsideDir, "secret.log"), filepath.Join(baseDir, "out", "link.log")))
+		assert.NoError(t, os.Symlink(outsideDir, filepath.Join(baseDir, "linked")))
+		names, err = matchArtifacts(baseDir, []string{"out/*.log", "linked/*.log"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"out/a.log", "out/b.log"}, names)
+	}
+}
+
+func TestCollectArtifactsStaged(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	stagingDir, err := getArtifactsStagingDir()
+	assert.NoError(t, err)
+	baseDir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	writeArtifactFiles(t, baseDir, map[string]string{
+		"a.log":     "aaaa",
+		"b.log":     "bbbbbbbbbb",
+		"c.log":     "cc",
+		"d.log":     "dd",
+		"sub/e.log": "e",
+	})
+	config := ArtifactsConfig{
+		MaxTotalSize:   1024,
+		MaxFileCount:   3,
+		RetentionHours: 1,
+	}
+	info := ArtifactsInfo{
+		Patterns:     []string{"*.log", "sub/*.log"},
+		MaxTotalSize: 8,
+	}
+	artifacts, err := collectArtifacts("t-artifacts", "", baseDir, info, config, log.GetLogger())
+	assert.NoError(t, err)
+	assert.Equal(t, []Artifact{
+		{Name: "a.log", Size: 4, Sha256: sha256Hex("aaaa"), State: artifactStateStaged},
+		{Name: "b.log", Size: 10, State: artifactStateSkipped, Reason: artifactSkippedSizeLimit},
+		{Name: "c.log", Size: 2, Sha256: sha256Hex("cc"), State: artifactStateStaged},
+		{Name: "d.log", Size: 2, Sha256: sha256Hex("dd"), State: artifactStateStaged},
+		{Name: "sub/e.log", Size: 1, State: artifactStateSkipped, Reason: artifactSkippedCountLimit},
+	}, artifacts)
+
+	stagingPath := filepath.Join(stagingDir, "t-artifacts")
+	content, err := ioutil.ReadFile(filepath.Join(stagingPath, "a.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "aaaa", string(content))
+	_, err = os.Stat(filepath.Join(stagingPath, "b.log"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Staged artifacts of previous invocation are replaced
+	assert.NoError(t, os.Remove(filepath.Join(baseDir, "a.log")))
+	artifacts, err = collectArtifacts("t-artifacts", "", baseDir, ArtifactsInfo{Patterns: []string{"c.log"}}, config, log.GetLogger())
+	assert.NoError(t, err)
+	assert.Len(t, artifacts, 1)
+	_, err = os.Stat(filepath.Join(stagingPath, "a.log"))
+	assert.True(t, os.IsNotExist(err))
+
+	artifacts, err = collectArtifacts("t-artifacts", "", baseDir, ArtifactsInfo{Patterns: []string{"none.*"}}, config, log.GetLogger())
+	assert.NoError(t, err)
+	assert.Len(t, artifacts, 0)
+	_, err = os.Stat(stagingPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+type artifactUploadServer struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	uploaded map[string]string
+	digests  map[string]string
+}
+
+func newArtifactUploadServer(failedPath string) *artifactUploadServer {
+	s := &artifactUploadServer{
+		uploaded: make(map[string]string),
+		digests:  make(map[string]string),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path == failedPath {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		s.mutex.Lock()
+		s.uploaded[r.URL.Path] = string(content)
+		s.digests[r.URL.Path] = r.Header.Get(artifactSha256Header)
+		s.mutex.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	return s
+}
+
+func TestCollectArtifactsUploaded(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	stagingDir, err := getArtifactsStagingDir()
+	assert.NoError(t, err)
+	baseDir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+	uploadServer := newArtifactUploadServer("/artifacts/t-upload/out/failed.log")
+	defer uploadServer.server.Close()
+
+	writeArtifactFiles(t, baseDir, map[string]string{
+		"out/report 1.xml": "<ok/>",
+		"out/failed.log":   "failed",
+	})
+	config := ArtifactsConfig{
+		UploadUrl:      uploadServer.server.URL + "/artifacts/",
+		UploadTimeout:  10,
+		MaxTotalSize:   1024,
+		MaxFileCount:   10,
+		RetentionHours: 1,
+	}
+	artifacts, err := collectArtifacts("t-upload", "", baseDir, ArtifactsInfo{Patterns: []string{"out/*"}}, config, log.GetLogger())
+	assert.NoError(t, err)
+	assert.Equal(t, []Artifact{
+		{Name: "out/failed.log", Size: 6, Sha256: sha256Hex("failed"), State: artifactStateStaged},
+		{
+			Name:   "out/report 1.xml",
+			Size:   5,
+			Sha256: sha256Hex("<ok/>"),
+			State:  artifactStateUploaded,
+			Url:    uploadServer.server.URL + "/artifacts/t-upload/out/report%201.xml",
+		},
+	}, artifacts)
+	assert.Equal(t, "<ok/>", uploadServer.uploaded["/artifacts/t-upload/out/report 1.xml"])
+	assert.Equal(t, sha256Hex("<ok/>"), uploadServer.digests["/artifacts/t-upload/out/report 1.xml"])
+
+	// Only artifact failed to be uploaded is kept staged
+	stagingPath := filepath.Join(stagingDir, "t-upload")
+	_, err = os.Stat(filepath.Join(stagingPath, "out", "report 1.xml"))
+	assert.True(t, os.IsNotExist(err))
+	content, err := ioutil.ReadFile(filepath.Join(stagingPath, "out", "failed.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", string(content))
+}
+
+func TestUploadStagedArtifacts(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	stagingDir, err := getArtifactsStagingDir()
+	assert.NoError(t, err)
+	uploadServer := newArtifactUploadServer("")
+	defer uploadServer.server.Close()
+
+	guard := monkey.Patch(loadArtifactsConfig, func() ArtifactsConfig {
+		return ArtifactsConfig{}
+	})
+	assert.ErrorIs(t, UploadStagedArtifacts("t-staged"), ErrArtifactsUploadUrlNotConfigured)
+	guard.Unpatch()
+	guard = monkey.Patch(loadArtifactsConfig, func() ArtifactsConfig {
+		return ArtifactsConfig{
+			UploadUrl:     uploadServer.server.URL,
+			UploadTimeout: 10,
+		}
+	})
+	defer guard.Unpatch()
+
+	assert.ErrorIs(t, UploadStagedArtifacts("../t-staged"), ErrInvalidTaskIdForArtifacts)
+	// Staging directory itself or its parent is never taken as artifacts of
+	// any task
+	assert.ErrorIs(t, UploadStagedArtifacts(".."), ErrInvalidTaskIdForArtifacts)
+	_, err = StagedArtifactsPath(".")
+	assert.ErrorIs(t, err, ErrInvalidTaskIdForArtifacts)
+
+	writeArtifactFiles(t, filepath.Join(stagingDir, "t-staged"), map[string]string{
+		"a.log":     "a",
+		"sub/b.log": "b",
+	})
+	assert.NoError(t, UploadStagedArtifacts("t-staged"))
+	assert.Equal(t, map[string]string{
+		"/t-staged/a.log":     "a",
+		"/t-staged/sub/b.log": "b",
+	}, uploadServer.uploaded)
+	assert.Equal(t, sha256Hex("b"), uploadServer.digests["/t-staged/sub/b.log"])
+	_, err = os.Stat(filepath.Join(stagingDir, "t-staged"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestArtifactsQueryParams(t *testing.T) {
+	task := NewTask(RunTaskInfo{TaskId: "t-artifacts"}, nil, nil)
+	assert.Equal(t, "", task.artifactsQueryParams())
+
+	task.artifacts = []Artifact{
+		{Name: "a.log", Size: 1, Sha256: sha256Hex("a"), State: artifactStateStaged},
+	}
+	params, err := url.ParseQuery(strings.TrimPrefix(task.artifactsQueryParams(), "&"))
+	assert.NoError(t, err)
+	var artifacts []Artifact
+	assert.NoError(t, json.Unmarshal([]byte(params.Get("artifacts")), &artifacts))
+	assert.Equal(t, task.artifacts, artifacts)
+}
+
+func TestRunTaskWithArtifacts(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shell script is only run on Linux in this test")
+	}
+	defer setupTaskFileDirs(t)()
+	stagingDir, err := getArtifactsStagingDir()
+	assert.NoError(t, err)
+	workingDir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	var taskId string
+	_, querystring, _ := runShellTaskForReport(t, "mkdir -p out; printf passed > out/result.txt; exit 1", func(taskInfo *RunTaskInfo) {
+		taskInfo.WorkingDir = workingDir
+		taskInfo.Artifacts = ArtifactsInfo{
+			Patterns: []string{"out/*.txt"},
+		}
+		taskId = taskInfo.TaskId
+	})
+	assert.Contains(t, querystring, "&exitCode=1")
+	params, err := url.ParseQuery(querystring[strings.Index(querystring, "?")+1:])
+	assert.NoError(t, err)
+	var artifacts []Artifact
+	assert.NoError(t, json.Unmarshal([]byte(params.Get("artifacts")), &artifacts))
+	assert.Equal(t, []Artifact{
+		{Name: "out/result.txt", Size: 6, Sha256: sha256Hex("passed"), State: artifactStateStaged},
+	}, artifacts)
+	content, err := ioutil.ReadFile(filepath.Join(stagingDir, taskId, "out", "result.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "passed", string(content))
+}
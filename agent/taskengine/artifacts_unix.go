@@ -0,0 +1,39 @@
+// +build linux freebsd
+
+package taskengine
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// artifactOwner returns uid of specified user, or -1 when invocation runs as
+// agent itself and could read any file anyway
+func artifactOwner(username string) (int, error) {
+	if username == "" {
+		return -1, nil
+	}
+	uid, _, err := invocationDirOwner(username)
+	return uid, err
+}
+
+// openArtifactFile fails on symbolic link, and never blocks on FIFO swapped
+// in place of the matched file
+func openArtifactFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+}
+
+func checkArtifactOwner(fileInfo os.FileInfo, owner int) error {
+	if owner < 0 {
+		return nil
+	}
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ErrArtifactNotOwned
+	}
+	if int(stat.Uid) != owner {
+		return fmt.Errorf("%w: owned by uid %d", ErrArtifactNotOwned, stat.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// +build linux freebsd
+
+package taskengine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+)
+
+func TestStageArtifactRefusesUnsafeFile(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+	outsideDir, err := ioutil.TempDir("", "outside")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outsideDir)
+	stagingDir, err := ioutil.TempDir("", "staging")
+	assert.NoError(t, err)
+	defer os.RemoveAll(stagingDir)
+
+	writeArtifactFiles(t, baseDir, map[string]string{
+		"report.xml": "<ok/>",
+	})
+	writeArtifactFiles(t, outsideDir, map[string]string{
+		"secret": "secret",
+	})
+	src := filepath.Join(baseDir, "report.xml")
+	dst := filepath.Join(stagingDir, "report.xml")
+
+	_, digest, withinLimit, err := stageArtifact(src, dst, 1024, os.Geteuid())
+	assert.NoError(t, err)
+	assert.True(t, withinLimit)
+	assert.Equal(t, sha256Hex("<ok/>"), digest)
+
+	// Files of other users are refused
+	_, _, _, err = stageArtifact(src, dst, 1024, os.Geteuid()+1)
+	assert.ErrorIs(t, err, ErrArtifactNotOwned)
+
+	// Matched file replaced by symbolic link is never followed
+	linked := filepath.Join(baseDir, "linked.xml")
+	assert.NoError(t, os.Symlink(filepath.Join(outsideDir, "secret"), linked))
+	_, _, _, err = stageArtifact(linked, dst, 1024, -1)
+	assert.ErrorIs(t, err, ErrArtifactNotRegular)
+	fifo := filepath.Join(baseDir, "fifo.xml")
+	assert.NoError(t, syscall.Mkfifo(fifo, 0600))
+	_, _, _, err = stageArtifact(fifo, dst, 1024, -1)
+	assert.ErrorIs(t, err, ErrArtifactNotRegular)
+}
+
+func TestCollectArtifactsOfSpecifiedUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Files owned by other user could only be prepared by root")
+	}
+	defer setupTaskFileDirs(t)()
+	baseDir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+	uid, gid, err := invocationDirOwner("nobody")
+	if err != nil {
+		t.Skip("User nobody does not exist")
+	}
+
+	writeArtifactFiles(t, baseDir, map[string]string{
+		"mine.log":   "mine",
+		"shadow.log": "root only",
+	})
+	assert.NoError(t, os.Lchown(filepath.Join(baseDir, "mine.log"), uid, gid))
+	config := ArtifactsConfig{
+		MaxTotalSize:   1024,
+		MaxFileCount:   10,
+		RetentionHours: 1,
+	}
+	artifacts, err := collectArtifacts("t-owner", "nobody", baseDir, ArtifactsInfo{Patterns: []string{"*.log"}}, config, log.GetLogger())
+	assert.NoError(t, err)
+	assert.Equal(t, []Artifact{
+		{Name: "mine.log", Size: 4, Sha256: sha256Hex("mine"), State: artifactStateStaged},
+		{Name: "shadow.log", Size: 9, State: artifactStateSkipped, Reason: artifactSkippedNotOwned},
+	}, artifacts)
+}
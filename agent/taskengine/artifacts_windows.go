@@ -0,0 +1,27 @@
+package taskengine
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	ErrArtifactOwnerUnsupported = errors.New("Collecting artifacts of invocation run as specified user is not supported on this platform")
+)
+
+// artifactOwner refuses invocation run as specified user, since agent would
+// read files the user could not access
+func artifactOwner(username string) (int, error) {
+	if username != "" {
+		return -1, ErrArtifactOwnerUnsupported
+	}
+	return -1, nil
+}
+
+func openArtifactFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+func checkArtifactOwner(fileInfo os.FileInfo, owner int) error {
+	return nil
+}
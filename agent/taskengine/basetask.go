@@ -1,7 +1,6 @@
 package taskengine
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"errors"
@@ -28,12 +27,19 @@ import (
 	"github.com/aliyun/aliyun_assist_client/agent/util/langutil"
 	"github.com/aliyun/aliyun_assist_client/agent/util/powerutil"
 	"github.com/aliyun/aliyun_assist_client/agent/util/process"
+	"github.com/aliyun/aliyun_assist_client/agent/util/stringutil"
 	"github.com/aliyun/aliyun_assist_client/agent/util/timetool"
 )
 
 const (
 	defaultQuoto    = 12000
 	defaultQuotoPre = 6000
+	// Bytes of output consumed for each running output report
+	runningOutputReadSize = 2048
+
+	// Seconds to wait for process tree to exit after SIGTERM on timeout or
+	// cancellation, before killing it forcibly
+	defaultTerminationGracePeriod = 5
 )
 
 type RunTaskRepeatType string
@@ -53,8 +59,15 @@ type Task struct {
 	taskInfo             RunTaskInfo
 	realWorkingDir       string
 	envHomeDir           string
+	// Private directory of invocation is used as working directory when
+	// neither specified one nor home directory of specified user is available
+	usePrivateWorkingDir bool
 	scheduleLocation     *time.Location
 	onFinish             FinishCallback
+	// Name registered in TaskFactory, which keys journal entry, spool file,
+	// saved script and staged artifacts of invocation. Only parallel runs of
+	// periodic task are named differently from task id.
+	runName              string
 
 	processer               process.ProcessCmd
 	startTime               time.Time
@@ -65,8 +78,29 @@ type Task struct {
 	canceled                bool
 	droped                  int
 	cancelMut               sync.Mutex
-	output                  bytes.Buffer
+	outputChunks            []outputChunk
+	reportedChunks          []outputChunk
+	outputDiscarded         int64
 	data_sended             uint32
+	// Control group of the running attempt, which is accessed by force-kill
+	// callback on the goroutine cancelling invocation as well
+	cgroup                  *invocationCgroup
+	cgroupMut               sync.Mutex
+	resourceUsage           *ResourceUsage
+	redactor                *stringutil.Redactor
+	// Number of attempts made by the latest run under retry policy
+	attempts                int
+	// Sandbox directory of the latest run, and whether it is kept after
+	// invocation
+	sandboxPath             string
+	keepSandbox             bool
+	// Artifacts collected after the latest run
+	artifacts               []Artifact
+	// Result file exposed to command process, and structured result read
+	// from it after the latest run
+	resultFilePath          string
+	result                  string
+	resultErr               error
 }
 
 func NewTask(taskInfo RunTaskInfo, scheduleLocation *time.Location, onFinish FinishCallback) *Task {
@@ -82,6 +116,15 @@ func NewTask(taskInfo RunTaskInfo, scheduleLocation *time.Location, onFinish Fin
 	return task
 }
 
+// runKey returns name keying on-disk state of invocation, thus parallel runs of
+// periodic task never overwrite each other
+func (task *Task) runKey() string {
+	if task.runName != "" {
+		return task.runName
+	}
+	return task.taskInfo.TaskId
+}
+
 type RunTaskInfo struct {
 	InstanceId      string `json:"instanceId"`
 	CommandType     string `json:"type"`
@@ -93,6 +136,17 @@ type RunTaskInfo struct {
 	Content         string `json:"commandContent"`
 	WorkingDir      string `json:"workingDirectory"`
 	Args            string `json:"args"`
+	Interpreter     string `json:"interpreter"`
+	// Base64-encoded detached ed25519 signature of command, and id of the
+	// trusted key which signed it
+	Signature       string `json:"signature"`
+	SignatureKeyId  string `json:"signatureKeyId"`
+	// Unix time in seconds chosen by signer, after which signed command is
+	// no longer run. Zero means signature never expires
+	SignatureExpiry int64  `json:"signatureExpiry"`
+	// Check syntax of script before running it even if not enabled in
+	// configuration
+	SyntaxCheck     bool   `json:"syntaxCheck"`
 	Cronat          string `json:"cron"`
 	Username        string `json:"username"`
 	Password        string `json:"windowsPasswordName"`
@@ -100,6 +154,29 @@ type RunTaskInfo struct {
 	Output          OutputInfo
 	Repeat          RunTaskRepeatType
 	EnvironmentArguments map[string]string
+	ResourceLimit   ResourceLimitInfo `json:"resourceLimit"`
+	TerminationGracePeriod int `json:"terminationGracePeriod"`
+	// How runs of periodic task missed during downtime are handled
+	Misfire         MisfirePolicyInfo `json:"misfirePolicy"`
+	// How run of periodic task overlapping with running invocation is handled
+	OverlapPolicy   string `json:"overlapPolicy"`
+	// Window in seconds of stable per-instance offset added to scheduled
+	// times of cron and rate tasks
+	Splay           int    `json:"splay"`
+	// How failed invocation is retried locally
+	Retry           RetryPolicyInfo `json:"retryPolicy"`
+	// Charset of command output on *nix, e.g., GB18030, which is detected
+	// from locale if not specified
+	OutputEncoding  string `json:"outputEncoding"`
+	// Seconds which invocation could run without any output before being
+	// terminated, and zero disables the check
+	IdleTimeout     int    `json:"idleTimeout"`
+	// How stdin of command process is provided, i.e., null or closed
+	StdinMode       string `json:"stdinMode"`
+	// Fresh scratch directory created for each invocation
+	Sandbox         SandboxInfo `json:"sandbox"`
+	// Files collected from working directory after command process exits
+	Artifacts       ArtifactsInfo `json:"artifacts"`
 }
 
 type SendFileTaskInfo struct {
@@ -115,6 +192,9 @@ type SendFileTaskInfo struct {
 	TaskID      string `json:"taskID"`
 	Timeout     int64  `json:"timeout"`
 	Output      OutputInfo
+	// Charset which text content is converted into from UTF-8 before written,
+	// or "locale" for default locale of system
+	TextEncoding string `json:"textEncoding"`
 }
 
 type SessionTaskInfo struct {
@@ -132,6 +212,9 @@ type OutputInfo struct {
 	LogQuota  int  `json:"logQuota"`
 	SkipEmpty bool `json:"skipEmpty"`
 	SendStart bool `json:"sendStart"`
+	// Report stdout and stderr as separated streams in JSON besides merged
+	// output, which should only be requested by supported endpoints
+	SeparateStreams bool `json:"separateStreams"`
 }
 
 var (
@@ -140,29 +223,6 @@ var (
 	ErrDefaultWorkingDirectoryNotAvailable = errors.New("DefaultWorkingDirectoryNotAvailable")
 )
 
-func tryRead(stdoutWrite, stderrWrite io.Reader, out *bytes.Buffer) {
-	buf_stdout := make([]byte, 1024)
-	n, _ := stdoutWrite.Read(buf_stdout)
-	buf_stderr := make([]byte, 1024)
-	m, _ := stderrWrite.Read(buf_stderr)
-	out.Write(buf_stdout[:n])
-	out.Write(buf_stderr[:m])
-}
-
-func tryReadAll(stdoutWrite, stderrWrite io.Reader, out *bytes.Buffer) {
-	for {
-		buf_stdout := make([]byte, 1024)
-		n, _ := stdoutWrite.Read(buf_stdout)
-		buf_stderr := make([]byte, 1024)
-		m, _ := stderrWrite.Read(buf_stderr)
-		out.Write(buf_stdout[:n])
-		out.Write(buf_stderr[:m])
-		if m == 0 && n == 0 {
-			break
-		}
-	}
-}
-
 func (task *Task) PreCheck(reportVerified bool) error {
 	// Reuse specified logger across whole task pre-checking phase
 	taskLogger := log.GetLogger().WithFields(logrus.Fields{
@@ -190,22 +250,65 @@ func (task *Task) PreCheck(reportVerified bool) error {
 		}
 	}
 
+	// Command types other than built-in scripts are run by interpreters in
+	// registry
 	if task.taskInfo.CommandType != "RunBatScript" &&
 		task.taskInfo.CommandType != "RunPowerShellScript" &&
 		task.taskInfo.CommandType != "RunShellScript" {
-		task.SendInvalidTask("TypeInvalid", fmt.Sprintf("TypeInvalid_%s", task.taskInfo.CommandType))
-		err := fmt.Errorf("Invalid command type: %s", task.taskInfo.CommandType)
-		taskLogger.Errorln("TypeInvalid", err.Error())
+		if _, err := lookupInterpreter(task.taskInfo); err != nil {
+			task.SendInvalidTask("TypeInvalid", fmt.Sprintf("TypeInvalid_%s", task.taskInfo.CommandType))
+			wrapErr := fmt.Errorf("Invalid command type: %s: %w", task.taskInfo.CommandType, err)
+			taskLogger.Errorln("TypeInvalid", wrapErr.Error())
+			return wrapErr
+		}
+	}
+
+	if task.taskInfo.OutputEncoding != "" {
+		if _, err := langutil.LookupCharset(task.taskInfo.OutputEncoding); err != nil {
+			task.SendInvalidTask("outputEncoding", task.taskInfo.OutputEncoding)
+			taskLogger.WithError(err).Errorln("Invalid output encoding")
+			return err
+		}
+	}
+
+	if err := validateStdinMode(task.taskInfo.StdinMode); err != nil {
+		task.SendInvalidTask("stdinMode", task.taskInfo.StdinMode)
+		taskLogger.WithError(err).Errorln("Invalid stdin mode")
 		return err
 	}
 
-	if _, err := base64.StdEncoding.DecodeString(task.taskInfo.Content); err != nil {
+	if err := validateArtifactPatterns(task.taskInfo.Artifacts.Patterns); err != nil {
+		task.SendInvalidTask("artifacts", err.Error())
+		taskLogger.WithError(err).Errorln("Invalid artifact patterns")
+		return err
+	}
+
+	decodedContent, err := base64.StdEncoding.DecodeString(task.taskInfo.Content)
+	if err != nil {
 		task.SendInvalidTask("CommandContentInvalid", err.Error())
 		wrapErr := fmt.Errorf("Invalid command content: decode error: %w", err)
 		taskLogger.Errorln("CommandContentInvalid", wrapErr.Error())
 		return wrapErr
 	}
 
+	signatureConfig, err := loadSignatureConfig()
+	if err != nil {
+		taskLogger.WithError(err).Errorf("Failed to load %s, enforce signature verification", signatureConfigFilename)
+	}
+	if signatureConfig.Mode != SignatureModeOff {
+		if err := verifyCommandSignature(task.taskInfo, decodedContent, signatureConfig.TrustedKeys); err != nil {
+			if signatureConfig.Mode == SignatureModeAudit {
+				taskLogger.WithError(err).Warningln("Signature verification failed in audit mode")
+			} else {
+				task.SendError("", wrapErrSignatureVerificationFailed, fmt.Sprintf("SignatureVerificationFailed: %s", err.Error()))
+				taskLogger.WithError(err).Errorln("SignatureVerificationFailed")
+				return err
+			}
+		} else {
+			taskLogger.Infoln("Signature of command verified")
+		}
+	}
+
 	envHomeDir, err := task.detectHomeDirectory()
 	if err != nil {
 		taskLogger.WithError(err).Warningln("Invalid HOME directory for invocation")
@@ -227,6 +330,14 @@ func (task *Task) PreCheck(reportVerified bool) error {
 	}
 	task.realWorkingDir = realWorkingDir
 
+	if err := evaluateLocalPolicy(func(policy *CommandPolicy) error {
+		return policy.EvaluateRunTask(task.taskInfo, decodedContent, realWorkingDir)
+	}); err != nil {
+		task.SendError("", wrapErrPolicyDenied, fmt.Sprintf("PolicyDenied: %s", err.Error()))
+		taskLogger.WithError(err).Errorln("PolicyDenied")
+		return err
+	}
+
 	if reportVerified == true {
 		task.sendTaskVerified()
 	}
@@ -244,6 +355,7 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 		"Phase":  "Running",
 	})
 	taskLogger.Info("Run task")
+	task.redactor = nil
 
 	taskLogger.Info("Prepare script file of task")
 	var fileName string
@@ -262,25 +374,98 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 
 	cmdType := task.taskInfo.CommandType
 	var cmdTypeName string
+	var interpreter *Interpreter
+	// Scripts run as specified user on *nix are saved in private directory
+	// owned by the user, instead of the script directory of agent which the
+	// user cannot access
+	usePrivateDir := false
 	if cmdType == "RunBatScript" {
 		cmdTypeName = ".bat"
 	} else if cmdType == "RunShellScript" {
 		cmdTypeName = ".sh"
-		if len(task.taskInfo.Username) > 0 {
-			fileName = "/tmp"
-		}
+		usePrivateDir = len(task.taskInfo.Username) > 0 && !G_IsWindows
 	} else if cmdType == "RunPowerShellScript" {
 		cmdTypeName = ".ps1"
+	} else if interpreter, err = lookupInterpreter(task.taskInfo); err == nil {
+		cmdTypeName = interpreter.Extension
+		usePrivateDir = len(task.taskInfo.Username) > 0 && !G_IsWindows
 	} else {
-		taskLogger.Errorln("unkwown command type")
+		taskLogger.WithError(err).Errorln("unkwown command type")
 		task.SendError("", wrapErrUnknownCommandType, fmt.Sprintf("UnknownCommandType: %s", cmdType))
 		return wrapErrUnknownCommandType, errors.New("unkwown command type")
 	}
+
+	var privateDir *privateInvocationDir
+	if usePrivateDir {
+		if privateDir, err = createPrivateInvocationDir(task.taskInfo.TaskId, task.taskInfo.Username); err != nil {
+			taskLogger.WithError(err).Errorln("Failed to create private directory for invocation")
+			errCode, errDescPrefix := task.categorizeSyscallErrno(err, wrapErrCreatePrivateDirFailed)
+			task.SendError("", errCode, fmt.Sprintf("%s: %s", errDescPrefix, err.Error()))
+			return errCode, err
+		}
+		// The whole private directory is removed after invocation, including
+		// script and anything else left in it
+		defer func() {
+			if err := privateDir.remove(); err != nil {
+				taskLogger.WithError(err).Warningln("Failed to remove private directory of invocation")
+			}
+		}()
+		taskLogger.Infof("Created private directory for invocation: %s", privateDir.path)
+		fileName = privateDir.path
+		if task.usePrivateWorkingDir {
+			task.realWorkingDir = privateDir.path
+		}
+	}
+	// Fresh sandbox directory is used as working directory unless specified,
+	// and exposed to command process via environment variable
+	task.sandboxPath = ""
+	task.keepSandbox = false
+	if task.taskInfo.Sandbox.Enabled {
+		sandbox, err := createSandboxDir(task.taskInfo.TaskId, task.taskInfo.Username, task.taskInfo.Sandbox.TmpfsSize)
+		if err != nil {
+			taskLogger.WithError(err).Errorln("Failed to create sandbox directory for invocation")
+			errCode, errDescPrefix := task.categorizeSyscallErrno(err, wrapErrCreateSandboxDirFailed)
+			task.SendError("", errCode, fmt.Sprintf("%s: %s", errDescPrefix, err.Error()))
+			return errCode, err
+		}
+		defer func() {
+			if task.keepSandbox {
+				taskLogger.Infof("Kept sandbox directory of failed invocation: %s", sandbox.path)
+				return
+			}
+			if err := sandbox.remove(); err != nil {
+				taskLogger.WithError(err).Warningln("Failed to remove sandbox directory of invocation")
+			}
+		}()
+		taskLogger.Infof("Created sandbox directory for invocation: %s", sandbox.path)
+		task.sandboxPath = sandbox.path
+		if task.taskInfo.WorkingDir == "" {
+			task.realWorkingDir = sandbox.path
+		}
+	}
+	// Result file is optional for command process, thus invocation goes on
+	// without it when its directory could not be created
+	task.resultFilePath = ""
+	task.result = ""
+	task.resultErr = nil
+	if !loadResultFileConfig().Disabled {
+		resultDir, err := createResultFileDir(task.taskInfo.TaskId, task.taskInfo.Username)
+		if err != nil {
+			taskLogger.WithError(err).Warningln("Failed to create directory of result file for invocation")
+		} else {
+			defer func() {
+				if err := resultDir.remove(); err != nil {
+					taskLogger.WithError(err).Warningln("Failed to remove directory of result file")
+				}
+			}()
+			task.resultFilePath = resultDir.filePath()
+		}
+	}
 	commandName := task.taskInfo.CommandName
 	if commandName == "" {
-		fileName = fileName + "/" + task.taskInfo.TaskId + cmdTypeName
+		fileName = fileName + "/" + task.runKey() + cmdTypeName
 	} else {
-		fileName = fileName + "/" + commandName + "-" + task.taskInfo.TaskId + cmdTypeName
+		fileName = fileName + "/" + commandName + "-" + task.runKey() + cmdTypeName
 	}
 	
 
@@ -289,7 +474,14 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 		task.sendPresetError("", wrapErrBase64DecodeFailed, err)
 		return wrapErrBase64DecodeFailed, errors.New("decode error")
 	}
+	// Script containing resolved secrets is removed on every return, including
+	// failures before command process is run
 	ScriptToDelete := ""
+	defer func() {
+		if ScriptToDelete != "" {
+			os.Remove(ScriptToDelete)
+		}
+	}()
 	content := string(decodeBytes)
 	if task.taskInfo.EnableParameter {
 		content, err = parameters.ResolveEnvironmentParameters(content, task.taskInfo.EnvironmentArguments)
@@ -298,13 +490,36 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 			return wrapErrResolveEnvironmentParameterFailed, err
 		}
 
-		if strings.Contains(content, "oos-secret") {
+		var sensitiveValues []string
+		content, sensitiveValues, err = getSecretResolvers().Resolve(content)
+		if err != nil {
+			// Keep reporting the error of resolver as param for compatibility
+			var resolveErr *parameters.ParameterResolveError
+			if errors.As(err, &resolveErr) {
+				task.SendInvalidTask(resolveErr.Err.Error(), resolveErr.Prefix+":"+resolveErr.Name)
+			} else {
+				task.SendInvalidTask(err.Error(), "")
+			}
+			return 0, fmt.Errorf("ResolveSecretParameters error: %w", err)
+		}
+		// Script file containing resolved secrets is removed after invocation,
+		// and secrets are masked in output, reported errors and logs during
+		// the invocation
+		if len(sensitiveValues) > 0 {
 			ScriptToDelete = fileName
+			task.redactor = stringutil.NewRedactor(sensitiveValues)
+			log.RegisterSecrets(sensitiveValues)
+			defer log.UnregisterSecrets(sensitiveValues)
 		}
-		content, err = util.ReplaceAllParameterStore(content)
-		if err != nil {
-			task.SendInvalidTask(err.Error(), "")
-			return 0, errors.New("ReplaceAllParameterStore error")
+
+		// Denied patterns could be hidden in parameter values, thus policy is
+		// evaluated again on resolved content before it is saved
+		if err := evaluateLocalPolicy(func(policy *CommandPolicy) error {
+			return policy.EvaluateContent([]byte(content))
+		}); err != nil {
+			task.sendPresetError("", wrapErrPolicyDenied, err)
+			taskLogger.WithError(err).Errorln("PolicyDenied")
+			return wrapErrPolicyDenied, err
 		}
 	}
 	if cmdType == "RunBatScript" {
@@ -317,7 +532,11 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 		}
 	}
 
-	if err := scriptmanager.SaveScriptFile(fileName, content); err != nil {
+	saveScriptFile := scriptmanager.SaveScriptFile
+	if privateDir != nil {
+		saveScriptFile = privateDir.saveScript
+	}
+	if err := saveScriptFile(fileName, content); err != nil {
 		// NOTE: Only non-repeated tasks need to check whether command script
 		// file exists.
 		if (task.taskInfo.Repeat != RunTaskCron && task.taskInfo.Repeat != RunTaskEveryReboot &&
@@ -342,11 +561,12 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 		}
 	}
 
-	// Set executable permission bit of shell script file
-	if cmdType == "RunShellScript" {
+	// Set executable permission bit of shell script file, and script file run
+	// by interpreter on *nix
+	if cmdType == "RunShellScript" || (interpreter != nil && !G_IsWindows) {
 		if err := acl.Chmod(fileName, 0755); err != nil {
-			task.SendError("", wrapErrSetExecutablePermissionFailed, fmt.Sprintf("SetExecutablePermissionFailed: Failed to set executable permission of shell script: %s", err.Error()))
-			taskLogger.WithError(err).Errorf("Failed to set executable permission of shell script")
+			task.SendError("", wrapErrSetExecutablePermissionFailed, fmt.Sprintf("SetExecutablePermissionFailed: Failed to set executable permission of script: %s", err.Error()))
+			taskLogger.WithError(err).Errorf("Failed to set executable permission of script")
 		}
 	} else {
 		if len(task.taskInfo.Username) > 0 {
@@ -357,9 +577,25 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 		}
 	}
 
+	if syntaxCheckConfig := loadSyntaxCheckConfig(); syntaxCheckConfig.Enabled || task.taskInfo.SyntaxCheck {
+		if checkerName, checkerArgs, ok := syntaxCheckCommand(cmdType, content, interpreter, fileName); ok {
+			taskLogger.Infof("Check syntax of script by %s", checkerName)
+			if _, err := exec.LookPath(checkerName); err != nil {
+				taskLogger.WithError(err).Warningln("Skipped syntax check since checker is not found")
+			} else if err := runSyntaxCheck(checkerName, checkerArgs, time.Duration(syntaxCheckConfig.Timeout)*time.Second); err != nil {
+				var syntaxErr *SyntaxCheckError
+				if !errors.As(err, &syntaxErr) {
+					taskLogger.WithError(err).Warningln("Skipped syntax check since checker failed to run")
+				} else {
+					taskLogger.WithError(err).Errorln("SyntaxCheckFailed")
+					task.SendError(syntaxErr.Output, wrapErrSyntaxCheckFailed, fmt.Sprintf("SyntaxCheckFailed: %s", syntaxErr.Error()))
+					return wrapErrSyntaxCheckFailed, err
+				}
+			}
+		}
+	}
+
 	taskLogger.Info("Prepare command process")
-	var stdoutWrite process.SafeBuffer
-	var stderrWrite process.SafeBuffer
 	timeout, err := strconv.Atoi(task.taskInfo.TimeOut)
 	if err != nil {
 		timeout = 3600
@@ -367,7 +603,11 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 
 	task.startTime = time.Now()
 	task.monotonicStartTimestamp = timetool.ToAccurateTime(task.startTime.Local())
+	if err := journalTransit(task.runKey(), task.taskInfo, TaskJournalRunning, task.monotonicStartTimestamp); err != nil {
+		taskLogger.WithError(err).Warningln("Failed to record running state in task journal")
+	}
 	args := make([]string, 2)
+	var interpreterEnv []string
 	if cmdType == "RunPowerShellScript" {
 		args[0] = "-file"
 		args[1] = fileName
@@ -382,15 +622,81 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 			taskLogger.WithError(err).Warningln("Failed to set powershell execution policy")
 		}
 	} else if cmdType == "RunShellScript" {
-		args[0] = "-c" // TODO: 兼容freebsd
-		args[1] = fileName
-		fileName = "sh"
+		// Shell script with shebang line is run by specified interpreter
+		// directly instead of being forced to run by sh, which also works when
+		// script is saved in filesystem mounted with noexec
+		if shebangInterpreter, shebangArgs, ok := parseShebang(content); ok && !G_IsWindows {
+			args = append(shebangArgs, fileName)
+			fileName = shebangInterpreter
+
+			if _, err := exec.LookPath(fileName); err != nil {
+				task.sendPresetError("", wrapErrInterpreterNotFound, err)
+				return wrapErrInterpreterNotFound, err
+			}
+		} else {
+			args[0] = "-c" // TODO: 兼容freebsd
+			args[1] = fileName
+			fileName = "sh"
+
+			if _, err := exec.LookPath(fileName); err != nil {
+				task.sendPresetError("", wrapErrSystemDefaultShellNotFound, err)
+				return wrapErrSystemDefaultShellNotFound, err
+			}
+		}
+	} else if interpreter != nil {
+		fileName, args = interpreter.command(fileName)
+		interpreterEnv = interpreter.environ()
 
 		if _, err := exec.LookPath(fileName); err != nil {
-			task.sendPresetError("", wrapErrSystemDefaultShellNotFound, err)
-			return wrapErrSystemDefaultShellNotFound, err
+			task.sendPresetError("", wrapErrInterpreterNotFound, err)
+			return wrapErrInterpreterNotFound, err
 		}
 	}
+	if task.taskInfo.StdinMode == StdinModeClosed {
+		fileName, args = closedStdinCommand(fileName, args)
+	}
+	processEnv := interpreterEnv
+	if task.sandboxPath != "" {
+		processEnv = append(processEnv, sandboxWorkdirEnvName+"="+task.sandboxPath)
+	}
+	if task.resultFilePath != "" {
+		processEnv = append(processEnv, resultFileEnvName+"="+task.resultFilePath)
+	}
+	task.processer.SetEnv(processEnv)
+
+	// Stdout and stderr are collected separately in order of arrival. Memory
+	// used to collect output is bounded by the collector, which retains enough
+	// data for reporting. Full output is spooled to disk instead.
+	collector := newOutputCollector(task.outputQuota())
+	stdoutWriter := collector.Writer(outputStreamStdout)
+	stderrWriter := collector.Writer(outputStreamStderr)
+	task.outputChunks = nil
+	task.reportedChunks = nil
+	task.outputDiscarded = 0
+	spool := task.openOutputSpool(taskLogger)
+	if spool != nil {
+		stdoutWriter = io.MultiWriter(spool, stdoutWriter)
+		stderrWriter = io.MultiWriter(spool, stderrWriter)
+	}
+	// Secrets are masked before output is collected and spooled, even if
+	// split across writes
+	var stdoutRedactingWriter, stderrRedactingWriter *stringutil.RedactingWriter
+	if !task.redactor.Empty() {
+		stdoutRedactingWriter = task.redactor.NewWriter(stdoutWriter)
+		stderrRedactingWriter = task.redactor.NewWriter(stderrWriter)
+		stdoutWriter = stdoutRedactingWriter
+		stderrWriter = stderrRedactingWriter
+	}
+	// Output in charset of locale is converted to UTF-8 before secrets are
+	// masked, and invalid sequences are replaced
+	var stdoutDecodingWriter, stderrDecodingWriter *langutil.DecodingWriter
+	if charset, charsetName := task.outputCharset(interpreterEnv, taskLogger); charset != nil {
+		taskLogger.Infof("Convert output of invocation from charset %s", charsetName)
+		stdoutDecodingWriter = langutil.NewDecodingWriter(stdoutWriter, charset)
+		stderrDecodingWriter = langutil.NewDecodingWriter(stderrWriter, charset)
+		stdoutWriter = stdoutDecodingWriter
+		stderrWriter = stderrDecodingWriter
+	}
 
 	task.sendTaskStart()
 	taskLogger.Infof("Sent starting event")
@@ -422,10 +728,9 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 				if atomic.LoadUint32(&task.data_sended) > defaultQuotoPre {
 					return
 				}
-				var running_output bytes.Buffer
-				tryRead(&stdoutWrite, &stderrWrite, &running_output)
-				task.sendRunningOutput(running_output.String())
-				atomic.AddUint32(&task.data_sended, uint32(running_output.Len()))
+				running_output := mergeOutputChunks(collector.Read(runningOutputReadSize))
+				task.sendRunningOutput(running_output)
+				atomic.AddUint32(&task.data_sended, uint32(len(running_output)))
 				taskLogger.Infof("Running output sent: %d bytes", atomic.LoadUint32(&task.data_sended))
 			case <-ctx.Done():
 				return
@@ -445,51 +750,216 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 	if task.envHomeDir != "" {
 		task.processer.SetHomeDir(task.envHomeDir)
 	}
+	// Whole process tree would be terminated on timeout or cancellation, and
+	// processes escaped from process group are killed via control group
+	gracePeriod := task.taskInfo.TerminationGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultTerminationGracePeriod
+	}
+	task.processer.SetTerminationGracePeriod(time.Duration(gracePeriod) * time.Second)
+	// Invocation producing no output for too long, e.g., waiting for input of
+	// interactive prompt, is terminated
+	task.processer.SetIdleTimeout(0)
+	if task.taskInfo.IdleTimeout > 0 {
+		task.processer.SetIdleTimeout(time.Duration(task.taskInfo.IdleTimeout) * time.Second)
+	}
+	task.processer.SetForceKillCallback(func() {
+		task.cgroupMut.Lock()
+		defer task.cgroupMut.Unlock()
+		if task.cgroup == nil {
+			return
+		}
+		if err := task.cgroup.kill(); err != nil {
+			taskLogger.WithError(err).Warningln("Failed to kill processes in control group of invocation")
+		}
+	})
 
-	task.exit_code, status, err = task.processer.SyncRun(task.realWorkingDir,
-		fileName, args,
-		&stdoutWrite, &stderrWrite, nil,
-		nil, timeout)
-	if status == process.Success {
-		taskLogger.WithFields(logrus.Fields{
-			"exitcode":   task.exit_code,
-			"extraError": err,
-		}).Info("Finished command process")
-	} else if status == process.Timeout {
-		taskLogger.WithFields(logrus.Fields{
-			"attchedError": err,
-		}).Info("Terminated command process due to timeout")
-	} else if status == process.Fail {
-		taskLogger.WithError(err).Info("Failed command process")
-	} else {
+	// Command process is run again after failed attempt under retry policy,
+	// and output of all attempts is collected together
+	resourceLimit := task.effectiveResourceLimit()
+	canceledBeforeAttempt := false
+	task.attempts = 0
+	for {
+		// Cancellation reported by Cancel() between attempts, or right before
+		// the first one, prevents another attempt from being started
+		if task.IsCancled() {
+			canceledBeforeAttempt = true
+			break
+		}
+		task.attempts++
+		// Only result written by the latest attempt is reported
+		if task.resultFilePath != "" {
+			os.Remove(task.resultFilePath)
+		}
+		// Place processes of invocation into its own control group when
+		// resource limitation is required
+		task.resourceUsage = nil
+		task.processer.SetPreExecCallback(nil)
+		if resourceLimit != nil {
+			cgroupName := fmt.Sprintf("%s-%d", task.taskInfo.TaskId, time.Now().UnixNano())
+			invocationCgroup, cgroupErr := newInvocationCgroup(cgroupName, resourceLimit)
+			if cgroupErr != nil {
+				taskLogger.WithFields(logrus.Fields{
+					"resourceLimit": resourceLimit,
+				}).WithError(cgroupErr).Warningln("Failed to limit resources of invocation via control group")
+			} else {
+				task.setCgroup(invocationCgroup)
+				// Process is placed into control group before the command is
+				// executed, thus none of its descendants escapes limitation
+				task.processer.SetPreExecCallback(func(pid int) {
+					if err := invocationCgroup.attach(pid); err != nil {
+						taskLogger.WithFields(logrus.Fields{
+							"resourceLimit": resourceLimit,
+						}).WithError(err).Warningln("Failed to limit resources of invocation via control group")
+						if task.takeCgroup() != nil {
+							invocationCgroup.destroy()
+						}
+						return
+					}
+					taskLogger.WithFields(logrus.Fields{
+						"resourceLimit": resourceLimit,
+					}).Infoln("Limited resources of invocation via control group")
+				})
+			}
+		}
+
+		task.exit_code, status, err = task.processer.SyncRun(task.realWorkingDir,
+			fileName, args,
+			stdoutWriter, stderrWriter, nil,
+			nil, timeout)
+		if status == process.Success {
+			taskLogger.WithFields(logrus.Fields{
+				"attempt":    task.attempts,
+				"exitcode":   task.exit_code,
+				"extraError": err,
+			}).Info("Finished command process")
+		} else if status == process.Timeout {
+			taskLogger.WithFields(logrus.Fields{
+				"attempt":      task.attempts,
+				"attchedError": err,
+				"terminatedBy": process.StrTerminationPhase(task.processer.TerminationPhase()),
+			}).Info("Terminated command process due to timeout")
+		} else if status == process.IdleTimeout {
+			taskLogger.WithFields(logrus.Fields{
+				"attempt":      task.attempts,
+				"idleTimeout":  task.taskInfo.IdleTimeout,
+				"terminatedBy": process.StrTerminationPhase(task.processer.TerminationPhase()),
+			}).Info("Terminated command process due to no output during idle timeout")
+		} else if status == process.Fail {
+			taskLogger.WithField("attempt", task.attempts).WithError(err).Info("Failed command process")
+		} else {
+			taskLogger.WithFields(logrus.Fields{
+				"attempt":      task.attempts,
+				"exitcode":     task.exit_code,
+				"status":       status,
+				"attchedError": err,
+			}).Warn("Ended command process with unexpected status")
+		}
+
+		if stdoutDecodingWriter != nil {
+			stdoutDecodingWriter.Flush()
+			stderrDecodingWriter.Flush()
+		}
+		if stdoutRedactingWriter != nil {
+			stdoutRedactingWriter.Flush()
+			stderrRedactingWriter.Flush()
+		}
+
+		// Control group is detached from invocation before being destroyed,
+		// thus never killed via force-kill callback afterwards
+		if invocationCgroup := task.takeCgroup(); invocationCgroup != nil {
+			resourceUsage, collectErr := invocationCgroup.collectUsage()
+			if collectErr != nil {
+				taskLogger.WithError(collectErr).Warningln("Failed to collect resource usage of invocation")
+			} else {
+				task.resourceUsage = resourceUsage
+				taskLogger.WithFields(logrus.Fields{
+					"resourceUsage": resourceUsage,
+				}).Infoln("Collected resource usage of invocation")
+			}
+			if err := invocationCgroup.destroy(); err != nil {
+				taskLogger.WithError(err).Warningln("Failed to destroy control group of invocation")
+			}
+		}
+
+		if errors.Is(err, process.ErrCanceledBeforeStart) {
+			// Canceled after checked above, and the process is never started
+			task.attempts--
+			canceledBeforeAttempt = true
+			break
+		}
+		if task.IsCancled() || !task.taskInfo.Retry.shouldRetry(task.attempts, status, task.exit_code) {
+			break
+		}
+		backoff := task.taskInfo.Retry.backoff(task.attempts)
 		taskLogger.WithFields(logrus.Fields{
-			"exitcode":     task.exit_code,
-			"status":       status,
-			"attchedError": err,
-		}).Warn("Ended command process with unexpected status")
+			"attempt":  task.attempts,
+			"exitcode": task.exit_code,
+			"status":   status,
+			"backoff":  backoff,
+		}).Infoln("Retry command process after failed attempt")
+		io.WriteString(stdoutWriter, retryAttemptMarker(task.attempts, status, task.exit_code, backoff))
+		if stdoutDecodingWriter != nil {
+			stdoutDecodingWriter.Flush()
+		}
+		if stdoutRedactingWriter != nil {
+			stdoutRedactingWriter.Flush()
+		}
+		if !task.waitRetryBackoff(backoff) {
+			// Cancellation has been reported by Cancel()
+			canceledBeforeAttempt = true
+			break
+		}
 	}
 
 	// That is, send stopping message to the goroutine sending running output
 	stopSendRunning()
 	// Wait for the goroutine sending running output to exit
 	<-stoppedSendRunning
-	tryReadAll(&stdoutWrite, &stderrWrite, &task.output)
+	task.outputChunks = collector.Read(0)
+	task.outputDiscarded = collector.Discarded()
+	if spool != nil {
+		if err := spool.Close(); err != nil {
+			taskLogger.WithError(err).Warningln("Failed to close output spool file")
+		}
+		taskLogger.WithFields(logrus.Fields{
+			"path":      spool.path,
+			"size":      spool.written,
+			"truncated": spool.truncated,
+			"error":     spool.writeErr,
+		}).Infoln("Spooled full output of invocation")
+	}
 
 	task.endTime = time.Now()
 	task.monotonicEndTimestamp = timetool.ToAccurateTime(timetool.ToStableElapsedTime(task.endTime, task.startTime).Local())
 
-	if status == process.Fail {
+	// Sandbox directory of failed invocation is kept for debugging if required
+	task.keepSandbox = task.sandboxPath != "" && task.taskInfo.Sandbox.KeepOnFailure &&
+		(status != process.Success || task.exit_code != 0 || task.IsCancled())
+	// Artifacts are listed in final report, thus collected only when it is
+	// going to be sent
+	task.artifacts = nil
+	if !canceledBeforeAttempt && !task.IsCancled() {
+		task.collectArtifacts(taskLogger)
+		task.collectResult(taskLogger)
+	}
+
+	if canceledBeforeAttempt {
+		// Invocation canceled before an attempt needs no more report
+	} else if status == process.Fail {
 		if err == nil {
-			task.sendOutput("failed", task.getReportString(task.output))
+			task.sendOutput("failed", task.getReportString())
 		} else {
 			errCode, errDescPrefix := task.categorizeSyscallErrno(err, wrapErrExecuteScriptFailed)
-			task.SendError(task.getReportString(task.output), errCode, fmt.Sprintf("%s: %s", errDescPrefix, err.Error()))
+			task.SendError(task.getReportString(), errCode, fmt.Sprintf("%s: %s", errDescPrefix, err.Error()))
 		}
 	} else if status == process.Timeout {
-		task.sendOutput("timeout", task.getReportString(task.output))
+		task.sendOutput("timeout", task.getReportString())
+	} else if status == process.IdleTimeout {
+		task.sendOutput("idleTimeout", task.getReportString())
 	} else {
 		if task.IsCancled() == false {
-			task.sendOutput("finished", task.getReportString(task.output))
+			task.sendOutput("finished", task.getReportString())
 		}
 	}
 	endTaskLogger := log.GetLogger().WithFields(logrus.Fields{
@@ -498,10 +968,13 @@ func (task *Task) Run() (presetWrapErrorCode, error) {
 	})
 	endTaskLogger.Info("Sent final output and state")
 
-	task.output.Reset()
+	task.outputChunks = nil
+	task.reportedChunks = nil
 	endTaskLogger.Info("Clean task output")
+	// Removed before instructed poweroff/reboot action rather than deferred
 	if ScriptToDelete != "" {
 		os.Remove(ScriptToDelete)
+		ScriptToDelete = ""
 	}
 
 	// Perform instructed poweroff/reboot action after task finished
@@ -536,77 +1009,98 @@ func (task *Task) sendTaskStart() {
 }
 
 func (task *Task) SendInvalidTask(param string, value string) {
-	reportInvalidTask(task.taskInfo.TaskId, param, value)
+	param = task.redactor.Redact(param)
+	value = task.redactor.Redact(value)
+	querystring := invalidTaskQueryString(task.taskInfo.TaskId, param, value)
+	task.recordHistory(reportServiceInvalid, querystring, "")
+	task.sendFinalReport(reportServiceInvalid, querystring, "", "text")
 }
 
 func (task *Task) sendOutput(status string, output string) {
-	if G_IsWindows {
-		if langutil.GetDefaultLang() != 0x409 {
-			tmp, _ := langutil.GbkToUtf8([]byte(output))
-			output = string(tmp)
-		}
-	}
-
-	var url string
+	var service string
 	if status == "finished" {
-		url = util.GetFinishOutputService()
-	} else if status == "timeout" {
-		url = util.GetTimeoutOutputService()
+		service = reportServiceFinish
+	} else if status == "timeout" || status == "idleTimeout" {
+		service = reportServiceTimeout
 	} else if status == "canceled" {
-		sendStoppedOutput(task.taskInfo.TaskId, task.monotonicStartTimestamp,
-			task.monotonicEndTimestamp, task.exit_code, task.droped, output,
-			stopReasonKilled)
+		querystring := stoppedOutputQueryString(task.taskInfo.TaskId, task.monotonicStartTimestamp,
+			task.monotonicEndTimestamp, task.exit_code, task.droped,
+			stopReasonKilled, process.StrTerminationPhase(task.processer.TerminationPhase()))
+		querystring += task.retryQueryParams()
+		querystring += task.sandboxQueryParams(task.taskInfo.Sandbox.KeepOnFailure)
+		task.sendOutputReport(reportServiceStopped, querystring, output)
 		return
 	} else if status == "failed" {
-		url = util.GetErrorOutputService()
+		service = reportServiceError
 	} else {
 		return
 	}
 
-	url += "?taskId=" + task.taskInfo.TaskId + "&start=" + strconv.FormatInt(task.monotonicStartTimestamp, 10)
-	url += "&end=" + strconv.FormatInt(task.monotonicEndTimestamp, 10) + "&exitCode=" + strconv.Itoa(task.exit_code) + "&dropped=" + strconv.Itoa(task.droped)
-	url += task.wallClockQueryParams()
-
-	var err error
-	_, err = util.HttpPost(url, output, "text")
-
-	for i := 0; i < 3 && err != nil; i++ {
-		time.Sleep(time.Duration(2) * time.Second)
-		_, err = util.HttpPost(url, output, "text")
+	querystring := "?taskId=" + task.taskInfo.TaskId + "&start=" + strconv.FormatInt(task.monotonicStartTimestamp, 10)
+	querystring += "&end=" + strconv.FormatInt(task.monotonicEndTimestamp, 10) + "&exitCode=" + strconv.Itoa(task.exit_code) + "&dropped=" + strconv.Itoa(task.droped)
+	querystring += task.wallClockQueryParams()
+	querystring += task.resourceUsageQueryParams()
+	querystring += task.terminationQueryParams()
+	querystring += task.retryQueryParams()
+	querystring += task.sandboxQueryParams(task.keepSandbox)
+	querystring += task.artifactsQueryParams()
+	querystring += task.resultQueryParams()
+	// Timeout due to no output is distinguished from timeout of wall time
+	if status == "idleTimeout" {
+		querystring += "&timeoutReason=" + timeoutReasonIdle
 	}
 
+	task.sendOutputReport(service, querystring, output)
+
 	if task.onFinish != nil {
 		task.onFinish()
 	}
 }
 
 func (task *Task) SendError(output string, errCode presetWrapErrorCode, errDesc string) {
+	// Secrets are masked before truncation, thus no part of them is reported
+	errDesc = task.redactor.Redact(errDesc)
+	output = task.redactor.Redact(output)
 	safelyTruncatedErrDesc := langutil.SafeTruncateStringInBytes(errDesc, 255)
 	escapedErrDesc := url.QueryEscape(safelyTruncatedErrDesc)
 	queryString := fmt.Sprintf("?taskId=%s&start=%d&end=%d&exitCode=%d&dropped=%d&errCode=%d&errDesc=%s",
 		task.taskInfo.TaskId, task.monotonicStartTimestamp, task.monotonicEndTimestamp, task.exit_code,
 		task.droped, errCode, escapedErrDesc)
 	queryString += task.wallClockQueryParams()
-
-	requestURL := util.GetErrorOutputService() + queryString
-
-	if len(output) > 0 && G_IsWindows {
-		if langutil.GetDefaultLang() != 0x409 {
-			tmp, _ := langutil.GbkToUtf8([]byte(output))
-			output = string(tmp)
-		}
-	}
-
-	_, err := util.HttpPost(requestURL, output, "text")
-	for i := 0; i < 3 && err != nil; i++ {
-		time.Sleep(time.Duration(2) * time.Second)
-		_, err = util.HttpPost(requestURL, output, "text")
-	}
+	queryString += task.resourceUsageQueryParams()
+	queryString += task.terminationQueryParams()
+	queryString += task.retryQueryParams()
+	queryString += task.sandboxQueryParams(task.keepSandbox)
+	queryString += task.artifactsQueryParams()
+	queryString += task.resultQueryParams()
+
+	task.sendOutputReport(reportServiceError, queryString, output)
 }
 
 func (task *Task) Cancel() {
 	task.cancelMut.Lock()
 	defer task.cancelMut.Unlock()
+	task.terminate()
+	task.sendOutput("canceled", task.getReportString())
+}
+
+// Replace terminates invocation of periodic task replaced by a newer run, and
+// reports it as stopped with replaced result instead of killed
+func (task *Task) Replace() {
+	task.cancelMut.Lock()
+	defer task.cancelMut.Unlock()
+	task.terminate()
+	querystring := stoppedOutputQueryString(task.taskInfo.TaskId, task.monotonicStartTimestamp,
+		task.monotonicEndTimestamp, task.exit_code, task.droped,
+		stopReasonReplaced, process.StrTerminationPhase(task.processer.TerminationPhase()))
+	querystring += task.retryQueryParams()
+	querystring += task.sandboxQueryParams(task.taskInfo.Sandbox.KeepOnFailure)
+	task.sendOutputReport(reportServiceStopped, querystring, task.getReportString())
+}
+
+// terminate marks invocation as canceled and terminates its process tree,
+// which must be called with cancelMut held
+func (task *Task) terminate() {
 	task.canceled = true
 	// Consistent with C++ version, end time of canceled task is set to the time
 	// of cancel operation
@@ -616,25 +1110,67 @@ func (task *Task) Cancel() {
 	} else {
 		task.monotonicEndTimestamp = timetool.ToAccurateTime(timetool.ToStableElapsedTime(task.endTime, task.startTime).Local())
 	}
-	task.sendOutput("canceled", task.getReportString(task.output))
+	// Terminate the whole process tree before reporting, thus which phase
+	// terminated it could be reported
 	task.processer.Cancel()
 }
 
-func (task *Task) getReportString(output bytes.Buffer) string {
-	var report_string string
+func (task *Task) outputQuota() int {
 	quoto := task.taskInfo.Output.LogQuota
 	if quoto < defaultQuoto {
 		quoto = defaultQuoto
 	}
+	return quoto
+}
+
+// getReportString returns the tail of output not sent as running output.
+// Output discarded by collector is counted as dropped as well.
+func (task *Task) getReportString() string {
+	quoto := task.outputQuota()
 	data_sended := atomic.LoadUint32(&task.data_sended)
-	if output.Len() <= quoto-int(data_sended) {
-		report_string = output.String()
+	totalLen := int64(outputChunksLen(task.outputChunks)) + task.outputDiscarded
+	if totalLen <= int64(quoto-int(data_sended)) {
+		task.reportedChunks = task.outputChunks
 	} else {
-		bytes_data := output.Bytes()
-		task.droped = output.Len() - (quoto - int(data_sended))
-		report_string = string(bytes_data[task.droped:])
+		droped := int(totalLen) - (quoto - int(data_sended))
+		task.reportedChunks = trimOutputChunks(task.outputChunks, int(int64(droped)-task.outputDiscarded))
+		// Trimmed chunks may be shorter to keep characters intact
+		task.droped = int(totalLen) - outputChunksLen(task.reportedChunks)
+	}
+	return mergeOutputChunks(task.reportedChunks)
+}
+
+// sendOutputReport sends final report with output of invocation, which is
+// the merged output in plain text, or separated streams in JSON if requested
+func (task *Task) sendOutputReport(service string, querystring string, output string) {
+	task.recordHistory(service, querystring, output)
+	if !task.taskInfo.Output.SeparateStreams {
+		task.sendFinalReport(service, querystring, output, "text")
+		return
+	}
+
+	body, err := encodeSeparatedOutput(task.reportedChunks)
+	if err != nil {
+		log.GetLogger().WithFields(logrus.Fields{
+			"TaskId": task.taskInfo.TaskId,
+			"Phase":  "Reporting",
+		}).WithError(err).Errorln("Failed to encode separated output, fallback to merged output")
+		task.sendFinalReport(service, querystring, output, "text")
+		return
+	}
+	task.sendFinalReport(service, querystring+outputFormatSeparated, body, "json")
+}
+
+// convertCommandOutput converts output of command run by agent itself, which
+// is encoded in GBK on Windows not in English, to UTF-8
+func convertCommandOutput(output string) string {
+	if len(output) > 0 && G_IsWindows {
+		if langutil.GetDefaultLang() != 0x409 {
+			tmp, _ := langutil.GbkToUtf8([]byte(output))
+			output = string(tmp)
+		}
 	}
-	return report_string
+	return output
 }
 
 func (task *Task) sendRunningOutput(data string) {
@@ -645,12 +1181,6 @@ func (task *Task) sendRunningOutput(data string) {
 	if len(data) == 0 && task.taskInfo.Output.SkipEmpty {
 		return
 	}
-	if G_IsWindows {
-		if langutil.GetDefaultLang() != 0x409 {
-			tmp, _ := langutil.GbkToUtf8([]byte(data))
-			data = string(tmp)
-		}
-	}
 	util.HttpPost(url, data, "text")
 }
 
@@ -686,6 +1216,16 @@ func (task *Task) wallClockQueryParams() string {
 	return ""
 }
 
+// Generate additional querystring parameter indicating in which phase the
+// process tree was terminated due to timeout or cancellation
+func (task *Task) terminationQueryParams() string {
+	terminatedBy := process.StrTerminationPhase(task.processer.TerminationPhase())
+	if terminatedBy == "" {
+		return ""
+	}
+	return "&terminatedBy=" + terminatedBy
+}
+
 func (task *Task) sendPresetError(output string, errCode presetWrapErrorCode, err error) {
 	errDescPrefix := presetErrorPrefixes[errCode]
 	task.SendError(output, errCode, fmt.Sprintf("%s: %s", errDescPrefix, err.Error()))
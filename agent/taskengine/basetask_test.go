@@ -61,7 +61,7 @@ func TestRunTask(t *testing.T) {
 		WorkingDir:workingDir,
 		Content:content,
 	}
-	task := NewTask(info)
+	task := NewTask(info, nil, nil)
 
 	errcode, err := task.Run()
 
@@ -93,6 +93,8 @@ func (task *Task) detectWorkingDirectory() (string, error) {
 		"Step": "detectWorkingDirectory",
 	})
 
+	task.usePrivateWorkingDir = false
+
 	// 1. When working directory for invocation has been specified, just check
 	// its existence.
 	if task.taskInfo.WorkingDir != "" {
@@ -107,15 +109,21 @@ func (task *Task) detectWorkingDirectory() (string, error) {
 	}
 
 	// 2. When working directory for invocation had not been specified, use home
-	// directory of specified user for invocation instead
+	// directory of specified user for invocation instead. Private directory of
+	// invocation owned by the user is used if home directory is not available,
+	// rather than any shared directory.
 	if task.taskInfo.Username != "" {
 		if task.envHomeDir == "" {
-			return "", fmt.Errorf("%w: Failed to use home directory of specified user as working directory for invocation", ErrDefaultWorkingDirectoryNotAvailable)
+			taskLogger.Warningln("Home directory of specified user is not available and private directory of invocation would be used as working directory")
+			task.usePrivateWorkingDir = true
+			return "", nil
 		}
 
 		taskLogger.Infof("Detected home directory of specified user %s: %s", task.taskInfo.Username, task.envHomeDir)
 		if !util.IsDirectory(task.envHomeDir) {
-			return "", fmt.Errorf("%w: Failed to use home directory of specified user as working directory for invocation: %s does not exist", ErrDefaultWorkingDirectoryNotAvailable, task.envHomeDir)
+			taskLogger.Warningf("Home directory of specified user %s does not exist and private directory of invocation would be used as working directory", task.envHomeDir)
+			task.usePrivateWorkingDir = true
+			return "", nil
 		}
 
 		taskLogger.WithFields(logrus.Fields{
@@ -158,3 +166,10 @@ func (task *Task) categorizeSyscallErrno(err error, prefixDefault presetWrapErro
 
 	return prefixDefault, defaultPrefix
 }
+
+// closedStdinCommand wraps command with shell which closes stdin before
+// replacing itself with the command, thus pid and process group are kept
+func closedStdinCommand(commandName string, commandArguments []string) (string, []string) {
+	args := append([]string{"-c", `exec 0<&- "$0" "$@"`, commandName}, commandArguments...)
+	return "sh", args
+}
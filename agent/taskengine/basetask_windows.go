@@ -33,3 +33,9 @@ func (task *Task) detectWorkingDirectory() (string, error) {
 func (task *Task) categorizeSyscallErrno(err error, prefixDefault presetWrapErrorCode) (presetWrapErrorCode, string) {
 	return prefixDefault, presetErrorPrefixes[prefixDefault]
 }
+
+// closedStdinCommand keeps command unchanged on Windows, whose stdin is always
+// fed from null device
+func closedStdinCommand(commandName string, commandArguments []string) (string, []string) {
+	return commandName, commandArguments
+}
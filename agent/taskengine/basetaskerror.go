@@ -20,6 +20,14 @@ const (
 	wrapErrPowershellNotFound
 	wrapErrSystemDefaultShellNotFound
 	wrapErrResolveEnvironmentParameterFailed
+	wrapErrInterruptedByAgentRestart
+	wrapErrInterpreterNotFound
+	wrapErrTaskQueueFull
+	wrapErrSignatureVerificationFailed
+	wrapErrPolicyDenied
+	wrapErrSyntaxCheckFailed
+	wrapErrCreatePrivateDirFailed
+	wrapErrCreateSandboxDirFailed
 )
 
 var (
@@ -35,5 +43,13 @@ var (
 		wrapErrScriptFileExisted: "ScriptFileExisted",
 		wrapErrPowershellNotFound: "PowershellNotFound",
 		wrapErrSystemDefaultShellNotFound: "SystemDefaultShellNotFound",
+		wrapErrInterruptedByAgentRestart: "InterruptedByAgentRestart",
+		wrapErrInterpreterNotFound: "InterpreterNotFound",
+		wrapErrTaskQueueFull: "TaskQueueFull",
+		wrapErrSignatureVerificationFailed: "SignatureVerificationFailed",
+		wrapErrPolicyDenied: "PolicyDenied",
+		wrapErrSyntaxCheckFailed: "SyntaxCheckFailed",
+		wrapErrCreatePrivateDirFailed: "CreatePrivateDirFailed",
+		wrapErrCreateSandboxDirFailed: "CreateSandboxDirFailed",
 	}
 )
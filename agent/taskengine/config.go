@@ -0,0 +1,64 @@
+package taskengine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+// loadedTaskConfigDigests records MD5 digest of content last loaded from each
+// configuration file, in order to log only when the content changes
+var (
+	loadedTaskConfigDigests    = make(map[string]string)
+	loadedTaskConfigDigestsMut sync.Mutex
+)
+
+// loadTaskConfigFile reads and parses JSON configuration file for task engine.
+// The file in cross-version config directory takes precedence over the one in
+// config directory of current version. false would be returned when neither of
+// them exists.
+func loadTaskConfigFile(filename string, v interface{}) (bool, error) {
+	return loadTaskConfigFileWith(filename, v, json.Unmarshal)
+}
+
+// loadTaskConfigFileWith is the same as loadTaskConfigFile but parses content
+// of configuration file with specified unmarshal function, e.g., for YAML.
+func loadTaskConfigFileWith(filename string, v interface{}, unmarshal func([]byte, interface{}) error) (bool, error) {
+	var candidateDirs []string
+	if crossVersionConfigDir, err := util.GetCrossVersionConfigPath(); err == nil {
+		candidateDirs = append(candidateDirs, crossVersionConfigDir)
+	}
+	if currentVersionConfigDir, err := util.GetConfigPath(); err == nil {
+		candidateDirs = append(candidateDirs, currentVersionConfigDir)
+	}
+
+	for _, configDir := range candidateDirs {
+		configPath := filepath.Join(configDir, filename)
+		if !util.CheckFileIsExist(configPath) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return false, err
+		}
+		if err := unmarshal(content, v); err != nil {
+			return false, err
+		}
+		digest := util.ComputeBinMd5(content)
+		loadedTaskConfigDigestsMut.Lock()
+		changed := loadedTaskConfigDigests[configPath] != digest
+		loadedTaskConfigDigests[configPath] = digest
+		loadedTaskConfigDigestsMut.Unlock()
+		if changed {
+			log.GetLogger().Infof("Loaded task engine configuration from %s", configPath)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,387 @@
+package taskengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	historyConfigFilename = "task_history.json"
+
+	historyDirName = "task_history"
+	historyFileExt = ".json"
+
+	defaultHistoryMaxRecords     = 1000
+	defaultHistoryOutputTailSize = 4096
+)
+
+// Status of invocation recorded in history, which is named after the service
+// its final report is sent to
+const (
+	HistoryStatusFinished = "finished"
+	HistoryStatusFailed   = "failed"
+	HistoryStatusTimeout  = "timeout"
+	// Timed out since no output was produced during idle timeout
+	HistoryStatusIdleTimeout = "idleTimeout"
+	HistoryStatusStopped     = "stopped"
+	HistoryStatusInvalid     = "invalid"
+)
+
+var (
+	ErrHistoryRecordNotFound   = errors.New("No history record of specified task")
+	ErrInvalidTaskIdForHistory = errors.New("Invalid task id for history")
+
+	_historyLock sync.Mutex
+
+	historyStatusOfService = map[string]string{
+		reportServiceFinish:  HistoryStatusFinished,
+		reportServiceError:   HistoryStatusFailed,
+		reportServiceTimeout: HistoryStatusTimeout,
+		reportServiceStopped: HistoryStatusStopped,
+		reportServiceInvalid: HistoryStatusInvalid,
+	}
+)
+
+// HistoryConfig is loaded from task_history.json in config directory
+type HistoryConfig struct {
+	Disabled   bool `json:"disabled"`
+	MaxRecords int  `json:"maxRecords"`
+	// Only the tail of output in bytes is kept in history
+	OutputTailSize int `json:"outputTailSize"`
+}
+
+// HistoryRecord describes one finished invocation in local history, which is
+// kept on disk and could be inspected offline
+type HistoryRecord struct {
+	TaskId      string `json:"taskId"`
+	CommandId   string `json:"commandId"`
+	CommandName string `json:"commandName"`
+	CommandType string `json:"commandType"`
+	Repeat      string `json:"repeat"`
+	Username    string `json:"username"`
+	WorkingDir  string `json:"workingDir"`
+	// Unix timestamps in milliseconds, and StartTime is zero for invocations
+	// never started
+	StartTime  int64  `json:"startTime"`
+	EndTime    int64  `json:"endTime"`
+	Status     string `json:"status"`
+	ExitCode   int    `json:"exitCode"`
+	ErrorCode  string `json:"errorCode,omitempty"`
+	ErrorDesc  string `json:"errorDesc,omitempty"`
+	Dropped    int    `json:"dropped"`
+	OutputTail string `json:"outputTail"`
+	// Number of attempts made under retry policy, zero without retry policy
+	Attempts int `json:"attempts,omitempty"`
+	// Structured result written into result file by command process
+	Result string `json:"result,omitempty"`
+}
+
+// HistoryFilter selects records in history. Zero value fields impose no
+// restriction.
+type HistoryFilter struct {
+	Since     time.Time
+	Until     time.Time
+	Status    string
+	CommandId string
+	TaskId    string
+	// Maximum number of records returned
+	Limit int
+}
+
+func loadHistoryConfig() HistoryConfig {
+	config := HistoryConfig{}
+	if _, err := loadTaskConfigFile(historyConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", historyConfigFilename)
+		config = HistoryConfig{}
+	}
+	if config.MaxRecords <= 0 {
+		config.MaxRecords = defaultHistoryMaxRecords
+	}
+	if config.OutputTailSize <= 0 {
+		config.OutputTailSize = defaultHistoryOutputTailSize
+	}
+	return config
+}
+
+func getHistoryDir() (string, error) {
+	cacheDir, err := util.GetCachePath()
+	if err != nil {
+		return "", err
+	}
+	historyDir := filepath.Join(cacheDir, historyDirName)
+	if err := util.MakeSurePath(historyDir); err != nil {
+		return "", err
+	}
+	return historyDir, nil
+}
+
+// outputTail returns the last bytes of output within size limit without
+// splitting UTF-8 characters
+func outputTail(output string, size int) string {
+	if len(output) <= size {
+		return output
+	}
+	// Skip continuation bytes of character split at the beginning
+	return output[runeBoundaryAfter(output, len(output)-size):]
+}
+
+// newHistoryRecord builds record from final report of invocation. Error code
+// and description are extracted from querystring of report.
+func (task *Task) newHistoryRecord(service string, querystring string, output string, outputTailSize int) HistoryRecord {
+	record := HistoryRecord{
+		TaskId:      task.taskInfo.TaskId,
+		CommandId:   task.taskInfo.CommandId,
+		CommandName: task.taskInfo.CommandName,
+		CommandType: task.taskInfo.CommandType,
+		Repeat:      string(task.taskInfo.Repeat),
+		Username:    task.taskInfo.Username,
+		WorkingDir:  task.realWorkingDir,
+		EndTime:     time.Now().UnixNano() / int64(time.Millisecond),
+		Status:      historyStatusOfService[service],
+		ExitCode:    task.exit_code,
+		Dropped:     task.droped,
+		OutputTail:  outputTail(output, outputTailSize),
+	}
+	if !task.startTime.IsZero() {
+		record.StartTime = task.startTime.UnixNano() / int64(time.Millisecond)
+	}
+	if !task.endTime.IsZero() {
+		record.EndTime = task.endTime.UnixNano() / int64(time.Millisecond)
+	}
+	if record.WorkingDir == "" {
+		record.WorkingDir = task.taskInfo.WorkingDir
+	}
+	if task.taskInfo.Retry.maxAttempts() > 1 {
+		record.Attempts = task.attempts
+	}
+	record.Result = task.redactor.Redact(task.result)
+
+	if params, err := url.ParseQuery(strings.TrimPrefix(querystring, "?")); err == nil {
+		switch service {
+		case reportServiceError:
+			record.ErrorCode = params.Get("errCode")
+			if prefix, ok := presetErrorPrefixes[presetWrapErrorCodeOf(record.ErrorCode)]; ok {
+				record.ErrorCode = prefix
+			}
+			record.ErrorDesc = params.Get("errDesc")
+		case reportServiceInvalid:
+			record.ErrorCode = params.Get("param")
+			record.ErrorDesc = params.Get("value")
+		case reportServiceStopped:
+			record.ErrorCode = params.Get("result")
+		case reportServiceTimeout:
+			if params.Get("timeoutReason") == timeoutReasonIdle {
+				record.Status = HistoryStatusIdleTimeout
+			}
+		}
+	}
+	return record
+}
+
+func presetWrapErrorCodeOf(code string) presetWrapErrorCode {
+	value, err := strconv.Atoi(code)
+	if err != nil {
+		return 0
+	}
+	return presetWrapErrorCode(value)
+}
+
+// recordHistory adds final result of invocation into local history. Failures
+// are only logged since history is merely for inspection.
+func (task *Task) recordHistory(service string, querystring string, output string) {
+	config := loadHistoryConfig()
+	if config.Disabled {
+		return
+	}
+	record := task.newHistoryRecord(service, querystring, output, config.OutputTailSize)
+	if err := writeHistoryRecord(record, config.MaxRecords); err != nil {
+		log.GetLogger().WithField("TaskId", task.taskInfo.TaskId).WithError(err).Warningln("Failed to record invocation in local history")
+	}
+}
+
+// writeHistoryRecord writes record into its own file named after the time of
+// recording, and removes the oldest records beyond limit
+func writeHistoryRecord(record HistoryRecord, maxRecords int) error {
+	if _, ok := taskIdFileName(record.TaskId); !ok {
+		return ErrInvalidTaskIdForHistory
+	}
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_historyLock.Lock()
+	defer _historyLock.Unlock()
+	// Zero-padded timestamp keeps lexical order of file names chronological
+	filename := fmt.Sprintf("%013d-%s%s", time.Now().UnixNano()/int64(time.Millisecond), record.TaskId, historyFileExt)
+	path := filepath.Join(historyDir, filename)
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	historyFiles, err := listHistoryFiles(historyDir)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(historyFiles)-maxRecords; i++ {
+		os.Remove(historyFiles[i])
+	}
+	return nil
+}
+
+// listHistoryFiles returns history files from the oldest to the newest
+func listHistoryFiles(historyDir string) ([]string, error) {
+	historyFiles, err := filepath.Glob(filepath.Join(historyDir, "*"+historyFileExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(historyFiles)
+	return historyFiles, nil
+}
+
+func (f *HistoryFilter) match(record *HistoryRecord) bool {
+	recordTime := time.Unix(0, record.EndTime*int64(time.Millisecond))
+	if !f.Since.IsZero() && recordTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && recordTime.After(f.Until) {
+		return false
+	}
+	if f.Status != "" && f.Status != record.Status {
+		return false
+	}
+	if f.CommandId != "" && f.CommandId != record.CommandId {
+		return false
+	}
+	if f.TaskId != "" && f.TaskId != record.TaskId {
+		return false
+	}
+	return true
+}
+
+// ListHistory returns records matching filter from the newest to the oldest
+func ListHistory(filter HistoryFilter) ([]HistoryRecord, error) {
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		return nil, err
+	}
+	historyFiles, err := listHistoryFiles(historyDir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]HistoryRecord, 0)
+	for i := len(historyFiles) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(records) >= filter.Limit {
+			break
+		}
+		content, err := ioutil.ReadFile(historyFiles[i])
+		if err != nil {
+			continue
+		}
+		record := HistoryRecord{}
+		if err := json.Unmarshal(content, &record); err != nil {
+			continue
+		}
+		if filter.match(&record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// GetHistory returns the latest record of specified task
+func GetHistory(taskId string) (*HistoryRecord, error) {
+	records, err := ListHistory(HistoryFilter{
+		TaskId: taskId,
+		Limit:  1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrHistoryRecordNotFound, taskId)
+	}
+	return &records[0], nil
+}
+
+// Brief returns one-line summary of record for listing
+func (r *HistoryRecord) Brief() string {
+	endTime := time.Unix(0, r.EndTime*int64(time.Millisecond)).Format("2006-01-02 15:04:05")
+	username := r.Username
+	if username == "" {
+		username = "-"
+	}
+	commandId := r.CommandId
+	if commandId == "" {
+		commandId = "-"
+	}
+	return fmt.Sprintf("%s  %-9s %5d  %-24s %-24s %s", endTime, r.Status, r.ExitCode, r.TaskId, commandId, username)
+}
+
+// Detail returns multi-line description of record including output tail
+func (r *HistoryRecord) Detail() string {
+	formatTime := func(timestamp int64) string {
+		if timestamp == 0 {
+			return "-"
+		}
+		return time.Unix(0, timestamp*int64(time.Millisecond)).Format(time.RFC3339)
+	}
+	attempts := ""
+	if r.Attempts > 0 {
+		attempts = strconv.Itoa(r.Attempts)
+	}
+	var builder strings.Builder
+	fields := [][2]string{
+		{"Task ID", r.TaskId},
+		{"Command ID", r.CommandId},
+		{"Command name", r.CommandName},
+		{"Command type", r.CommandType},
+		{"Repeat", r.Repeat},
+		{"User", r.Username},
+		{"Working directory", r.WorkingDir},
+		{"Start time", formatTime(r.StartTime)},
+		{"End time", formatTime(r.EndTime)},
+		{"Status", r.Status},
+		{"Exit code", strconv.Itoa(r.ExitCode)},
+		{"Attempts", attempts},
+		{"Error code", r.ErrorCode},
+		{"Error description", r.ErrorDesc},
+		{"Dropped bytes", strconv.Itoa(r.Dropped)},
+		{"Result", r.Result},
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&builder, "%-18s %s\n", field[0]+":", field[1])
+	}
+	builder.WriteString("Output tail:\n")
+	builder.WriteString(r.OutputTail)
+	if !strings.HasSuffix(r.OutputTail, "\n") {
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,110 @@
+package taskengine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputTail(t *testing.T) {
+	assert.Equal(t, "abc", outputTail("abc", 10))
+	assert.Equal(t, "bc", outputTail("abc", 2))
+	// Split character at the beginning of tail is dropped
+	assert.Equal(t, "b", outputTail("a中b", 3))
+	assert.Equal(t, "中b", outputTail("a中b", 4))
+}
+
+func TestNewHistoryRecord(t *testing.T) {
+	task := NewTask(RunTaskInfo{
+		TaskId:      "t-history",
+		CommandId:   "c-history",
+		CommandType: "RunShellScript",
+		Repeat:      RunTaskOnce,
+		Username:    "nobody",
+		WorkingDir:  "/tmp",
+	}, nil, nil)
+	task.startTime = time.Unix(1600000000, 0)
+	task.endTime = time.Unix(1600000010, 0)
+	task.exit_code = 1
+
+	record := task.newHistoryRecord(reportServiceError,
+		"?taskId=t-history&errCode=-1&errDesc=Something+wrong", "output", 100)
+	assert.Equal(t, "t-history", record.TaskId)
+	assert.Equal(t, "c-history", record.CommandId)
+	assert.Equal(t, "Once", record.Repeat)
+	assert.Equal(t, "nobody", record.Username)
+	assert.Equal(t, "/tmp", record.WorkingDir)
+	assert.Equal(t, int64(1600000000000), record.StartTime)
+	assert.Equal(t, int64(1600000010000), record.EndTime)
+	assert.Equal(t, HistoryStatusFailed, record.Status)
+	assert.Equal(t, 1, record.ExitCode)
+	assert.Equal(t, presetErrorPrefixes[presetWrapErrorCode(-1)], record.ErrorCode)
+	assert.Equal(t, "Something wrong", record.ErrorDesc)
+	assert.Equal(t, "output", record.OutputTail)
+
+	record = task.newHistoryRecord(reportServiceStopped, stoppedOutputQueryString("t-history", 0, 0, 0, 0, stopReasonReplaced, ""), "", 100)
+	assert.Equal(t, HistoryStatusStopped, record.Status)
+	assert.Equal(t, stopReasonReplaced, record.ErrorCode)
+
+	record = task.newHistoryRecord(reportServiceInvalid, invalidTaskQueryString("t-history", "PolicyDenied", "denied"), "", 100)
+	assert.Equal(t, HistoryStatusInvalid, record.Status)
+	assert.Equal(t, "PolicyDenied", record.ErrorCode)
+	assert.Equal(t, "denied", record.ErrorDesc)
+
+	record = task.newHistoryRecord(reportServiceTimeout, "?taskId=t-history&timeoutReason="+timeoutReasonIdle, "", 100)
+	assert.Equal(t, HistoryStatusIdleTimeout, record.Status)
+	record = task.newHistoryRecord(reportServiceTimeout, "?taskId=t-history", "", 100)
+	assert.Equal(t, HistoryStatusTimeout, record.Status)
+}
+
+func TestHistoryStore(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+
+	now := time.Now()
+	records := []HistoryRecord{
+		{TaskId: "t-1", CommandId: "c-1", Status: HistoryStatusFinished, EndTime: now.Add(-3*time.Hour).UnixNano() / int64(time.Millisecond)},
+		{TaskId: "t-2", CommandId: "c-2", Status: HistoryStatusFailed, EndTime: now.Add(-2*time.Hour).UnixNano() / int64(time.Millisecond)},
+		{TaskId: "t-3", CommandId: "c-1", Status: HistoryStatusFinished, EndTime: now.Add(-time.Hour).UnixNano() / int64(time.Millisecond)},
+		{TaskId: "t-3", CommandId: "c-1", Status: HistoryStatusTimeout, EndTime: now.UnixNano() / int64(time.Millisecond)},
+	}
+	for _, record := range records {
+		assert.NoError(t, writeHistoryRecord(record, 3))
+		// Files are named after time of recording in milliseconds
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.ErrorIs(t, writeHistoryRecord(HistoryRecord{TaskId: "../t-4"}, 3), ErrInvalidTaskIdForHistory)
+	assert.ErrorIs(t, writeHistoryRecord(HistoryRecord{TaskId: ".."}, 3), ErrInvalidTaskIdForHistory)
+
+	// The oldest record has been removed
+	listed, err := ListHistory(HistoryFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 3)
+	assert.Equal(t, HistoryStatusTimeout, listed[0].Status)
+	assert.Equal(t, "t-2", listed[2].TaskId)
+
+	listed, err = ListHistory(HistoryFilter{CommandId: "c-1"})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 2)
+
+	listed, err = ListHistory(HistoryFilter{Status: HistoryStatusFinished})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, "t-3", listed[0].TaskId)
+
+	listed, err = ListHistory(HistoryFilter{Since: now.Add(-90 * time.Minute), Until: now.Add(-30 * time.Minute)})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, HistoryStatusFinished, listed[0].Status)
+
+	listed, err = ListHistory(HistoryFilter{Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+
+	record, err := GetHistory("t-3")
+	assert.NoError(t, err)
+	assert.Equal(t, HistoryStatusTimeout, record.Status)
+	assert.Contains(t, record.Detail(), "Status:            timeout")
+	_, err = GetHistory("t-1")
+	assert.ErrorIs(t, err, ErrHistoryRecordNotFound)
+}
@@ -0,0 +1,166 @@
+package taskengine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+)
+
+const (
+	interpreterConfigFilename = "task_interpreters.json"
+
+	// Placeholder in argument template of interpreter replaced by path of
+	// script file
+	interpreterScriptPlaceholder = "{{script}}"
+
+	// Command type whose interpreter is specified by name in registry
+	commandTypeInterpreterScript = "RunInterpreterScript"
+)
+
+var (
+	ErrInterpreterNotSpecified = errors.New("Interpreter is not specified")
+	ErrInterpreterNotFound     = errors.New("Interpreter is not found in registry")
+	ErrUnknownCommandType      = errors.New("Unknown command type")
+
+	// Command types of well-known scripts mapped to interpreters in registry
+	commandTypeInterpreters = map[string]string{
+		"RunPythonScript": "python",
+	}
+)
+
+// Interpreter describes how script of invocation is run by interpreter
+type Interpreter struct {
+	// Extension of script file, e.g., ".py"
+	Extension string `json:"extension"`
+	// Path or name in $PATH of interpreter executable
+	Path string `json:"path"`
+	// Argument template passed to interpreter. Script path is appended when
+	// no {{script}} placeholder is in template.
+	Args []string `json:"args"`
+	// Additional environment variables for interpreter
+	Env map[string]string `json:"env"`
+	// Argument template to check syntax of script without executing it, and
+	// syntax check is skipped if empty
+	SyntaxCheckArgs []string `json:"syntaxCheckArgs"`
+}
+
+type interpreterRegistryConfig struct {
+	Interpreters map[string]Interpreter `json:"interpreters"`
+}
+
+func builtinInterpreters() map[string]Interpreter {
+	pythonPath := "python3"
+	if G_IsWindows {
+		pythonPath = "python"
+	}
+	return map[string]Interpreter{
+		"python": {
+			Extension: ".py",
+			Path:      pythonPath,
+			Args:      []string{interpreterScriptPlaceholder},
+
+			SyntaxCheckArgs: pythonSyntaxCheckArgs,
+		},
+	}
+}
+
+// loadInterpreterRegistry returns built-in interpreters overridden and
+// extended by task_interpreters.json in config directory, thus new
+// interpreters could be registered without rebuilding agent
+func loadInterpreterRegistry() map[string]Interpreter {
+	registry := builtinInterpreters()
+
+	config := interpreterRegistryConfig{}
+	if _, err := loadTaskConfigFile(interpreterConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, only built-in interpreters are available", interpreterConfigFilename)
+		return registry
+	}
+	for name, interpreter := range config.Interpreters {
+		if interpreter.Path == "" {
+			log.GetLogger().Warningf("Ignored interpreter %s without path in %s", name, interpreterConfigFilename)
+			continue
+		}
+		registry[name] = interpreter
+	}
+	return registry
+}
+
+// lookupInterpreter returns interpreter for command types other than built-in
+// shell, batch and PowerShell scripts
+func lookupInterpreter(taskInfo RunTaskInfo) (*Interpreter, error) {
+	var name string
+	if mappedName, ok := commandTypeInterpreters[taskInfo.CommandType]; ok {
+		name = mappedName
+	} else if taskInfo.CommandType == commandTypeInterpreterScript {
+		if taskInfo.Interpreter == "" {
+			return nil, ErrInterpreterNotSpecified
+		}
+		name = taskInfo.Interpreter
+	} else {
+		return nil, ErrUnknownCommandType
+	}
+
+	interpreter, ok := loadInterpreterRegistry()[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInterpreterNotFound, name)
+	}
+	return &interpreter, nil
+}
+
+// command returns interpreter executable and arguments to run script
+func (i *Interpreter) command(scriptPath string) (string, []string) {
+	args := make([]string, 0, len(i.Args)+1)
+	hasPlaceholder := false
+	for _, arg := range i.Args {
+		if strings.Contains(arg, interpreterScriptPlaceholder) {
+			hasPlaceholder = true
+			arg = strings.ReplaceAll(arg, interpreterScriptPlaceholder, scriptPath)
+		}
+		args = append(args, arg)
+	}
+	if !hasPlaceholder {
+		args = append(args, scriptPath)
+	}
+	return i.Path, args
+}
+
+// environ returns additional environment variables in "key=value" form
+func (i *Interpreter) environ() []string {
+	env := make([]string, 0, len(i.Env))
+	for key, value := range i.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// parseShebang extracts interpreter and optional argument from the "#!" line
+// of script content. Like the kernel, everything after interpreter path is
+// passed as a single argument.
+func parseShebang(content string) (string, []string, bool) {
+	if !strings.HasPrefix(content, "#!") {
+		return "", nil, false
+	}
+	line := content[2:]
+	if idx := strings.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+	}
+	line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+	if line == "" {
+		return "", nil, false
+	}
+
+	idx := strings.IndexAny(line, " \t")
+	if idx < 0 {
+		return line, nil, true
+	}
+	interpreterPath := line[:idx]
+	argument := strings.TrimSpace(line[idx:])
+	if argument == "" {
+		return interpreterPath, nil, true
+	}
+	return interpreterPath, []string{argument}, true
+}
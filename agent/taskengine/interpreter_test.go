@@ -0,0 +1,110 @@
+package taskengine
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/taskengine/parameters"
+	"github.com/aliyun/aliyun_assist_client/agent/taskengine/scriptmanager"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+func TestParseShebang(t *testing.T) {
+	tests := []struct {
+		content     string
+		interpreter string
+		args        []string
+		ok          bool
+	}{
+		{"#!/bin/bash\necho hello", "/bin/bash", nil, true},
+		{"#! /usr/bin/env python3 \r\nprint(1)", "/usr/bin/env", []string{"python3"}, true},
+		{"#!/bin/sh -e -x\n", "/bin/sh", []string{"-e -x"}, true},
+		{"#!\necho hello", "", nil, false},
+		{"echo hello", "", nil, false},
+	}
+	for _, tt := range tests {
+		interpreter, args, ok := parseShebang(tt.content)
+		assert.Equal(t, tt.ok, ok, tt.content)
+		assert.Equal(t, tt.interpreter, interpreter, tt.content)
+		assert.Equal(t, tt.args, args, tt.content)
+	}
+}
+
+func TestInterpreterCommand(t *testing.T) {
+	interpreter := Interpreter{
+		Path: "ruby",
+		Args: []string{"-W0", "{{script}}", "--verbose"},
+		Env: map[string]string{
+			"RUBYOPT": "-Ku",
+			"LANG":    "C.UTF-8",
+		},
+	}
+	path, args := interpreter.command("/tmp/t-1.rb")
+	assert.Equal(t, "ruby", path)
+	assert.Equal(t, []string{"-W0", "/tmp/t-1.rb", "--verbose"}, args)
+	assert.Equal(t, []string{"LANG=C.UTF-8", "RUBYOPT=-Ku"}, interpreter.environ())
+
+	interpreter.Args = []string{"-u"}
+	_, args = interpreter.command("/tmp/t-1.rb")
+	assert.Equal(t, []string{"-u", "/tmp/t-1.rb"}, args)
+}
+
+func TestLookupInterpreter(t *testing.T) {
+	interpreter, err := lookupInterpreter(RunTaskInfo{CommandType: "RunPythonScript"})
+	assert.NoError(t, err)
+	assert.Equal(t, ".py", interpreter.Extension)
+
+	_, err = lookupInterpreter(RunTaskInfo{CommandType: commandTypeInterpreterScript})
+	assert.Equal(t, ErrInterpreterNotSpecified, err)
+
+	_, err = lookupInterpreter(RunTaskInfo{CommandType: commandTypeInterpreterScript, Interpreter: "not-registered"})
+	assert.True(t, errors.Is(err, ErrInterpreterNotFound))
+
+	_, err = lookupInterpreter(RunTaskInfo{CommandType: "RunUnknownScript"})
+	assert.Equal(t, ErrUnknownCommandType, err)
+}
+
+func TestRunTaskRemovesScriptWhenInterpreterNotFound(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shebang line is only honored on *nix")
+	}
+	defer setupTaskFileDirs(t)()
+	guardHttpPost := monkey.Patch(util.HttpPost, func(string, string, string) (string, error) { return "", nil })
+	defer guardHttpPost.Unpatch()
+	var resolvers *parameters.SecretResolvers
+	guardResolve := monkey.PatchInstanceMethod(reflect.TypeOf(resolvers), "Resolve", func(_ *parameters.SecretResolvers, content string) (string, []string, error) {
+		return strings.Replace(content, "{{oos-secret:token}}", "s3cr3t", -1), []string{"s3cr3t"}, nil
+	})
+	defer guardResolve.Unpatch()
+	var savedScript string
+	guardSave := monkey.Patch(scriptmanager.SaveScriptFile, func(name string, content string) error {
+		savedScript = name
+		return ioutil.WriteFile(name, []byte(content), 0600)
+	})
+	defer guardSave.Unpatch()
+
+	// Script containing resolved secret is never left behind
+	taskInfo := RunTaskInfo{
+		InstanceId:      "i-test",
+		CommandType:     "RunShellScript",
+		TaskId:          "t-interpreter-not-found",
+		TimeOut:         "60",
+		WorkingDir:      "/tmp",
+		EnableParameter: true,
+		Content:         base64.StdEncoding.EncodeToString([]byte("#!/nonexistent/interpreter\necho {{oos-secret:token}}")),
+	}
+	_, err := NewTask(taskInfo, nil, nil).Run()
+	assert.Error(t, err)
+	assert.NotEmpty(t, savedScript)
+	_, err = os.Stat(savedScript)
+	assert.True(t, os.IsNotExist(err))
+}
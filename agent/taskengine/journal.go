@@ -0,0 +1,316 @@
+package taskengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+// TaskJournalState represents lifecycle state of invocation recorded in
+// on-disk task journal
+type TaskJournalState string
+
+const (
+	TaskJournalPending   TaskJournalState = "Pending"
+	TaskJournalRunning   TaskJournalState = "Running"
+	TaskJournalReporting TaskJournalState = "Reporting"
+
+	taskJournalDirName = "task_journal"
+	taskJournalFileExt = ".json"
+)
+
+var (
+	ErrInvalidTaskIdForJournal = errors.New("Invalid task id for journal")
+
+	_taskJournalLock sync.Mutex
+)
+
+type TaskJournalTransition struct {
+	State TaskJournalState `json:"state"`
+	Time  int64            `json:"time"`
+}
+
+type TaskJournalReport struct {
+	Service     string `json:"service"`
+	QueryString string `json:"queryString"`
+	Output      string `json:"output"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// TaskJournalEntry records an invocation from being fetched to its final
+// result being delivered, thus results survive restarting of agent
+type TaskJournalEntry struct {
+	TaskInfo       RunTaskInfo             `json:"taskInfo"`
+	State          TaskJournalState        `json:"state"`
+	Transitions    []TaskJournalTransition `json:"transitions"`
+	StartTimestamp int64                   `json:"startTimestamp"`
+	ExitCode       int                     `json:"exitCode"`
+	Report         *TaskJournalReport      `json:"report,omitempty"`
+}
+
+func getTaskJournalDir() (string, error) {
+	cacheDir, err := util.GetCachePath()
+	if err != nil {
+		return "", err
+	}
+	journalDir := filepath.Join(cacheDir, taskJournalDirName)
+	if err := util.MakeSurePath(journalDir); err != nil {
+		return "", err
+	}
+	return journalDir, nil
+}
+
+func taskJournalFilePath(taskId string) (string, error) {
+	name, ok := taskIdFileName(taskId)
+	if !ok {
+		return "", ErrInvalidTaskIdForJournal
+	}
+	journalDir, err := getTaskJournalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(journalDir, name+taskJournalFileExt), nil
+}
+
+// undeliveredJournalFilePath names journal file of previous run whose final
+// report has not been delivered, which is still replayed at startup
+func undeliveredJournalFilePath(path string) string {
+	return fmt.Sprintf("%s-undelivered-%d%s", strings.TrimSuffix(path, taskJournalFileExt),
+		time.Now().UnixNano(), taskJournalFileExt)
+}
+
+func readTaskJournalEntry(path string) (*TaskJournalEntry, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry := &TaskJournalEntry{}
+	if err := json.Unmarshal(content, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// writeTaskJournalEntry writes entry into temporary file and renames it to
+// destination, thus journal file would never be partially written
+func writeTaskJournalEntry(path string, entry *TaskJournalEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// journalTransit records new lifecycle state of invocation, and creates the
+// journal entry named by task id, or name of parallel run of periodic task,
+// when not existed
+func journalTransit(name string, taskInfo RunTaskInfo, state TaskJournalState, startTimestamp int64) error {
+	path, err := taskJournalFilePath(name)
+	if err != nil {
+		return err
+	}
+
+	_taskJournalLock.Lock()
+	defer _taskJournalLock.Unlock()
+	entry, err := readTaskJournalEntry(path)
+	if err != nil {
+		entry = &TaskJournalEntry{}
+	} else if entry.State == TaskJournalReporting && entry.Report != nil {
+		// Final report of previous run of periodic task has not been
+		// delivered, which is kept aside by its own name for replaying
+		// instead of being overwritten by new run
+		if err := os.Rename(path, undeliveredJournalFilePath(path)); err != nil {
+			return err
+		}
+		entry = &TaskJournalEntry{}
+	}
+	entry.TaskInfo = taskInfo
+	entry.State = state
+	entry.Transitions = append(entry.Transitions, TaskJournalTransition{
+		State: state,
+		Time:  time.Now().Unix(),
+	})
+	if startTimestamp != 0 {
+		entry.StartTimestamp = startTimestamp
+	}
+	entry.Report = nil
+	return writeTaskJournalEntry(path, entry)
+}
+
+// journalRecordReport records final report of invocation before sending it.
+// Invocations not recorded in journal, e.g., testing tasks, are ignored.
+func journalRecordReport(taskId string, exitCode int, report *TaskJournalReport) (bool, error) {
+	path, err := taskJournalFilePath(taskId)
+	if err != nil {
+		return false, err
+	}
+
+	_taskJournalLock.Lock()
+	defer _taskJournalLock.Unlock()
+	entry, err := readTaskJournalEntry(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	entry.State = TaskJournalReporting
+	entry.Transitions = append(entry.Transitions, TaskJournalTransition{
+		State: TaskJournalReporting,
+		Time:  time.Now().Unix(),
+	})
+	entry.ExitCode = exitCode
+	entry.Report = report
+	return true, writeTaskJournalEntry(path, entry)
+}
+
+func journalRemove(taskId string) error {
+	path, err := taskJournalFilePath(taskId)
+	if err != nil {
+		return err
+	}
+
+	_taskJournalLock.Lock()
+	defer _taskJournalLock.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// journalRemoveIfDelivered removes journal entry of invocation unless its
+// final report has not been delivered yet
+func journalRemoveIfDelivered(taskId string) error {
+	path, err := taskJournalFilePath(taskId)
+	if err != nil {
+		return err
+	}
+
+	_taskJournalLock.Lock()
+	defer _taskJournalLock.Unlock()
+	entry, err := readTaskJournalEntry(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return os.Remove(path)
+	}
+	if entry.State == TaskJournalReporting {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func interruptedTaskReport(entry *TaskJournalEntry) *TaskJournalReport {
+	errDesc := fmt.Sprintf("%s: Invocation was interrupted in %s state by restarting of agent",
+		presetErrorPrefixes[wrapErrInterruptedByAgentRestart], entry.State)
+	queryString := fmt.Sprintf("?taskId=%s&start=%d&end=%d&exitCode=%d&dropped=%d&errCode=%d&errDesc=%s",
+		entry.TaskInfo.TaskId, entry.StartTimestamp, 0, 0, 0,
+		wrapErrInterruptedByAgentRestart, url.QueryEscape(errDesc))
+	return &TaskJournalReport{
+		Service:     reportServiceError,
+		QueryString: queryString,
+		Output:      "",
+	}
+}
+
+// ReplayTaskJournal re-delivers final results not sent before agent exited,
+// and reports invocations interrupted by crash or restart of agent as failed.
+// It SHOULD be called at startup before any task is fetched.
+func ReplayTaskJournal() {
+	replayLogger := log.GetLogger().WithFields(logrus.Fields{
+		"Phase": "ReplayingJournal",
+	})
+
+	journalDir, err := getTaskJournalDir()
+	if err != nil {
+		replayLogger.WithError(err).Errorln("Failed to get directory of task journal")
+		return
+	}
+	journalFiles, err := filepath.Glob(filepath.Join(journalDir, "*"+taskJournalFileExt))
+	if err != nil {
+		replayLogger.WithError(err).Errorln("Failed to list task journal files")
+		return
+	}
+
+	for _, journalFile := range journalFiles {
+		entry, err := readTaskJournalEntry(journalFile)
+		if err != nil {
+			replayLogger.WithField("file", journalFile).WithError(err).Errorln("Discard corrupted task journal file")
+			os.Remove(journalFile)
+			continue
+		}
+
+		entryLogger := replayLogger.WithFields(logrus.Fields{
+			"TaskId": entry.TaskInfo.TaskId,
+			"state":  entry.State,
+		})
+		report := entry.Report
+		if entry.State != TaskJournalReporting || report == nil {
+			report = interruptedTaskReport(entry)
+		}
+		response, err := postTaskReport(report.Service, report.QueryString, report.Output, report.ContentType)
+		if err != nil {
+			entryLogger.WithError(err).Errorln("Failed to deliver journaled report, keep it for next startup")
+			continue
+		}
+		entryLogger.WithFields(logrus.Fields{
+			"service":  report.Service,
+			"response": response,
+		}).Infoln("Delivered journaled report")
+
+		_taskJournalLock.Lock()
+		os.Remove(journalFile)
+		_taskJournalLock.Unlock()
+	}
+}
+
+// sendFinalReport records final report into journal before sending it, and
+// removes journal entry once it has been delivered
+func (task *Task) sendFinalReport(service string, querystring string, output string, contentType string) (string, error) {
+	taskLogger := log.GetLogger().WithFields(logrus.Fields{
+		"TaskId": task.taskInfo.TaskId,
+		"Phase":  "Reporting",
+	})
+
+	journaled, err := journalRecordReport(task.runKey(), task.exit_code, &TaskJournalReport{
+		Service:     service,
+		QueryString: querystring,
+		Output:      output,
+		ContentType: contentType,
+	})
+	if err != nil {
+		taskLogger.WithError(err).Warningln("Failed to record final report in task journal")
+	}
+
+	response, err := postTaskReport(service, querystring, output, contentType)
+	if err != nil {
+		taskLogger.WithFields(logrus.Fields{
+			"journaled": journaled,
+		}).WithError(err).Errorln("Failed to send final report")
+		return response, err
+	}
+	if journaled {
+		if err := journalRemove(task.runKey()); err != nil {
+			taskLogger.WithError(err).Warningln("Failed to remove entry from task journal")
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,147 @@
+package taskengine
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalLifecycle(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	journalDir, err := getTaskJournalDir()
+	assert.NoError(t, err)
+
+	taskInfo := RunTaskInfo{
+		TaskId:      "t-journal",
+		CommandType: "RunShellScript",
+	}
+	journalFile := filepath.Join(journalDir, "t-journal.json")
+
+	assert.NoError(t, journalTransit(taskInfo.TaskId, taskInfo, TaskJournalPending, 0))
+	assert.NoError(t, journalTransit(taskInfo.TaskId, taskInfo, TaskJournalRunning, 1000))
+	entry, err := readTaskJournalEntry(journalFile)
+	assert.NoError(t, err)
+	assert.Equal(t, TaskJournalRunning, entry.State)
+	assert.Equal(t, int64(1000), entry.StartTimestamp)
+	assert.Equal(t, 2, len(entry.Transitions))
+	assert.Equal(t, "RunShellScript", entry.TaskInfo.CommandType)
+
+	journaled, err := journalRecordReport("t-journal", 3, &TaskJournalReport{
+		Service:     reportServiceFinish,
+		QueryString: "?taskId=t-journal",
+		Output:      "output",
+	})
+	assert.NoError(t, err)
+	assert.True(t, journaled)
+	entry, err = readTaskJournalEntry(journalFile)
+	assert.NoError(t, err)
+	assert.Equal(t, TaskJournalReporting, entry.State)
+	assert.Equal(t, 3, entry.ExitCode)
+	assert.Equal(t, "output", entry.Report.Output)
+
+	// Undelivered report must be kept
+	assert.NoError(t, journalRemoveIfDelivered("t-journal"))
+	assert.FileExists(t, journalFile)
+
+	assert.NoError(t, journalRemove("t-journal"))
+	assert.NoFileExists(t, journalFile)
+
+	// Report of task not recorded in journal is ignored
+	journaled, err = journalRecordReport("t-journal", 0, &TaskJournalReport{})
+	assert.NoError(t, err)
+	assert.False(t, journaled)
+	assert.NoFileExists(t, journalFile)
+
+	assert.Equal(t, ErrInvalidTaskIdForJournal, journalTransit("../t-journal", RunTaskInfo{TaskId: "../t-journal"}, TaskJournalPending, 0))
+}
+
+func TestJournalKeepsUndeliveredReportOfPreviousRun(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	journalDir, err := getTaskJournalDir()
+	assert.NoError(t, err)
+
+	taskInfo := RunTaskInfo{
+		TaskId: "t-periodic",
+		Repeat: RunTaskRate,
+	}
+	assert.NoError(t, journalTransit(taskInfo.TaskId, taskInfo, TaskJournalRunning, 1000))
+	_, err = journalRecordReport("t-periodic", 0, &TaskJournalReport{
+		Service:     reportServiceFinish,
+		QueryString: "?taskId=t-periodic&start=1000",
+		Output:      "first run",
+	})
+	assert.NoError(t, err)
+
+	// Next run starts before final report of previous run is delivered
+	assert.NoError(t, journalTransit(taskInfo.TaskId, taskInfo, TaskJournalPending, 0))
+	entry, err := readTaskJournalEntry(filepath.Join(journalDir, "t-periodic.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, TaskJournalPending, entry.State)
+	assert.Nil(t, entry.Report)
+	assert.Equal(t, 1, len(entry.Transitions))
+
+	delivered := []string{}
+	guard := monkey.Patch(postTaskReport, func(service string, querystring string, output string, contentType string) (string, error) {
+		delivered = append(delivered, output)
+		return "", nil
+	})
+	defer guard.Unpatch()
+	ReplayTaskJournal()
+	assert.Contains(t, delivered, "first run")
+	assert.Equal(t, 2, len(delivered))
+	journalFiles, err := filepath.Glob(filepath.Join(journalDir, "*"+taskJournalFileExt))
+	assert.NoError(t, err)
+	assert.Empty(t, journalFiles)
+}
+
+func TestReplayTaskJournal(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	journalDir, err := getTaskJournalDir()
+	assert.NoError(t, err)
+
+	assert.NoError(t, journalTransit("t-running", RunTaskInfo{TaskId: "t-running"}, TaskJournalRunning, 1000))
+	assert.NoError(t, journalTransit("t-reporting", RunTaskInfo{TaskId: "t-reporting"}, TaskJournalRunning, 2000))
+	_, err = journalRecordReport("t-reporting", 0, &TaskJournalReport{
+		Service:     reportServiceFinish,
+		QueryString: "?taskId=t-reporting",
+		Output:      "finished output",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, journalTransit("t-undeliverable", RunTaskInfo{TaskId: "t-undeliverable"}, TaskJournalPending, 0))
+
+	delivered := map[string]*TaskJournalReport{}
+	guard := monkey.Patch(postTaskReport, func(service string, querystring string, output string, contentType string) (string, error) {
+		if strings.Contains(querystring, "t-undeliverable") {
+			return "", errors.New("network unreachable")
+		}
+		delivered[service+querystring] = &TaskJournalReport{
+			Service:     service,
+			QueryString: querystring,
+			Output:      output,
+		}
+		return "", nil
+	})
+	defer guard.Unpatch()
+	ReplayTaskJournal()
+
+	assert.Equal(t, 2, len(delivered))
+	finished, ok := delivered[reportServiceFinish+"?taskId=t-reporting"]
+	assert.True(t, ok)
+	assert.Equal(t, "finished output", finished.Output)
+	for _, report := range delivered {
+		if report.Service == reportServiceError {
+			assert.Contains(t, report.QueryString, "taskId=t-running&start=1000")
+			assert.Contains(t, report.QueryString, fmt.Sprintf("errCode=%d", wrapErrInterruptedByAgentRestart))
+			assert.Contains(t, report.QueryString, "InterruptedByAgentRestart")
+		}
+	}
+
+	assert.NoFileExists(t, filepath.Join(journalDir, "t-running.json"))
+	assert.NoFileExists(t, filepath.Join(journalDir, "t-reporting.json"))
+	assert.FileExists(t, filepath.Join(journalDir, "t-undeliverable.json"))
+}
@@ -0,0 +1,186 @@
+package taskengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	// Runs missed during downtime are skipped, which is the default behavior
+	MisfirePolicySkip = "skip"
+	// Only one run is made up no matter how many runs were missed
+	MisfirePolicyRunOnce = "runOnce"
+	// Every missed run is made up one after another, up to maxRuns runs
+	MisfirePolicyRunAll = "runAll"
+
+	defaultMaxMisfireRuns = 10
+	maxMisfireRunsLimit   = 100
+
+	periodicLastRunDirName = "periodic_last_run"
+	periodicLastRunFileExt = ".json"
+)
+
+var (
+	ErrInvalidTaskIdForLastRun = errors.New("Invalid task id for last run record")
+
+	_periodicLastRunLock sync.Mutex
+)
+
+// MisfirePolicyInfo specifies how runs of periodic task missed while agent or
+// instance was down are handled after the task is scheduled again
+type MisfirePolicyInfo struct {
+	Policy string `json:"policy"`
+	// Maximum number of runs made up by runAll policy
+	MaxRuns int `json:"maxRuns"`
+}
+
+// periodicLastRunRecord persists when periodic task was triggered last time,
+// thus missed runs could be found after restarting agent
+type periodicLastRunRecord struct {
+	LastRunTime int64 `json:"lastRunTime"`
+}
+
+// misfireSchedule is implemented by schedules of cron and rate tasks
+type misfireSchedule interface {
+	ScheduledTimesBetween(from time.Time, to time.Time, limit int) []time.Time
+}
+
+func getPeriodicLastRunDir() (string, error) {
+	cacheDir, err := util.GetCachePath()
+	if err != nil {
+		return "", err
+	}
+	lastRunDir := filepath.Join(cacheDir, periodicLastRunDirName)
+	if err := util.MakeSurePath(lastRunDir); err != nil {
+		return "", err
+	}
+	return lastRunDir, nil
+}
+
+func periodicLastRunFilePath(taskId string) (string, error) {
+	name, ok := taskIdFileName(taskId)
+	if !ok {
+		return "", ErrInvalidTaskIdForLastRun
+	}
+	lastRunDir, err := getPeriodicLastRunDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(lastRunDir, name+periodicLastRunFileExt), nil
+}
+
+// readPeriodicLastRun returns false without error when periodic task has never
+// been recorded
+func readPeriodicLastRun(taskId string) (time.Time, bool, error) {
+	path, err := periodicLastRunFilePath(taskId)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	_periodicLastRunLock.Lock()
+	defer _periodicLastRunLock.Unlock()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+	record := periodicLastRunRecord{}
+	if err := json.Unmarshal(content, &record); err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(0, record.LastRunTime*int64(time.Millisecond)), true, nil
+}
+
+// writePeriodicLastRun writes record into temporary file and renames it to
+// destination, thus record file would never be partially written
+func writePeriodicLastRun(taskId string, lastRunTime time.Time) error {
+	path, err := periodicLastRunFilePath(taskId)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(periodicLastRunRecord{
+		LastRunTime: lastRunTime.UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+
+	_periodicLastRunLock.Lock()
+	defer _periodicLastRunLock.Unlock()
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func removePeriodicLastRun(taskId string) error {
+	path, err := periodicLastRunFilePath(taskId)
+	if err != nil {
+		return err
+	}
+
+	_periodicLastRunLock.Lock()
+	defer _periodicLastRunLock.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// validateMisfirePolicy checks policy before periodic task is scheduled
+func validateMisfirePolicy(misfire MisfirePolicyInfo) error {
+	switch misfire.Policy {
+	case "", MisfirePolicySkip, MisfirePolicyRunOnce, MisfirePolicyRunAll:
+		return nil
+	default:
+		return fmt.Errorf("Unknown misfire policy %s", misfire.Policy)
+	}
+}
+
+// misfireRunsToMakeUp returns how many missed runs should be made up under
+// the policy
+func misfireRunsToMakeUp(misfire MisfirePolicyInfo, missedRuns int) int {
+	if missedRuns <= 0 {
+		return 0
+	}
+	switch misfire.Policy {
+	case MisfirePolicyRunOnce:
+		return 1
+	case MisfirePolicyRunAll:
+		maxRuns := misfire.MaxRuns
+		if maxRuns <= 0 {
+			maxRuns = defaultMaxMisfireRuns
+		}
+		if maxRuns > maxMisfireRunsLimit {
+			maxRuns = maxMisfireRunsLimit
+		}
+		if missedRuns > maxRuns {
+			return maxRuns
+		}
+		return missedRuns
+	default:
+		return 0
+	}
+}
+
+// findMissedRuns returns scheduled times between last run and now. At most
+// maxMisfireRunsLimit+1 times are returned, which is enough to tell whether
+// more runs were missed than could be made up.
+func findMissedRuns(schedule misfireSchedule, lastRunTime time.Time, now time.Time) []time.Time {
+	if !lastRunTime.Before(now) {
+		return nil
+	}
+	return schedule.ScheduledTimesBetween(lastRunTime, now, maxMisfireRunsLimit+1)
+}
@@ -0,0 +1,84 @@
+package taskengine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/taskengine/timermanager"
+)
+
+func TestPeriodicLastRunRecord(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+
+	_, recorded, err := readPeriodicLastRun("t-misfire")
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+
+	lastRunTime := time.Unix(1600000000, 123*int64(time.Millisecond))
+	assert.NoError(t, writePeriodicLastRun("t-misfire", lastRunTime))
+	readTime, recorded, err := readPeriodicLastRun("t-misfire")
+	assert.NoError(t, err)
+	assert.True(t, recorded)
+	assert.True(t, lastRunTime.Equal(readTime))
+
+	assert.NoError(t, removePeriodicLastRun("t-misfire"))
+	_, recorded, err = readPeriodicLastRun("t-misfire")
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+	assert.NoError(t, removePeriodicLastRun("t-misfire"))
+
+	_, _, err = readPeriodicLastRun("../t-misfire")
+	assert.ErrorIs(t, err, ErrInvalidTaskIdForLastRun)
+}
+
+func TestFindMissedRuns(t *testing.T) {
+	lastRunTime := time.Date(2021, 3, 1, 1, 30, 0, 0, time.UTC)
+	now := time.Date(2021, 3, 4, 1, 30, 0, 0, time.UTC)
+
+	// Nightly task at 02:00 missed on March 1, 2 and 3
+	cronScheduled, err := timermanager.NewCronScheduled("0 0 2 * * ? * UTC")
+	assert.NoError(t, err)
+	missedRuns := findMissedRuns(cronScheduled, lastRunTime, now)
+	assert.Equal(t, []time.Time{
+		time.Date(2021, 3, 1, 2, 0, 0, 0, time.UTC),
+		time.Date(2021, 3, 2, 2, 0, 0, 0, time.UTC),
+		time.Date(2021, 3, 3, 2, 0, 0, 0, time.UTC),
+	}, missedRuns)
+
+	rateScheduled, err := timermanager.NewRateScheduled("rate(1d)", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	missedRuns = findMissedRuns(rateScheduled, lastRunTime, now)
+	assert.Len(t, missedRuns, 3)
+	assert.True(t, missedRuns[0].Equal(time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)))
+
+	// Number of missed runs is bounded
+	everySecond, err := timermanager.NewRateScheduled("rate(1s)", lastRunTime)
+	assert.NoError(t, err)
+	assert.Len(t, findMissedRuns(everySecond, lastRunTime, now), maxMisfireRunsLimit+1)
+
+	assert.Empty(t, findMissedRuns(cronScheduled, now, lastRunTime))
+}
+
+func TestMisfireRunsToMakeUp(t *testing.T) {
+	assert.Equal(t, 0, misfireRunsToMakeUp(MisfirePolicyInfo{}, 3))
+	assert.Equal(t, 0, misfireRunsToMakeUp(MisfirePolicyInfo{Policy: MisfirePolicySkip}, 3))
+	assert.Equal(t, 1, misfireRunsToMakeUp(MisfirePolicyInfo{Policy: MisfirePolicyRunOnce}, 3))
+	assert.Equal(t, 0, misfireRunsToMakeUp(MisfirePolicyInfo{Policy: MisfirePolicyRunOnce}, 0))
+	assert.Equal(t, 3, misfireRunsToMakeUp(MisfirePolicyInfo{Policy: MisfirePolicyRunAll, MaxRuns: 5}, 3))
+	assert.Equal(t, 2, misfireRunsToMakeUp(MisfirePolicyInfo{Policy: MisfirePolicyRunAll, MaxRuns: 2}, 3))
+	assert.Equal(t, defaultMaxMisfireRuns, misfireRunsToMakeUp(MisfirePolicyInfo{Policy: MisfirePolicyRunAll}, 50))
+	assert.Equal(t, maxMisfireRunsLimit, misfireRunsToMakeUp(MisfirePolicyInfo{Policy: MisfirePolicyRunAll, MaxRuns: 1000}, 1000))
+
+	assert.NoError(t, validateMisfirePolicy(MisfirePolicyInfo{}))
+	assert.NoError(t, validateMisfirePolicy(MisfirePolicyInfo{Policy: MisfirePolicyRunAll}))
+	assert.Error(t, validateMisfirePolicy(MisfirePolicyInfo{Policy: "runTwice"}))
+}
+
+func TestTakePendingMisfireRun(t *testing.T) {
+	schedule := &PeriodicTaskSchedule{pendingMisfireRuns: 2}
+	assert.True(t, schedule.takePendingMisfireRun())
+	assert.True(t, schedule.takePendingMisfireRun())
+	assert.False(t, schedule.takePendingMisfireRun())
+}
@@ -0,0 +1,74 @@
+package taskengine
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util/langutil"
+)
+
+const (
+	defaultOutputCharset = "UTF-8"
+	// Charset of command output on Windows not in English
+	windowsOutputCharset = "GBK"
+
+	// Text content of sent file is converted into charset of system default
+	// locale
+	textEncodingLocale = "locale"
+)
+
+// outputCharset returns charset of command output on *nix, which is specified
+// for the task, or detected from locale in additional environment variables of
+// command process, then locale configured for login session of specified user,
+// then locale in environment of agent and finally default locale of system.
+// Output on Windows is in GBK unless system is in English, when nil is returned
+// and output is not converted.
+func (task *Task) outputCharset(env []string, logger logrus.FieldLogger) (encoding.Encoding, string) {
+	if G_IsWindows {
+		if langutil.GetDefaultLang() == 0x409 {
+			return nil, ""
+		}
+		charset, _ := langutil.LookupCharset(windowsOutputCharset)
+		return charset, windowsOutputCharset
+	}
+	name := task.taskInfo.OutputEncoding
+	if name == "" {
+		name = langutil.CharsetFromEnv(env)
+	}
+	if name == "" && task.taskInfo.Username != "" {
+		name = langutil.UserCharset(task.envHomeDir)
+	}
+	if name == "" {
+		name = langutil.CharsetFromEnv(os.Environ())
+	}
+	if name == "" {
+		name = langutil.SystemCharset()
+	}
+	if name == "" {
+		name = defaultOutputCharset
+	}
+	charset, err := langutil.LookupCharset(name)
+	if err != nil {
+		logger.WithError(err).Warningf("Unsupported charset of output, fallback to %s", defaultOutputCharset)
+		name = defaultOutputCharset
+		charset, _ = langutil.LookupCharset(name)
+	}
+	return charset, name
+}
+
+// sendFileCharset returns charset which text content of sent file is converted
+// into, or nil if no conversion is requested
+func sendFileCharset(textEncoding string) (encoding.Encoding, error) {
+	if textEncoding == "" {
+		return nil, nil
+	}
+	if textEncoding == textEncodingLocale {
+		textEncoding = langutil.SystemCharset()
+		if textEncoding == "" {
+			return nil, nil
+		}
+	}
+	return langutil.LookupCharset(textEncoding)
+}
@@ -0,0 +1,143 @@
+package taskengine
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+	"github.com/aliyun/aliyun_assist_client/agent/util/langutil"
+)
+
+func TestOutputCharset(t *testing.T) {
+	logger := log.GetLogger()
+
+	task := NewTask(RunTaskInfo{OutputEncoding: "gb18030"}, nil, nil)
+	charset, name := task.outputCharset(nil, logger)
+	assert.Equal(t, simplifiedchinese.GB18030, charset)
+	assert.Equal(t, "gb18030", name)
+
+	task = NewTask(RunTaskInfo{}, nil, nil)
+	charset, name = task.outputCharset([]string{"LC_ALL=zh_TW.Big5"}, logger)
+	assert.Equal(t, traditionalchinese.Big5, charset)
+	assert.Equal(t, "Big5", name)
+
+	// Unsupported charset in locale falls back to UTF-8
+	charset, name = task.outputCharset([]string{"LC_ALL=xx_XX.NO-SUCH-CHARSET"}, logger)
+	assert.True(t, langutil.IsUTF8(charset))
+	assert.Equal(t, defaultOutputCharset, name)
+
+	// Locale of specified user takes precedence over that of agent
+	home, err := ioutil.TempDir("", "home")
+	assert.NoError(t, err)
+	defer os.RemoveAll(home)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, ".pam_environment"), []byte("LANG DEFAULT=zh_CN.GB18030\n"), 0644))
+	task = NewTask(RunTaskInfo{Username: "someone"}, nil, nil)
+	task.envHomeDir = home
+	charset, name = task.outputCharset(nil, logger)
+	assert.Equal(t, simplifiedchinese.GB18030, charset)
+	assert.Equal(t, "GB18030", name)
+
+	// Additional environment variables of command process still win
+	charset, name = task.outputCharset([]string{"LC_ALL=zh_TW.Big5"}, logger)
+	assert.Equal(t, traditionalchinese.Big5, charset)
+	assert.Equal(t, "Big5", name)
+}
+
+func TestOutputCharsetOnWindows(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("language of Linux system is never reported as English")
+	}
+	G_IsWindows = true
+	defer func() {
+		G_IsWindows = false
+	}()
+
+	// Locale of process does not matter on Windows
+	task := NewTask(RunTaskInfo{}, nil, nil)
+	charset, name := task.outputCharset([]string{"LC_ALL=zh_TW.Big5"}, log.GetLogger())
+	assert.Equal(t, simplifiedchinese.GBK, charset)
+	assert.Equal(t, windowsOutputCharset, name)
+}
+
+func TestSendFileCharset(t *testing.T) {
+	charset, err := sendFileCharset("")
+	assert.NoError(t, err)
+	assert.Nil(t, charset)
+
+	charset, err = sendFileCharset("GBK")
+	assert.NoError(t, err)
+	assert.Equal(t, simplifiedchinese.GBK, charset)
+
+	_, err = sendFileCharset("no-such-charset")
+	assert.ErrorIs(t, err, langutil.ErrUnknownCharset)
+}
+
+func TestSendFileWithTextEncoding(t *testing.T) {
+	destination, err := ioutil.TempDir("", "sendfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(destination)
+
+	content := base64.StdEncoding.EncodeToString([]byte("配置=值\n"))
+	sendFileTask := SendFileTaskInfo{
+		Content:      content,
+		Destination:  destination,
+		Name:         "gbk.conf",
+		Signature:    util.ComputeStrMd5(content),
+		TaskID:       "t-sendfile-encoding",
+		TextEncoding: "GBK",
+	}
+	ret, err := sendFile(sendFileTask)
+	assert.NoError(t, err)
+	assert.Equal(t, ESuccess, ret)
+	written, err := ioutil.ReadFile(filepath.Join(destination, "gbk.conf"))
+	assert.NoError(t, err)
+	expected, _ := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("配置=值\n"))
+	assert.Equal(t, expected, written)
+
+	sendFileTask.Name = "invalid.conf"
+	sendFileTask.TextEncoding = "no-such-charset"
+	ret, _ = sendFile(sendFileTask)
+	assert.Equal(t, EInvalidTextEncoding, ret)
+	assert.False(t, util.FileExist(filepath.Join(destination, "invalid.conf")))
+}
+
+func TestRunTaskWithOutputEncoding(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shell script is only run on Linux in this test")
+	}
+	defer setupTaskFileDirs(t)()
+	var reportedOutput string
+	guard := monkey.Patch(postTaskReport, func(service string, querystring string, output string, contentType string) (string, error) {
+		reportedOutput = output
+		return "", nil
+	})
+	defer guard.Unpatch()
+	guardHttpPost := monkey.Patch(util.HttpPost, func(string, string, string) (string, error) { return "", nil })
+	defer guardHttpPost.Unpatch()
+
+	// "中文" encoded in GB18030 followed by invalid sequence
+	task := NewTask(RunTaskInfo{
+		InstanceId:     "i-test",
+		CommandType:    "RunShellScript",
+		TaskId:         fmt.Sprintf("t-charset%d", time.Now().UnixNano()),
+		TimeOut:        "60",
+		WorkingDir:     "/tmp",
+		Content:        base64.StdEncoding.EncodeToString([]byte(`printf '\326\320\316\304\n\377'`)),
+		OutputEncoding: "GB18030",
+	}, nil, nil)
+	_, err := task.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "中文\n�", reportedOutput)
+}
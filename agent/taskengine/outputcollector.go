@@ -0,0 +1,241 @@
+package taskengine
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util/timetool"
+)
+
+const (
+	outputStreamStdout = "stdout"
+	outputStreamStderr = "stderr"
+
+	// Querystring parameter declaring output in request body is separated
+	// into streams and encoded in JSON
+	outputFormatSeparated = "&outputFormat=json"
+)
+
+// outputChunk is a piece of output written by command process to a stream,
+// with the timestamp in milliseconds when agent received it
+type outputChunk struct {
+	stream string
+	Time   int64  `json:"time"`
+	Data   string `json:"data"`
+}
+
+// separatedOutput is the report body when separated streams are requested by
+// Output.SeparateStreams, and Output field is the merged view of both streams
+type separatedOutput struct {
+	Output string        `json:"output"`
+	Stdout []outputChunk `json:"stdout"`
+	Stderr []outputChunk `json:"stderr"`
+}
+
+// outputCollector collects stdout and stderr of command process separately in
+// the order of arrival. Unread output of each stream is bounded by capacity,
+// and the oldest bytes are discarded when exceeded.
+type outputCollector struct {
+	capacity   int
+	chunks     []outputChunk
+	pendingLen map[string]int
+	discarded  int64
+	mutex      sync.Mutex
+}
+
+type outputStreamWriter struct {
+	collector *outputCollector
+	stream    string
+}
+
+func newOutputCollector(capacity int) *outputCollector {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &outputCollector{
+		capacity:   capacity,
+		pendingLen: map[string]int{},
+	}
+}
+
+func (w *outputStreamWriter) Write(p []byte) (int, error) {
+	w.collector.write(w.stream, p)
+	return len(p), nil
+}
+
+// Writer returns io.Writer for specified stream
+func (c *outputCollector) Writer(stream string) io.Writer {
+	return &outputStreamWriter{
+		collector: c,
+		stream:    stream,
+	}
+}
+
+func (c *outputCollector) write(stream string, p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	now := timetool.GetAccurateTime()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// Continuous writes to the same stream within one millisecond are merged
+	// into one chunk
+	if last := len(c.chunks) - 1; last >= 0 && c.chunks[last].stream == stream && c.chunks[last].Time == now {
+		c.chunks[last].Data += string(p)
+	} else {
+		c.chunks = append(c.chunks, outputChunk{
+			stream: stream,
+			Time:   now,
+			Data:   string(p),
+		})
+	}
+	c.pendingLen[stream] += len(p)
+
+	// Discard the oldest output of the stream exceeding capacity
+	for i := 0; c.pendingLen[stream] > c.capacity && i < len(c.chunks); {
+		if c.chunks[i].stream != stream {
+			i++
+			continue
+		}
+		// Character split by the exceeded length is discarded as a whole
+		cut := runeBoundaryAfter(c.chunks[i].Data, c.pendingLen[stream]-c.capacity)
+		if cut < len(c.chunks[i].Data) {
+			c.chunks[i].Data = c.chunks[i].Data[cut:]
+			c.pendingLen[stream] -= cut
+			c.discarded += int64(cut)
+			break
+		}
+		c.pendingLen[stream] -= len(c.chunks[i].Data)
+		c.discarded += int64(len(c.chunks[i].Data))
+		c.chunks = append(c.chunks[:i], c.chunks[i+1:]...)
+	}
+}
+
+// Read consumes at most max bytes of unread chunks in order of arrival, without
+// splitting any character. All unread chunks are consumed when max is not
+// positive.
+func (c *outputCollector) Read(max int) []outputChunk {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var consumed []outputChunk
+	read := 0
+	for len(c.chunks) > 0 && (max <= 0 || read < max) {
+		chunk := c.chunks[0]
+		cut := len(chunk.Data)
+		if max > 0 && read+len(chunk.Data) > max {
+			cut = runeBoundaryBefore(chunk.Data, max-read)
+			if cut == 0 {
+				if read > 0 {
+					break
+				}
+				// Character longer than max is read as a whole
+				cut = runeBoundaryAfter(chunk.Data, max)
+			}
+		}
+		if cut < len(chunk.Data) {
+			partial := chunk
+			partial.Data = chunk.Data[:cut]
+			c.chunks[0].Data = chunk.Data[cut:]
+			chunk = partial
+		} else {
+			c.chunks = c.chunks[1:]
+		}
+		read += len(chunk.Data)
+		c.pendingLen[chunk.stream] -= len(chunk.Data)
+		consumed = append(consumed, chunk)
+	}
+	return consumed
+}
+
+// Discarded returns the number of bytes discarded before being read
+func (c *outputCollector) Discarded() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.discarded
+}
+
+func outputChunksLen(chunks []outputChunk) int {
+	length := 0
+	for _, chunk := range chunks {
+		length += len(chunk.Data)
+	}
+	return length
+}
+
+// mergeOutputChunks returns the merged view of chunks from both streams
+func mergeOutputChunks(chunks []outputChunk) string {
+	var builder strings.Builder
+	for _, chunk := range chunks {
+		builder.WriteString(chunk.Data)
+	}
+	return builder.String()
+}
+
+// trimOutputChunks drops the first n bytes of chunks, plus the rest of
+// character split at the n-th byte
+func trimOutputChunks(chunks []outputChunk, n int) []outputChunk {
+	for len(chunks) > 0 && n > 0 {
+		if cut := runeBoundaryAfter(chunks[0].Data, n); cut < len(chunks[0].Data) {
+			trimmed := chunks[0]
+			trimmed.Data = trimmed.Data[cut:]
+			return append([]outputChunk{trimmed}, chunks[1:]...)
+		}
+		n -= len(chunks[0].Data)
+		chunks = chunks[1:]
+	}
+	return chunks
+}
+
+// runeBoundaryBefore returns the nearest index not after i, at which data could
+// be cut without splitting UTF-8 encoded character. i is returned for invalid
+// sequence.
+func runeBoundaryBefore(data string, i int) int {
+	if i >= len(data) {
+		return len(data)
+	}
+	for j := i; j >= 0 && j > i-utf8.UTFMax; j-- {
+		if utf8.RuneStart(data[j]) {
+			return j
+		}
+	}
+	return i
+}
+
+// runeBoundaryAfter returns the nearest index not before i, at which data could
+// be cut without splitting UTF-8 encoded character. i is returned for invalid
+// sequence.
+func runeBoundaryAfter(data string, i int) int {
+	for j := i; j < i+utf8.UTFMax; j++ {
+		if j >= len(data) {
+			return len(data)
+		}
+		if utf8.RuneStart(data[j]) {
+			return j
+		}
+	}
+	return i
+}
+
+func encodeSeparatedOutput(chunks []outputChunk) (string, error) {
+	report := separatedOutput{
+		Stdout: []outputChunk{},
+		Stderr: []outputChunk{},
+	}
+	for _, chunk := range chunks {
+		if chunk.stream == outputStreamStderr {
+			report.Stderr = append(report.Stderr, chunk)
+		} else {
+			report.Stdout = append(report.Stdout, chunk)
+		}
+	}
+	report.Output = mergeOutputChunks(chunks)
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,87 @@
+package taskengine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util/stringutil"
+)
+
+func TestOutputCollector(t *testing.T) {
+	collector := newOutputCollector(8)
+	stdout := collector.Writer(outputStreamStdout)
+	stderr := collector.Writer(outputStreamStderr)
+
+	stdout.Write([]byte("out1\n"))
+	stderr.Write([]byte("err1\n"))
+	stdout.Write([]byte("out2\n"))
+
+	// Oldest stdout output exceeding capacity is discarded, while stderr
+	// output is retained
+	assert.Equal(t, int64(2), collector.Discarded())
+	chunks := collector.Read(4)
+	assert.Equal(t, "t1\ne", mergeOutputChunks(chunks))
+	assert.Equal(t, outputStreamStdout, chunks[0].stream)
+	assert.Equal(t, outputStreamStderr, chunks[1].stream)
+
+	chunks = collector.Read(0)
+	assert.Equal(t, "rr1\nout2\n", mergeOutputChunks(chunks))
+	assert.Empty(t, collector.Read(0))
+
+	assert.Equal(t, "1\nout2\n", mergeOutputChunks(trimOutputChunks(chunks, 2)))
+	assert.Equal(t, "", mergeOutputChunks(trimOutputChunks(chunks, 100)))
+}
+
+func TestOutputCollectorKeepsCharacters(t *testing.T) {
+	// Character split by capacity is discarded as a whole
+	collector := newOutputCollector(5)
+	collector.Writer(outputStreamStdout).Write([]byte("值值"))
+	assert.Equal(t, int64(3), collector.Discarded())
+	assert.Equal(t, "值", mergeOutputChunks(collector.Read(0)))
+
+	// Character split by max is left for next read, unless it is the first
+	collector = newOutputCollector(100)
+	collector.Writer(outputStreamStdout).Write([]byte("ab值c"))
+	assert.Equal(t, "ab", mergeOutputChunks(collector.Read(4)))
+	assert.Equal(t, "值", mergeOutputChunks(collector.Read(2)))
+	assert.Equal(t, "c", mergeOutputChunks(collector.Read(2)))
+
+	chunks := []outputChunk{{stream: outputStreamStdout, Time: 1, Data: "值值"}}
+	assert.Equal(t, "值", mergeOutputChunks(trimOutputChunks(chunks, 1)))
+	assert.Equal(t, "", mergeOutputChunks(trimOutputChunks(chunks, 4)))
+}
+
+func TestEncodeSeparatedOutput(t *testing.T) {
+	chunks := []outputChunk{
+		{stream: outputStreamStdout, Time: 1, Data: "out\n"},
+		{stream: outputStreamStderr, Time: 2, Data: "err\n"},
+	}
+	body, err := encodeSeparatedOutput(chunks)
+	assert.NoError(t, err)
+
+	var decoded separatedOutput
+	assert.NoError(t, json.Unmarshal([]byte(body), &decoded))
+	assert.Equal(t, "out\nerr\n", decoded.Output)
+	assert.Equal(t, 1, len(decoded.Stdout))
+	assert.Equal(t, "out\n", decoded.Stdout[0].Data)
+	assert.Equal(t, int64(1), decoded.Stdout[0].Time)
+	assert.Equal(t, 1, len(decoded.Stderr))
+	assert.Equal(t, "err\n", decoded.Stderr[0].Data)
+	assert.Equal(t, int64(2), decoded.Stderr[0].Time)
+}
+
+func TestOutputCollectorWithRedaction(t *testing.T) {
+	collector := newOutputCollector(1024)
+	redactor := stringutil.NewRedactor([]string{"p@ssw0rd"})
+	stdout := redactor.NewWriter(collector.Writer(outputStreamStdout))
+
+	stdout.Write([]byte("password is p@s"))
+	// Beginning of secret is held instead of being read as running output
+	assert.Equal(t, "password is ", mergeOutputChunks(collector.Read(runningOutputReadSize)))
+	stdout.Write([]byte("sw0rd\n"))
+	stdout.Write([]byte("p@ssw"))
+	stdout.Flush()
+	assert.Equal(t, "******\np@ssw", mergeOutputChunks(collector.Read(0)))
+}
@@ -0,0 +1,234 @@
+package taskengine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	outputSpoolConfigFilename = "task_output_spool.json"
+
+	outputSpoolDirName = "task_output"
+	outputSpoolFileExt = ".log"
+
+	// 64MB
+	defaultOutputSpoolMaxFileSize    = 64 * 1024 * 1024
+	defaultOutputSpoolRetentionHours = 72
+
+	outputSpoolTruncatedMark = "\n[Aliyun Assist: output truncated due to size limit of spool file]\n"
+
+	// Timeout of each request uploading spool file up to max file size
+	spooledOutputUploadTimeout = 5 * time.Minute
+)
+
+var (
+	ErrInvalidTaskIdForOutputSpool = errors.New("Invalid task id for output spool")
+)
+
+// OutputSpoolConfig controls how full output of invocation is spooled to disk,
+// which is loaded from task_output_spool.json in config directory
+type OutputSpoolConfig struct {
+	Disabled       bool  `json:"disabled"`
+	MaxFileSize    int64 `json:"maxFileSize"`
+	RetentionHours int   `json:"retentionHours"`
+}
+
+func loadOutputSpoolConfig() OutputSpoolConfig {
+	config := OutputSpoolConfig{}
+	if _, err := loadTaskConfigFile(outputSpoolConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", outputSpoolConfigFilename)
+		config = OutputSpoolConfig{}
+	}
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = defaultOutputSpoolMaxFileSize
+	}
+	if config.RetentionHours <= 0 {
+		config.RetentionHours = defaultOutputSpoolRetentionHours
+	}
+	return config
+}
+
+func getOutputSpoolDir() (string, error) {
+	cacheDir, err := util.GetCachePath()
+	if err != nil {
+		return "", err
+	}
+	spoolDir := filepath.Join(cacheDir, outputSpoolDirName)
+	if err := util.MakeSurePath(spoolDir); err != nil {
+		return "", err
+	}
+	return spoolDir, nil
+}
+
+// SpooledOutputPath returns path of file which full output of the latest
+// invocation of specified task is spooled to. Parallel runs of periodic task
+// are spooled separately by their names like "<taskId>-parallel-<n>".
+func SpooledOutputPath(taskId string) (string, error) {
+	name, ok := taskIdFileName(taskId)
+	if !ok {
+		return "", ErrInvalidTaskIdForOutputSpool
+	}
+	spoolDir, err := getOutputSpoolDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(spoolDir, name+outputSpoolFileExt), nil
+}
+
+// outputSpool writes output of invocation into spool file until the size
+// limit is reached. Errors are never returned by Write, thus output collecting
+// would not be interrupted by spooling failure.
+type outputSpool struct {
+	file        *os.File
+	path        string
+	maxFileSize int64
+	written     int64
+	truncated   bool
+	writeErr    error
+	mutex       sync.Mutex
+}
+
+func newOutputSpool(taskId string, config OutputSpoolConfig) (*outputSpool, error) {
+	path, err := SpooledOutputPath(taskId)
+	if err != nil {
+		return nil, err
+	}
+	cleanExpiredOutputSpools(filepath.Dir(path), time.Duration(config.RetentionHours)*time.Hour)
+
+	// Spool file of previous invocation of periodic task is overwritten
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &outputSpool{
+		file:        file,
+		path:        path,
+		maxFileSize: config.MaxFileSize,
+	}, nil
+}
+
+func (s *outputSpool) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil || s.truncated || s.writeErr != nil {
+		return len(p), nil
+	}
+
+	toWrite := p
+	if remaining := s.maxFileSize - s.written; int64(len(toWrite)) > remaining {
+		toWrite = toWrite[:remaining]
+		s.truncated = true
+	}
+	n, err := s.file.Write(toWrite)
+	s.written += int64(n)
+	if err != nil {
+		s.writeErr = err
+		return len(p), nil
+	}
+	if s.truncated {
+		s.file.WriteString(outputSpoolTruncatedMark)
+	}
+	return len(p), nil
+}
+
+func (s *outputSpool) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func cleanExpiredOutputSpools(spoolDir string, retention time.Duration) {
+	spoolFiles, err := filepath.Glob(filepath.Join(spoolDir, "*"+outputSpoolFileExt))
+	if err != nil {
+		return
+	}
+	expiredBefore := time.Now().Add(-retention)
+	for _, spoolFile := range spoolFiles {
+		fileInfo, err := os.Stat(spoolFile)
+		if err != nil || fileInfo.ModTime().After(expiredBefore) {
+			continue
+		}
+		if err := os.Remove(spoolFile); err != nil {
+			log.GetLogger().WithField("file", spoolFile).WithError(err).Warningln("Failed to remove expired output spool file")
+		}
+	}
+}
+
+// openOutputSpool returns nil when spooling is disabled or failed, and the
+// invocation would run with only bounded in-memory output
+func (task *Task) openOutputSpool(taskLogger logrus.FieldLogger) *outputSpool {
+	config := loadOutputSpoolConfig()
+	if config.Disabled {
+		return nil
+	}
+	spool, err := newOutputSpool(task.runKey(), config)
+	if err != nil {
+		taskLogger.WithError(err).Warningln("Failed to create output spool file of invocation")
+		return nil
+	}
+	return spool
+}
+
+// PrintSpooledOutput writes full spooled output of specified task to w
+func PrintSpooledOutput(taskId string, w io.Writer) error {
+	path, err := SpooledOutputPath(taskId)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// UploadSpooledOutput sends full spooled output of specified task to server
+func UploadSpooledOutput(taskId string) error {
+	uploadLogger := log.GetLogger().WithFields(logrus.Fields{
+		"TaskId": taskId,
+		"Phase":  "UploadingSpooledOutput",
+	})
+
+	path, err := SpooledOutputPath(taskId)
+	if err != nil {
+		uploadLogger.WithError(err).Errorln("Invalid task id")
+		return err
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		uploadLogger.WithField("file", path).WithError(err).Errorln("Failed to read spooled output")
+		return err
+	}
+
+	// Spool file is streamed as request body and opened again on every retry,
+	// thus never read into memory as a whole
+	url := util.GetSpooledOutputService() + fmt.Sprintf("?taskId=%s&size=%d", taskId, fileInfo.Size())
+	_, err = util.HttpPostFileWithTimeout(url, path, spooledOutputUploadTimeout)
+	for i := 0; i < 3 && err != nil; i++ {
+		time.Sleep(time.Duration(2) * time.Second)
+		_, err = util.HttpPostFileWithTimeout(url, path, spooledOutputUploadTimeout)
+	}
+	if err != nil {
+		uploadLogger.WithError(err).Errorln("Failed to upload spooled output")
+		return err
+	}
+	uploadLogger.Infof("Uploaded spooled output: %d bytes", fileInfo.Size())
+	return nil
+}
@@ -0,0 +1,95 @@
+package taskengine
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+func TestOutputSpool(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	spoolDir, err := getOutputSpoolDir()
+	assert.NoError(t, err)
+
+	expiredFile := filepath.Join(spoolDir, "t-expired.log")
+	assert.NoError(t, ioutil.WriteFile(expiredFile, []byte("expired"), 0600))
+	expiredTime := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(expiredFile, expiredTime, expiredTime))
+
+	spool, err := newOutputSpool("t-spool", OutputSpoolConfig{
+		MaxFileSize:    10,
+		RetentionHours: 1,
+	})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, expiredFile)
+
+	n, err := spool.Write([]byte("0123456"))
+	assert.Equal(t, 7, n)
+	assert.NoError(t, err)
+	n, err = spool.Write([]byte("789abc"))
+	assert.Equal(t, 6, n)
+	assert.NoError(t, err)
+	spool.Write([]byte("def"))
+	assert.NoError(t, spool.Close())
+	assert.True(t, spool.truncated)
+
+	var output bytes.Buffer
+	assert.NoError(t, PrintSpooledOutput("t-spool", &output))
+	assert.Equal(t, "0123456789"+outputSpoolTruncatedMark, output.String())
+
+	_, err = SpooledOutputPath("../t-spool")
+	assert.Equal(t, ErrInvalidTaskIdForOutputSpool, err)
+	_, err = SpooledOutputPath("..")
+	assert.Equal(t, ErrInvalidTaskIdForOutputSpool, err)
+}
+
+func TestUploadSpooledOutput(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	spool, err := newOutputSpool("t-upload", OutputSpoolConfig{
+		MaxFileSize:    1024,
+		RetentionHours: 1,
+	})
+	assert.NoError(t, err)
+	spool.Write([]byte("spooled output"))
+	assert.NoError(t, spool.Close())
+	spoolPath, err := SpooledOutputPath("t-upload")
+	assert.NoError(t, err)
+
+	var uploadedUrl, uploadedPath string
+	guard := monkey.Patch(util.HttpPostFileWithTimeout, func(url string, filePath string, timeout time.Duration) (string, error) {
+		uploadedUrl, uploadedPath = url, filePath
+		return "", nil
+	})
+	defer guard.Unpatch()
+	assert.NoError(t, UploadSpooledOutput("t-upload"))
+	assert.Equal(t, spoolPath, uploadedPath)
+	assert.True(t, strings.HasSuffix(uploadedUrl, "?taskId=t-upload&size=14"))
+
+	assert.Equal(t, ErrInvalidTaskIdForOutputSpool, UploadSpooledOutput("../t-upload"))
+}
+
+func TestGetReportStringWithDiscardedOutput(t *testing.T) {
+	task := NewTask(RunTaskInfo{TaskId: "t-report"}, nil, nil)
+	quota := task.outputQuota()
+	assert.Equal(t, defaultQuoto, quota)
+
+	collector := newOutputCollector(quota)
+	collector.Writer(outputStreamStdout).Write([]byte(strings.Repeat("a", quota)))
+	collector.Writer(outputStreamStdout).Write([]byte(strings.Repeat("b", 100)))
+	task.outputChunks = collector.Read(0)
+	task.outputDiscarded = collector.Discarded()
+
+	report := task.getReportString()
+	assert.Equal(t, quota, len(report))
+	assert.True(t, strings.HasSuffix(report, strings.Repeat("b", 100)))
+	assert.Equal(t, 100, task.droped)
+}
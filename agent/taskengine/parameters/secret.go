@@ -0,0 +1,288 @@
+package parameters
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	SecretProviderOOSSecret = "oos-secret"
+	SecretProviderOOS       = "oos"
+	SecretProviderFile      = "file"
+	SecretProviderEnv       = "env"
+	SecretProviderHTTP      = "http"
+
+	defaultSecretResolveTimeout = 5
+)
+
+var (
+	//{{file:/etc/secrets/db}}, {{oos-secret:db_password}}
+	_secretParameterPattern = regexp.MustCompile(`{{\s*([\w-]+)\s*:\s*([^{}:][^{}]*?)\s*}}`)
+)
+
+// SecretResolver resolves value of parameter referenced by placeholder like
+// {{prefix:name}}, where the prefix selects the resolver
+type SecretResolver interface {
+	Resolve(ctx context.Context, name string) (string, error)
+}
+
+// SecretProviderConfig configures resolver selected by a placeholder prefix
+type SecretProviderConfig struct {
+	// Type of provider: oos-secret, oos, file, env or http. Defaults to the
+	// prefix itself.
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled"`
+	// Timeout of resolving one parameter in seconds
+	Timeout int `json:"timeout"`
+	// Seconds to cache resolved values, and 0 means no cache
+	CacheTTL int `json:"cacheTTL"`
+	// Whether resolved values are sensitive. Defaults to true except for oos
+	// parameters.
+	Sensitive *bool `json:"sensitive"`
+
+	// For file provider: only files under this directory are allowed, which
+	// is required since files are read with privilege of agent
+	BaseDir string `json:"baseDir"`
+	// For env provider: only these environment variables of agent are
+	// allowed, which is required as well
+	AllowedNames []string `json:"allowedNames"`
+
+	// For http provider: URL template with {{name}} placeholder, additional
+	// request headers, and field of JSON response body to extract value from.
+	// Whole response body is used if JSONField is empty.
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	JSONField string            `json:"jsonField"`
+}
+
+// SecretResolversConfig maps placeholder prefixes to provider configurations
+type SecretResolversConfig struct {
+	Providers map[string]SecretProviderConfig `json:"providers"`
+}
+
+type ParameterResolveError struct {
+	Prefix string
+	Name   string
+	Err    error
+}
+
+func (e *ParameterResolveError) Error() string {
+	return fmt.Sprintf("Failed to resolve parameter {{%s:%s}}: %s", e.Prefix, e.Name, e.Err.Error())
+}
+
+func (e *ParameterResolveError) Unwrap() error {
+	return e.Err
+}
+
+type secretProvider struct {
+	resolver  SecretResolver
+	timeout   time.Duration
+	cacheTTL  time.Duration
+	sensitive bool
+}
+
+type cachedSecret struct {
+	value     string
+	expiredAt time.Time
+}
+
+// SecretResolvers holds resolvers for all enabled placeholder prefixes, and
+// caches resolved values if configured
+type SecretResolvers struct {
+	providers map[string]*secretProvider
+	cache     map[string]cachedSecret
+	cacheLock sync.Mutex
+}
+
+// defaultSecretProviderConfigs enables only providers resolving from OOS.
+// Providers of local files and environment variables of agent are opt-in via
+// configuration, since they are resolved with privilege of agent rather than
+// the user whom invocation runs as.
+func defaultSecretProviderConfigs() map[string]SecretProviderConfig {
+	return map[string]SecretProviderConfig{
+		SecretProviderOOSSecret: {Type: SecretProviderOOSSecret, Timeout: 10},
+		SecretProviderOOS:       {Type: SecretProviderOOS, Timeout: 10},
+	}
+}
+
+func newSecretResolver(prefix string, config SecretProviderConfig) (SecretResolver, error) {
+	switch config.Type {
+	case SecretProviderOOSSecret:
+		return &oosResolver{withDecryption: true}, nil
+	case SecretProviderOOS:
+		return &oosResolver{withDecryption: false}, nil
+	case SecretProviderFile:
+		if config.BaseDir == "" || !filepath.IsAbs(config.BaseDir) {
+			return nil, fmt.Errorf("Absolute baseDir of file secret provider %s is not specified", prefix)
+		}
+		return &fileResolver{baseDir: filepath.Clean(config.BaseDir)}, nil
+	case SecretProviderEnv:
+		if len(config.AllowedNames) == 0 {
+			return nil, fmt.Errorf("allowedNames of env secret provider %s is not specified", prefix)
+		}
+		allowedNames := make(map[string]bool, len(config.AllowedNames))
+		for _, name := range config.AllowedNames {
+			allowedNames[name] = true
+		}
+		return &envResolver{allowedNames: allowedNames}, nil
+	case SecretProviderHTTP:
+		if config.URL == "" {
+			return nil, fmt.Errorf("URL of http secret provider %s is not specified", prefix)
+		}
+		return &httpResolver{
+			urlTemplate: config.URL,
+			headers:     config.Headers,
+			jsonField:   config.JSONField,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown type %s of secret provider %s", config.Type, prefix)
+	}
+}
+
+// NewSecretResolvers creates resolvers of built-in providers, which are
+// overridden and extended by providers in configuration. Invalid provider
+// configurations are returned as errors while valid ones are still usable.
+func NewSecretResolvers(config SecretResolversConfig) (*SecretResolvers, []error) {
+	providerConfigs := defaultSecretProviderConfigs()
+	for prefix, providerConfig := range config.Providers {
+		if providerConfig.Type == "" {
+			providerConfig.Type = prefix
+		}
+		providerConfigs[prefix] = providerConfig
+	}
+
+	resolvers := &SecretResolvers{
+		providers: map[string]*secretProvider{},
+		cache:     map[string]cachedSecret{},
+	}
+	var errs []error
+	for prefix, providerConfig := range providerConfigs {
+		if providerConfig.Disabled {
+			continue
+		}
+		resolver, err := newSecretResolver(prefix, providerConfig)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		timeout := providerConfig.Timeout
+		if timeout <= 0 {
+			timeout = defaultSecretResolveTimeout
+		}
+		sensitive := providerConfig.Type != SecretProviderOOS
+		if providerConfig.Sensitive != nil {
+			sensitive = *providerConfig.Sensitive
+		}
+		resolvers.providers[prefix] = &secretProvider{
+			resolver:  resolver,
+			timeout:   time.Duration(timeout) * time.Second,
+			cacheTTL:  time.Duration(providerConfig.CacheTTL) * time.Second,
+			sensitive: sensitive,
+		}
+	}
+	return resolvers, errs
+}
+
+// RegisterResolver registers resolver for specified prefix, which replaces
+// existing one
+func (r *SecretResolvers) RegisterResolver(prefix string, resolver SecretResolver, timeout time.Duration, cacheTTL time.Duration, sensitive bool) {
+	r.providers[prefix] = &secretProvider{
+		resolver:  resolver,
+		timeout:   timeout,
+		cacheTTL:  cacheTTL,
+		sensitive: sensitive,
+	}
+}
+
+// Resolve replaces all placeholders with registered prefixes in content.
+// Placeholders with unknown prefixes are left untouched. Sensitive values
+// resolved are also returned.
+func (r *SecretResolvers) Resolve(content string) (string, []string, error) {
+	var thrown error
+	var sensitiveValues []string
+	resolvedContent := _secretParameterPattern.ReplaceAllStringFunc(content, func(matched string) string {
+		if thrown != nil {
+			return matched
+		}
+		match := _secretParameterPattern.FindStringSubmatch(matched)
+		prefix, name := match[1], match[2]
+		provider, ok := r.providers[prefix]
+		if !ok {
+			return matched
+		}
+
+		value, err := r.resolveWithCache(prefix, name, provider)
+		if err != nil {
+			thrown = &ParameterResolveError{
+				Prefix: prefix,
+				Name:   name,
+				Err:    err,
+			}
+			return matched
+		}
+		if provider.sensitive && value != "" {
+			sensitiveValues = append(sensitiveValues, value)
+		}
+		return value
+	})
+	if thrown != nil {
+		return "", nil, thrown
+	}
+	return resolvedContent, sensitiveValues, nil
+}
+
+func (r *SecretResolvers) resolveWithCache(prefix string, name string, provider *secretProvider) (string, error) {
+	cacheKey := prefix + ":" + name
+	if provider.cacheTTL > 0 {
+		r.cacheLock.Lock()
+		cached, ok := r.cache[cacheKey]
+		r.cacheLock.Unlock()
+		if ok && time.Now().Before(cached.expiredAt) {
+			return cached.value, nil
+		}
+	}
+
+	value, err := resolveWithTimeout(provider.resolver, name, provider.timeout)
+	if err != nil {
+		return "", err
+	}
+
+	if provider.cacheTTL > 0 {
+		r.cacheLock.Lock()
+		r.cache[cacheKey] = cachedSecret{
+			value:     value,
+			expiredAt: time.Now().Add(provider.cacheTTL),
+		}
+		r.cacheLock.Unlock()
+	}
+	return value, nil
+}
+
+// resolveWithTimeout guarantees to return in time even if resolver does not
+// respect the deadline of context
+func resolveWithTimeout(resolver SecretResolver, name string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type resolveResult struct {
+		value string
+		err   error
+	}
+	resultChan := make(chan resolveResult, 1)
+	go func() {
+		value, err := resolver.Resolve(ctx, name)
+		resultChan <- resolveResult{value, err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		return result.value, result.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("Timeout after %s", timeout.String())
+	}
+}
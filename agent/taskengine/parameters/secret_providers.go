@@ -0,0 +1,155 @@
+package parameters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	// Placeholder in URL template of http provider replaced by escaped name
+	httpSecretNamePlaceholder = "{{name}}"
+	// At most 1MB response body is accepted from http provider
+	maxHTTPSecretResponseSize = 1024 * 1024
+)
+
+var (
+	ErrSecretFileOutsideBaseDir  = errors.New("Secret file is outside of allowed directory")
+	ErrEnvironmentVariableNotSet = errors.New("Environment variable is not set")
+	ErrEnvironmentVariableDenied = errors.New("Environment variable is not allowed")
+
+	getOOSSecretParameter = util.GetSecretParam
+	getOOSParameter       = util.GetParam
+)
+
+// oosResolver resolves parameters and secret parameters in OOS parameter
+// store via RAM role of ECS instance
+type oosResolver struct {
+	withDecryption bool
+}
+
+func (r *oosResolver) Resolve(ctx context.Context, name string) (string, error) {
+	if r.withDecryption {
+		return getOOSSecretParameter(name)
+	}
+	return getOOSParameter(name)
+}
+
+// fileResolver reads content of local file under base directory as value,
+// with trailing line break trimmed
+type fileResolver struct {
+	baseDir string
+}
+
+func (r *fileResolver) Resolve(ctx context.Context, name string) (string, error) {
+	path := filepath.Clean(name)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.baseDir, path)
+	}
+	if !isPathUnder(r.baseDir, path) {
+		return "", ErrSecretFileOutsideBaseDir
+	}
+	// Symbolic links must not lead outside base directory either
+	resolvedBaseDir, err := filepath.EvalSymlinks(r.baseDir)
+	if err != nil {
+		return "", err
+	}
+	resolvedPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !isPathUnder(resolvedBaseDir, resolvedPath) {
+		return "", ErrSecretFileOutsideBaseDir
+	}
+
+	content, err := ioutil.ReadFile(resolvedPath)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(string(content), "\n")
+	value = strings.TrimSuffix(value, "\r")
+	return value, nil
+}
+
+func isPathUnder(baseDir string, path string) bool {
+	relPath, err := filepath.Rel(baseDir, path)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// envResolver reads value from allowed environment variables of agent
+type envResolver struct {
+	allowedNames map[string]bool
+}
+
+func (r *envResolver) Resolve(ctx context.Context, name string) (string, error) {
+	if !r.allowedNames[name] {
+		return "", ErrEnvironmentVariableDenied
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", ErrEnvironmentVariableNotSet
+	}
+	return value, nil
+}
+
+// httpResolver requests value from generic HTTP secret endpoint via GET
+// method
+type httpResolver struct {
+	urlTemplate string
+	headers     map[string]string
+	jsonField   string
+}
+
+func (r *httpResolver) Resolve(ctx context.Context, name string) (string, error) {
+	requestURL := strings.ReplaceAll(r.urlTemplate, httpSecretNamePlaceholder, url.PathEscape(name))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range r.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxHTTPSecretResponseSize))
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unexpected status code %d from secret endpoint", response.StatusCode)
+	}
+
+	if r.jsonField == "" {
+		return string(body), nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", fmt.Errorf("Invalid JSON response from secret endpoint: %w", err)
+	}
+	value, ok := fields[r.jsonField]
+	if !ok {
+		return "", fmt.Errorf("Field %s not found in response from secret endpoint", r.jsonField)
+	}
+	if stringValue, ok := value.(string); ok {
+		return stringValue, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,203 @@
+package parameters
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingResolver struct {
+	count int
+	delay time.Duration
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, name string) (string, error) {
+	r.count++
+	time.Sleep(r.delay)
+	return "value-of-" + name, nil
+}
+
+func TestResolveFileAndEnvSecrets(t *testing.T) {
+	secretDir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(secretDir)
+	secretFile := filepath.Join(secretDir, "db")
+	assert.NoError(t, ioutil.WriteFile(secretFile, []byte("p@ssw0rd\n"), 0600))
+	os.Setenv("ASSIST_TEST_SECRET", "env-secret")
+	defer os.Unsetenv("ASSIST_TEST_SECRET")
+
+	resolvers, errs := NewSecretResolvers(SecretResolversConfig{
+		Providers: map[string]SecretProviderConfig{
+			"file": {BaseDir: secretDir},
+			"env":  {AllowedNames: []string{"ASSIST_TEST_SECRET", "ASSIST_TEST_SECRET_NOT_SET"}},
+		},
+	})
+	assert.Empty(t, errs)
+	content := "mysql -p{{file:" + secretFile + "}} -e '{{ env : ASSIST_TEST_SECRET }}' {{ACS::InstanceId}} {{unknown:x}}"
+	resolved, sensitiveValues, err := resolvers.Resolve(content)
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql -pp@ssw0rd -e 'env-secret' {{ACS::InstanceId}} {{unknown:x}}", resolved)
+	assert.Equal(t, []string{"p@ssw0rd", "env-secret"}, sensitiveValues)
+
+	_, _, err = resolvers.Resolve("{{env:ASSIST_TEST_SECRET_NOT_SET}}")
+	var resolveErr *ParameterResolveError
+	assert.True(t, errors.As(err, &resolveErr))
+	assert.Equal(t, "env", resolveErr.Prefix)
+	assert.Equal(t, ErrEnvironmentVariableNotSet, resolveErr.Err)
+
+	_, _, err = resolvers.Resolve("{{env:PATH}}")
+	assert.True(t, errors.Is(err, ErrEnvironmentVariableDenied))
+}
+
+func TestFileAndEnvSecretsOptIn(t *testing.T) {
+	resolvers, errs := NewSecretResolvers(SecretResolversConfig{})
+	assert.Empty(t, errs)
+	content := "cat {{file:/etc/shadow}} {{env:PATH}}"
+	resolved, _, err := resolvers.Resolve(content)
+	assert.NoError(t, err)
+	assert.Equal(t, content, resolved)
+
+	// Enabled providers must be restricted
+	_, errs = NewSecretResolvers(SecretResolversConfig{
+		Providers: map[string]SecretProviderConfig{
+			"file": {},
+			"env":  {},
+			"rel":  {Type: SecretProviderFile, BaseDir: "secrets"},
+		},
+	})
+	assert.Len(t, errs, 3)
+}
+
+func TestResolveFileSecretOutsideBaseDir(t *testing.T) {
+	resolvers, errs := NewSecretResolvers(SecretResolversConfig{
+		Providers: map[string]SecretProviderConfig{
+			"file": {BaseDir: "/etc/secrets"},
+		},
+	})
+	assert.Empty(t, errs)
+	_, _, err := resolvers.Resolve("{{file:/etc/secrets/../passwd}}")
+	assert.True(t, errors.Is(err, ErrSecretFileOutsideBaseDir))
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	secretDir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(secretDir)
+	outsideDir, err := ioutil.TempDir("", "outside")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outsideDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outsideDir, "passwd"), []byte("root"), 0600))
+	assert.NoError(t, os.Symlink(filepath.Join(outsideDir, "passwd"), filepath.Join(secretDir, "linked")))
+	resolvers, errs = NewSecretResolvers(SecretResolversConfig{
+		Providers: map[string]SecretProviderConfig{
+			"file": {BaseDir: secretDir},
+		},
+	})
+	assert.Empty(t, errs)
+	_, _, err = resolvers.Resolve("{{file:linked}}")
+	assert.True(t, errors.Is(err, ErrSecretFileOutsideBaseDir))
+}
+
+func TestResolveHTTPSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/db":
+			w.Write([]byte(`{"value": "http-secret"}`))
+		case "/v1/secret/slow":
+			time.Sleep(2 * time.Second)
+			w.Write([]byte(`{"value": "slow"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	resolvers, errs := NewSecretResolvers(SecretResolversConfig{
+		Providers: map[string]SecretProviderConfig{
+			"vault": {
+				Type:      SecretProviderHTTP,
+				URL:       server.URL + "/v1/secret/{{name}}",
+				Headers:   map[string]string{"X-Token": "token"},
+				JSONField: "value",
+				Timeout:   1,
+			},
+			"invalid": {Type: SecretProviderHTTP},
+		},
+	})
+	assert.Equal(t, 1, len(errs))
+
+	resolved, sensitiveValues, err := resolvers.Resolve("echo {{vault:db}}")
+	assert.NoError(t, err)
+	assert.Equal(t, "echo http-secret", resolved)
+	assert.Equal(t, []string{"http-secret"}, sensitiveValues)
+
+	_, _, err = resolvers.Resolve("echo {{vault:missing}}")
+	assert.Error(t, err)
+
+	start := time.Now()
+	_, _, err = resolvers.Resolve("echo {{vault:slow}}")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second)
+
+	// Not registered
+	resolved, _, err = resolvers.Resolve("echo {{invalid:db}}")
+	assert.NoError(t, err)
+	assert.Equal(t, "echo {{invalid:db}}", resolved)
+}
+
+func TestResolveSecretWithCacheAndTimeout(t *testing.T) {
+	resolvers, _ := NewSecretResolvers(SecretResolversConfig{})
+	cached := &countingResolver{}
+	resolvers.RegisterResolver("cached", cached, time.Second, time.Minute, false)
+	uncached := &countingResolver{}
+	resolvers.RegisterResolver("uncached", uncached, time.Second, 0, true)
+
+	for i := 0; i < 3; i++ {
+		resolved, sensitiveValues, err := resolvers.Resolve("{{cached:a}} {{uncached:b}}")
+		assert.NoError(t, err)
+		assert.Equal(t, "value-of-a value-of-b", resolved)
+		assert.Equal(t, []string{"value-of-b"}, sensitiveValues)
+	}
+	assert.Equal(t, 1, cached.count)
+	assert.Equal(t, 3, uncached.count)
+
+	slow := &countingResolver{delay: 500 * time.Millisecond}
+	resolvers.RegisterResolver("slow", slow, 100*time.Millisecond, 0, true)
+	_, _, err := resolvers.Resolve("{{slow:c}}")
+	assert.Error(t, err)
+}
+
+func TestResolveOOSParameters(t *testing.T) {
+	originalGetOOSSecretParameter := getOOSSecretParameter
+	originalGetOOSParameter := getOOSParameter
+	defer func() {
+		getOOSSecretParameter = originalGetOOSSecretParameter
+		getOOSParameter = originalGetOOSParameter
+	}()
+	getOOSSecretParameter = func(name string) (string, error) {
+		return "secret-" + name, nil
+	}
+	getOOSParameter = func(name string) (string, error) {
+		return "param-" + name, nil
+	}
+
+	resolvers, _ := NewSecretResolvers(SecretResolversConfig{})
+	resolved, sensitiveValues, err := resolvers.Resolve("ss{{oos-secret:test}} {{ oos-secret : p-a.ra_m }} {{oos:region}}")
+	assert.NoError(t, err)
+	assert.Equal(t, "sssecret-test secret-p-a.ra_m param-region", resolved)
+	assert.Equal(t, []string{"secret-test", "secret-p-a.ra_m"}, sensitiveValues)
+}
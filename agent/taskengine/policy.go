@@ -0,0 +1,299 @@
+package taskengine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+)
+
+const (
+	policyConfigFilename     = "task_policy.json"
+	policyYAMLConfigFilename = "task_policy.yaml"
+	policyYMLConfigFilename  = "task_policy.yml"
+
+	// Timeout of invocation used when timeOut field is not a valid integer,
+	// which is consistent with Task.Run
+	defaultPolicyEvaluatedTimeout = 3600
+	// Symbolic links followed when resolving path not existing yet, beyond
+	// which it is considered a loop
+	maxPolicyFollowedLinks = 255
+)
+
+var (
+	ErrInvalidPolicy = errors.New("Invalid command policy")
+)
+
+// CommandPolicy declares rules enforced by agent itself before invocations,
+// file sending and sessions start, which is loaded from task_policy.json,
+// task_policy.yaml or task_policy.yml in config directory. Empty fields impose
+// no restriction.
+type CommandPolicy struct {
+	// Users whom invocations and sessions must not run as. Default user is
+	// matched when username is not specified, i.e., root for invocations on
+	// *nix and system on Windows.
+	DenyUsers []string `json:"denyUsers" yaml:"denyUsers"`
+	// Allowed command types of invocations
+	AllowedCommandTypes []string `json:"allowedCommandTypes" yaml:"allowedCommandTypes"`
+	// Invocations can only run in these directories or subdirectories
+	AllowedWorkingDirs []string `json:"allowedWorkingDirs" yaml:"allowedWorkingDirs"`
+	// Maximum timeout of invocations in seconds
+	MaxTimeout int `json:"maxTimeout" yaml:"maxTimeout"`
+	// Invocations whose decoded content, or content resolved with parameters
+	// and secrets, matches any regular expression are denied
+	DenyContentPatterns []string `json:"denyContentPatterns" yaml:"denyContentPatterns"`
+	// Deny invocations of cron, rate and at tasks
+	DenyPeriodicTasks bool `json:"denyPeriodicTasks" yaml:"denyPeriodicTasks"`
+
+	// Files can only be sent into these directories or subdirectories
+	AllowedFileDestinations []string `json:"allowedFileDestinations" yaml:"allowedFileDestinations"`
+
+	// Deny all sessions, or only port forwarding sessions
+	DenySessions       bool `json:"denySessions" yaml:"denySessions"`
+	DenyPortForwarding bool `json:"denyPortForwarding" yaml:"denyPortForwarding"`
+
+	denyContentRegexps []*regexp.Regexp
+}
+
+// PolicyDeniedError describes which rule of policy denied the operation
+type PolicyDeniedError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	return fmt.Sprintf("Denied by rule %s of local policy: %s", e.Rule, e.Reason)
+}
+
+// loadCommandPolicy reads policy on each call thus changes take effect without
+// restarting agent. nil is returned without error when no policy file exists.
+func loadCommandPolicy() (*CommandPolicy, error) {
+	policy := &CommandPolicy{}
+	loaded, err := loadTaskConfigFile(policyConfigFilename, policy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidPolicy, policyConfigFilename, err.Error())
+	}
+	for _, filename := range []string{policyYAMLConfigFilename, policyYMLConfigFilename} {
+		if loaded {
+			break
+		}
+		loaded, err = loadTaskConfigFileWith(filename, policy, yaml.Unmarshal)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidPolicy, filename, err.Error())
+		}
+	}
+	if !loaded {
+		return nil, nil
+	}
+
+	if err := policy.compile(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (p *CommandPolicy) compile() error {
+	p.denyContentRegexps = make([]*regexp.Regexp, 0, len(p.DenyContentPatterns))
+	for _, pattern := range p.DenyContentPatterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%w: denyContentPatterns: %s", ErrInvalidPolicy, err.Error())
+		}
+		p.denyContentRegexps = append(p.denyContentRegexps, compiled)
+	}
+	return nil
+}
+
+// evaluateLocalPolicy loads policy and evaluates it by specified function.
+// Everything is denied when policy file exists but is invalid, since silently
+// ignoring it would be unsafe.
+func evaluateLocalPolicy(evaluate func(policy *CommandPolicy) error) error {
+	policy, err := loadCommandPolicy()
+	if err != nil {
+		log.GetLogger().WithError(err).Errorln("Failed to load local policy, deny everything")
+		return &PolicyDeniedError{
+			Rule:   "invalidPolicy",
+			Reason: err.Error(),
+		}
+	}
+	if policy == nil {
+		return nil
+	}
+	return evaluate(policy)
+}
+
+func policyMatchUser(username string, deniedUsers []string) bool {
+	for _, denied := range deniedUsers {
+		if denied == username || (G_IsWindows && strings.EqualFold(denied, username)) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyPathWithinDirs reports whether path is one of dirs or under them, after
+// symbolic links in existing part of them are resolved
+func policyPathWithinDirs(path string, dirs []string) bool {
+	path = resolvePolicyPath(path)
+	for _, dir := range dirs {
+		dir = resolvePolicyPath(dir)
+		relPath, err := filepath.Rel(dir, path)
+		if err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePolicyPath cleans path and resolves symbolic links in the longest
+// existing prefix of it, to which the rest not existing yet is appended.
+// Dangling symbolic link is followed to where it points as well, since file
+// would be created there.
+func resolvePolicyPath(path string) string {
+	path = filepath.Clean(path)
+	existing, rest := path, ""
+	for followedLinks := 0; ; {
+		if resolved, err := filepath.EvalSymlinks(existing); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if target, err := os.Readlink(existing); err == nil && followedLinks < maxPolicyFollowedLinks {
+			followedLinks++
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(existing), target)
+			}
+			existing, rest = filepath.Join(target, rest), ""
+			continue
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// EvaluateRunTask checks invocation with decoded content and the working
+// directory it would run in
+func (p *CommandPolicy) EvaluateRunTask(taskInfo RunTaskInfo, content []byte, workingDir string) error {
+	username := taskInfo.Username
+	if username == "" {
+		if G_IsWindows {
+			username = "system"
+		} else {
+			username = "root"
+		}
+	}
+	if policyMatchUser(username, p.DenyUsers) {
+		return &PolicyDeniedError{
+			Rule:   "denyUsers",
+			Reason: fmt.Sprintf("running as user %s is not allowed", username),
+		}
+	}
+
+	if len(p.AllowedCommandTypes) > 0 {
+		allowed := false
+		for _, commandType := range p.AllowedCommandTypes {
+			if commandType == taskInfo.CommandType {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &PolicyDeniedError{
+				Rule:   "allowedCommandTypes",
+				Reason: fmt.Sprintf("command type %s is not allowed", taskInfo.CommandType),
+			}
+		}
+	}
+
+	if len(p.AllowedWorkingDirs) > 0 && !policyPathWithinDirs(workingDir, p.AllowedWorkingDirs) {
+		return &PolicyDeniedError{
+			Rule:   "allowedWorkingDirs",
+			Reason: fmt.Sprintf("working directory %s is not allowed", workingDir),
+		}
+	}
+
+	if p.MaxTimeout > 0 {
+		timeout, err := strconv.Atoi(taskInfo.TimeOut)
+		if err != nil {
+			timeout = defaultPolicyEvaluatedTimeout
+		}
+		if timeout <= 0 || timeout > p.MaxTimeout {
+			return &PolicyDeniedError{
+				Rule:   "maxTimeout",
+				Reason: fmt.Sprintf("timeout %d seconds exceeds limit %d seconds", timeout, p.MaxTimeout),
+			}
+		}
+	}
+
+	if err := p.EvaluateContent(content); err != nil {
+		return err
+	}
+
+	if p.DenyPeriodicTasks {
+		switch taskInfo.Repeat {
+		case RunTaskCron, RunTaskRate, RunTaskAt:
+			return &PolicyDeniedError{
+				Rule:   "denyPeriodicTasks",
+				Reason: fmt.Sprintf("periodic task of %s type is not allowed", taskInfo.Repeat),
+			}
+		}
+	}
+	return nil
+}
+
+// EvaluateContent checks content of invocation against denied patterns, which
+// is also applied to content resolved with parameters and secrets before run
+func (p *CommandPolicy) EvaluateContent(content []byte) error {
+	for i, contentRegexp := range p.denyContentRegexps {
+		if contentRegexp.Match(content) {
+			return &PolicyDeniedError{
+				Rule:   "denyContentPatterns",
+				Reason: fmt.Sprintf("content matches denied pattern %s", p.DenyContentPatterns[i]),
+			}
+		}
+	}
+	return nil
+}
+
+// EvaluateSendFile checks the path which file to be sent would be written to
+func (p *CommandPolicy) EvaluateSendFile(destination string) error {
+	if len(p.AllowedFileDestinations) > 0 && !policyPathWithinDirs(destination, p.AllowedFileDestinations) {
+		return &PolicyDeniedError{
+			Rule:   "allowedFileDestinations",
+			Reason: fmt.Sprintf("destination %s is not allowed", destination),
+		}
+	}
+	return nil
+}
+
+// EvaluateSession checks session to be started as specified user
+func (p *CommandPolicy) EvaluateSession(username string, isPortForward bool) error {
+	if p.DenySessions {
+		return &PolicyDeniedError{
+			Rule:   "denySessions",
+			Reason: "session is not allowed",
+		}
+	}
+	if isPortForward && p.DenyPortForwarding {
+		return &PolicyDeniedError{
+			Rule:   "denyPortForwarding",
+			Reason: "port forwarding session is not allowed",
+		}
+	}
+	if policyMatchUser(username, p.DenyUsers) {
+		return &PolicyDeniedError{
+			Rule:   "denyUsers",
+			Reason: fmt.Sprintf("session as user %s is not allowed", username),
+		}
+	}
+	return nil
+}
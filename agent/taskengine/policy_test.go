@@ -0,0 +1,161 @@
+package taskengine
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const testPolicyYAML = `
+denyUsers: [root]
+allowedCommandTypes: [RunShellScript]
+allowedWorkingDirs: [/opt/app]
+maxTimeout: 600
+denyContentPatterns: ['rm\s+-rf\s+/']
+denyPeriodicTasks: true
+allowedFileDestinations: [/opt/app/conf]
+denyPortForwarding: true
+`
+
+func loadTestPolicy(t *testing.T) *CommandPolicy {
+	policy := &CommandPolicy{}
+	assert.NoError(t, yaml.Unmarshal([]byte(testPolicyYAML), policy))
+	assert.NoError(t, policy.compile())
+	return policy
+}
+
+func assertDeniedByRule(t *testing.T, rule string, err error) {
+	var deniedErr *PolicyDeniedError
+	if assert.True(t, errors.As(err, &deniedErr), "expected denied by %s", rule) {
+		assert.Equal(t, rule, deniedErr.Rule)
+	}
+}
+
+func TestCommandPolicyEvaluateRunTask(t *testing.T) {
+	policy := loadTestPolicy(t)
+	taskInfo := RunTaskInfo{
+		CommandType: "RunShellScript",
+		Username:    "app",
+		TimeOut:     "60",
+		Repeat:      RunTaskOnce,
+	}
+	content := []byte("echo hello")
+	assert.NoError(t, policy.EvaluateRunTask(taskInfo, content, "/opt/app/bin"))
+	assert.NoError(t, policy.EvaluateRunTask(taskInfo, content, "/opt/app"))
+
+	rootInfo := taskInfo
+	rootInfo.Username = ""
+	if !G_IsWindows {
+		assertDeniedByRule(t, "denyUsers", policy.EvaluateRunTask(rootInfo, content, "/opt/app"))
+	}
+
+	typeInfo := taskInfo
+	typeInfo.CommandType = "RunPythonScript"
+	assertDeniedByRule(t, "allowedCommandTypes", policy.EvaluateRunTask(typeInfo, content, "/opt/app"))
+
+	assertDeniedByRule(t, "allowedWorkingDirs", policy.EvaluateRunTask(taskInfo, content, "/opt/application"))
+	assertDeniedByRule(t, "allowedWorkingDirs", policy.EvaluateRunTask(taskInfo, content, "/opt/app/../etc"))
+
+	timeoutInfo := taskInfo
+	timeoutInfo.TimeOut = "3600"
+	assertDeniedByRule(t, "maxTimeout", policy.EvaluateRunTask(timeoutInfo, content, "/opt/app"))
+	timeoutInfo.TimeOut = ""
+	assertDeniedByRule(t, "maxTimeout", policy.EvaluateRunTask(timeoutInfo, content, "/opt/app"))
+
+	assertDeniedByRule(t, "denyContentPatterns", policy.EvaluateRunTask(taskInfo, []byte("rm  -rf /"), "/opt/app"))
+
+	periodicInfo := taskInfo
+	periodicInfo.Repeat = RunTaskRate
+	assertDeniedByRule(t, "denyPeriodicTasks", policy.EvaluateRunTask(periodicInfo, content, "/opt/app"))
+}
+
+func TestCommandPolicyEvaluateSendFileAndSession(t *testing.T) {
+	policy := loadTestPolicy(t)
+	assert.NoError(t, policy.EvaluateSendFile("/opt/app/conf/nginx"))
+	assertDeniedByRule(t, "allowedFileDestinations", policy.EvaluateSendFile("/etc"))
+
+	assert.NoError(t, policy.EvaluateSession("app", false))
+	assertDeniedByRule(t, "denyPortForwarding", policy.EvaluateSession("app", true))
+	assertDeniedByRule(t, "denyUsers", policy.EvaluateSession("root", false))
+
+	policy.DenySessions = true
+	assertDeniedByRule(t, "denySessions", policy.EvaluateSession("app", false))
+}
+
+func TestCommandPolicyResolvesSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symbolic links requires privilege on Windows")
+	}
+	dir, err := ioutil.TempDir("", "policy")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	allowedDir := filepath.Join(dir, "allowed")
+	assert.NoError(t, os.Mkdir(allowedDir, 0755))
+	outsideDir := filepath.Join(dir, "outside")
+	assert.NoError(t, os.Mkdir(outsideDir, 0755))
+	assert.NoError(t, os.Symlink(outsideDir, filepath.Join(allowedDir, "escape")))
+	assert.NoError(t, os.Symlink(allowedDir, filepath.Join(dir, "alias")))
+
+	policy := &CommandPolicy{AllowedFileDestinations: []string{allowedDir}}
+	assert.NoError(t, policy.EvaluateSendFile(filepath.Join(allowedDir, "conf")))
+	assert.NoError(t, policy.EvaluateSendFile(filepath.Join(dir, "alias", "new", "conf")))
+	assertDeniedByRule(t, "allowedFileDestinations", policy.EvaluateSendFile(filepath.Join(allowedDir, "escape")))
+	assertDeniedByRule(t, "allowedFileDestinations", policy.EvaluateSendFile(filepath.Join(allowedDir, "escape", "new")))
+
+	// Dangling symbolic link is followed to where file would be created
+	assert.NoError(t, os.Symlink(filepath.Join(outsideDir, "new"), filepath.Join(allowedDir, "dangling")))
+	assert.NoError(t, os.Symlink("../outside/new", filepath.Join(allowedDir, "relative")))
+	assertDeniedByRule(t, "allowedFileDestinations", policy.EvaluateSendFile(filepath.Join(allowedDir, "dangling")))
+	assertDeniedByRule(t, "allowedFileDestinations", policy.EvaluateSendFile(filepath.Join(allowedDir, "relative", "conf")))
+}
+
+func TestCommandPolicyInvalidPattern(t *testing.T) {
+	policy := &CommandPolicy{DenyContentPatterns: []string{"("}}
+	assert.True(t, errors.Is(policy.compile(), ErrInvalidPolicy))
+}
+
+func TestRunTaskDeniedByResolvedContent(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	guardPolicy := monkey.Patch(loadCommandPolicy, func() (*CommandPolicy, error) {
+		policy := &CommandPolicy{DenyContentPatterns: []string{`rm\s+-rf\s+/`}}
+		return policy, policy.compile()
+	})
+	defer guardPolicy.Unpatch()
+	var reportedService, reportedQuerystring string
+	guardReport := monkey.Patch(postTaskReport, func(service string, querystring string, output string, contentType string) (string, error) {
+		reportedService, reportedQuerystring = service, querystring
+		return "", nil
+	})
+	defer guardReport.Unpatch()
+	guardHttpPost := monkey.Patch(util.HttpPost, func(string, string, string) (string, error) { return "", nil })
+	defer guardHttpPost.Unpatch()
+
+	// Denied pattern is hidden in parameter value, thus only found after
+	// content is resolved
+	taskInfo := RunTaskInfo{
+		InstanceId:      "i-test",
+		CommandType:     "RunShellScript",
+		TaskId:          "t-policy-resolved",
+		TimeOut:         "60",
+		Content:         base64.StdEncoding.EncodeToString([]byte("{{ACS::cmd}}")),
+		EnableParameter: true,
+		EnvironmentArguments: map[string]string{
+			"cmd": "rm -rf /",
+		},
+	}
+	code, err := NewTask(taskInfo, nil, nil).Run()
+	assert.Equal(t, wrapErrPolicyDenied, code)
+	assertDeniedByRule(t, "denyContentPatterns", err)
+	assert.Equal(t, reportServiceError, reportedService)
+	assert.Contains(t, reportedQuerystring, "errDesc=PolicyDenied")
+}
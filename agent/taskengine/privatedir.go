@@ -0,0 +1,45 @@
+package taskengine
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	privateDirConfigFilename = "task_private_dir.json"
+
+	// Name of base directory under script directory of agent by default
+	defaultPrivateBaseDirName = "private"
+)
+
+var (
+	ErrPrivateDirUnsupported = errors.New("Private invocation directory is not supported on this platform")
+	ErrUnsafePrivateBaseDir  = errors.New("Base directory of private invocation directories is not safe")
+)
+
+// PrivateDirConfig is loaded from task_private_dir.json in config directory
+type PrivateDirConfig struct {
+	// Base directory where private directories of invocations run as
+	// specified user are created
+	BaseDir string `json:"baseDir"`
+}
+
+func getPrivateBaseDir() (string, error) {
+	config := PrivateDirConfig{}
+	if _, err := loadTaskConfigFile(privateDirConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", privateDirConfigFilename)
+		config = PrivateDirConfig{}
+	}
+	if config.BaseDir != "" {
+		return filepath.Clean(config.BaseDir), nil
+	}
+
+	scriptDir, err := util.GetScriptPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(scriptDir, defaultPrivateBaseDirName), nil
+}
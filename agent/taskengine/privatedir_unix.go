@@ -0,0 +1,141 @@
+// +build linux freebsd
+
+package taskengine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/aliyun/aliyun_assist_client/agent/taskengine/scriptmanager"
+)
+
+// privateInvocationDir is directory owned by the user whom invocation runs as
+// with 0700 permission, which holds script and serves as default working
+// directory. It is removed as a whole after invocation.
+type privateInvocationDir struct {
+	path string
+	uid  int
+	gid  int
+}
+
+// ensurePrivateBaseDir creates base directory owned by agent which other users
+// could traverse but not list or write, and refuses unsafe existing one
+func ensurePrivateBaseDir(baseDir string) error {
+	if err := os.MkdirAll(baseDir, 0711); err != nil {
+		return err
+	}
+	info, err := os.Lstat(baseDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrUnsafePrivateBaseDir, baseDir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Geteuid() {
+		return fmt.Errorf("%w: %s is owned by uid %d", ErrUnsafePrivateBaseDir, baseDir, stat.Uid)
+	}
+	if info.Mode().Perm() != 0711 {
+		return os.Chmod(baseDir, 0711)
+	}
+	return nil
+}
+
+// ensureInvocationBaseDir creates dedicated base directory of sandbox or result
+// file directories the same as base of private invocation directories. Its
+// parent may be configured and shared with others, thus is only created when
+// missing but never modified.
+func ensureInvocationBaseDir(baseDir string) error {
+	if err := os.MkdirAll(filepath.Dir(baseDir), 0755); err != nil {
+		return err
+	}
+	return ensurePrivateBaseDir(baseDir)
+}
+
+// invocationDirOwner returns uid and gid of specified user, or those of agent
+// when no user is specified
+func invocationDirOwner(username string) (int, int, error) {
+	if username == "" {
+		return os.Geteuid(), os.Getegid(), nil
+	}
+	specifiedUser, err := user.Lookup(username)
+	if err != nil {
+		return 0, 0, err
+	}
+	uid, err := strconv.Atoi(specifiedUser.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := strconv.Atoi(specifiedUser.Gid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
+
+// chownInvocationDir hands directory created by agent over to the user whom
+// invocation runs as
+func chownInvocationDir(path string, uid int, gid int) error {
+	if uid == os.Geteuid() && gid == os.Getegid() {
+		return nil
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+func createPrivateInvocationDir(taskId string, username string) (*privateInvocationDir, error) {
+	specifiedUser, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(specifiedUser.Uid)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.Atoi(specifiedUser.Gid)
+	if err != nil {
+		return nil, err
+	}
+
+	baseDir, err := getPrivateBaseDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensurePrivateBaseDir(baseDir); err != nil {
+		return nil, err
+	}
+
+	// Directory is created with 0700 permission and unpredictable name
+	path, err := ioutil.TempDir(baseDir, taskId+"-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Lchown(path, uid, gid); err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+	return &privateInvocationDir{
+		path: path,
+		uid:  uid,
+		gid:  gid,
+	}, nil
+}
+
+// saveScript writes script into private directory exclusively, and makes it
+// owned by the user
+func (d *privateInvocationDir) saveScript(scriptPath string, content string) error {
+	if filepath.Dir(scriptPath) != d.path {
+		return fmt.Errorf("%w: %s is not in private directory", ErrUnsafePrivateBaseDir, scriptPath)
+	}
+	if err := scriptmanager.SaveScriptFileExclusive(scriptPath, content, 0700); err != nil {
+		return err
+	}
+	return os.Lchown(scriptPath, d.uid, d.gid)
+}
+
+func (d *privateInvocationDir) remove() error {
+	return os.RemoveAll(d.path)
+}
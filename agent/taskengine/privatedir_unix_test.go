@@ -0,0 +1,60 @@
+// +build linux freebsd
+
+package taskengine
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/taskengine/scriptmanager"
+)
+
+func TestPrivateInvocationDir(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "private_dir")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	defer setupTaskFileDirs(t)()
+	baseDir, err := getPrivateBaseDir()
+	assert.NoError(t, err)
+
+	currentUser, err := user.Current()
+	assert.NoError(t, err)
+	privateDir, err := createPrivateInvocationDir("t-private", currentUser.Username)
+	assert.NoError(t, err)
+
+	baseInfo, err := os.Stat(baseDir)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0711), baseInfo.Mode().Perm())
+	dirInfo, err := os.Stat(privateDir.path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+
+	scriptPath := filepath.Join(privateDir.path, "t-private.sh")
+	assert.NoError(t, privateDir.saveScript(scriptPath, "echo hello"))
+	content, err := ioutil.ReadFile(scriptPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo hello", string(content))
+	assert.Equal(t, scriptmanager.ErrScriptFileExists, privateDir.saveScript(scriptPath, "echo again"))
+	assert.Error(t, privateDir.saveScript(filepath.Join(tempDir, "outside.sh"), "echo outside"))
+
+	assert.NoError(t, privateDir.remove())
+	assert.NoDirExists(t, privateDir.path)
+}
+
+func TestSaveScriptFileExclusiveRefusesSymlink(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "script_exclusive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	target := filepath.Join(tempDir, "target")
+	link := filepath.Join(tempDir, "link.sh")
+	assert.NoError(t, os.Symlink(target, link))
+	assert.Error(t, scriptmanager.SaveScriptFileExclusive(link, "echo hello", 0700))
+	assert.NoFileExists(t, target)
+}
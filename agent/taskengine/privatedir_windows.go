@@ -0,0 +1,35 @@
+package taskengine
+
+import (
+	"os"
+)
+
+type privateInvocationDir struct {
+	path string
+}
+
+func createPrivateInvocationDir(taskId string, username string) (*privateInvocationDir, error) {
+	return nil, ErrPrivateDirUnsupported
+}
+
+func (d *privateInvocationDir) saveScript(scriptPath string, content string) error {
+	return ErrPrivateDirUnsupported
+}
+
+func (d *privateInvocationDir) remove() error {
+	return ErrPrivateDirUnsupported
+}
+
+func ensureInvocationBaseDir(baseDir string) error {
+	return os.MkdirAll(baseDir, 0700)
+}
+
+// invocationDirOwner is not needed on Windows, where directory of invocation
+// inherits permission of base directory
+func invocationDirOwner(username string) (int, int, error) {
+	return -1, -1, nil
+}
+
+func chownInvocationDir(path string, uid int, gid int) error {
+	return nil
+}
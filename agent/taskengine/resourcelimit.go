@@ -0,0 +1,90 @@
+package taskengine
+
+import (
+	"fmt"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+)
+
+const (
+	// Agent-side default resource limitation policy for invocations, which is
+	// applied when not specified in task
+	resourceLimitConfigFilename = "task_resource_limit.json"
+)
+
+// ResourceLimitInfo describes limitation of resources which processes of one
+// invocation could use. Zero value of field means no limitation.
+type ResourceLimitInfo struct {
+	// Percentage of one CPU core, e.g., 150 means 1.5 cores at most
+	CpuLimit int64 `json:"cpuLimit"`
+	// Maximum memory usage in bytes
+	MemoryLimit int64 `json:"memoryLimit"`
+	// Maximum number of processes
+	PidsLimit int64 `json:"pidsLimit"`
+}
+
+// ResourceUsage contains resource usage statistics of one invocation collected
+// from its control group
+type ResourceUsage struct {
+	// Peak memory usage in bytes
+	PeakMemory uint64
+	// Total CPU time consumed in milliseconds
+	CpuTime uint64
+	// Whether any process of invocation has been killed by OOM killer
+	OomKilled bool
+}
+
+func (r *ResourceLimitInfo) IsEmpty() bool {
+	return r.CpuLimit <= 0 && r.MemoryLimit <= 0 && r.PidsLimit <= 0
+}
+
+// effectiveResourceLimit merges resource limitation specified in task with the
+// agent-side default policy, and returns nil when no limitation is needed.
+func (task *Task) effectiveResourceLimit() *ResourceLimitInfo {
+	limit := task.taskInfo.ResourceLimit
+
+	var defaultLimit ResourceLimitInfo
+	if _, err := loadTaskConfigFile(resourceLimitConfigFilename, &defaultLimit); err != nil {
+		log.GetLogger().WithError(err).Errorln("Failed to load default resource limitation policy for invocations")
+	}
+	if limit.CpuLimit <= 0 {
+		limit.CpuLimit = defaultLimit.CpuLimit
+	}
+	if limit.MemoryLimit <= 0 {
+		limit.MemoryLimit = defaultLimit.MemoryLimit
+	}
+	if limit.PidsLimit <= 0 {
+		limit.PidsLimit = defaultLimit.PidsLimit
+	}
+
+	if limit.IsEmpty() {
+		return nil
+	}
+	return &limit
+}
+
+func (task *Task) setCgroup(invocationCgroup *invocationCgroup) {
+	task.cgroupMut.Lock()
+	defer task.cgroupMut.Unlock()
+	task.cgroup = invocationCgroup
+}
+
+// takeCgroup detaches control group from invocation, and only the caller
+// getting non-nil one could destroy it
+func (task *Task) takeCgroup() *invocationCgroup {
+	task.cgroupMut.Lock()
+	defer task.cgroupMut.Unlock()
+	invocationCgroup := task.cgroup
+	task.cgroup = nil
+	return invocationCgroup
+}
+
+// Generate additional querystring parameters of resource usage statistics,
+// which would be empty when invocation is not run under control group
+func (task *Task) resourceUsageQueryParams() string {
+	if task.resourceUsage == nil {
+		return ""
+	}
+	return fmt.Sprintf("&peakMemory=%d&cpuTime=%d&oomKilled=%t", task.resourceUsage.PeakMemory,
+		task.resourceUsage.CpuTime, task.resourceUsage.OomKilled)
+}
@@ -0,0 +1,100 @@
+package taskengine
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/aliyun/aliyun_assist_client/agent/cgroup"
+)
+
+const (
+	invocationCgroupParent = "aliyun_assist_task"
+	defaultCpuPeriod       = 100000
+)
+
+// invocationCgroup wraps control groups which processes of one invocation are
+// placed in
+type invocationCgroup struct {
+	manager *cgroup.Manager
+}
+
+// newInvocationCgroup creates control groups with limitation applied, which is
+// done before the process is started thus it could not escape from limitation
+func newInvocationCgroup(name string, limit *ResourceLimitInfo) (*invocationCgroup, error) {
+	enabledSubsystems, err := cgroup.GetEnabledSubsystems()
+	if err != nil {
+		return nil, err
+	}
+
+	// memory and cpuacct subsystems are always used for statistics of usage
+	var subsystems []string
+	candidates := map[string]bool{
+		"cpu":     limit.CpuLimit > 0,
+		"cpuacct": true,
+		"memory":  true,
+		"pids":    limit.PidsLimit > 0,
+	}
+	for _, s := range []string{"cpu", "cpuacct", "memory", "pids"} {
+		if !candidates[s] {
+			continue
+		}
+		if _, ok := enabledSubsystems[s]; !ok {
+			if s == "cpuacct" {
+				continue
+			}
+			return nil, fmt.Errorf("Subsystem %s is not enabled", s)
+		}
+		subsystems = append(subsystems, s)
+	}
+
+	manager, err := cgroup.NewManager(0, filepath.Join(invocationCgroupParent, name), subsystems...)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &cgroup.Config{
+		MemoryLimit: limit.MemoryLimit,
+		PidsLimit:   limit.PidsLimit,
+	}
+	if limit.CpuLimit > 0 {
+		config.CpuPeriod = defaultCpuPeriod
+		config.CpuQuota = defaultCpuPeriod * limit.CpuLimit / 100
+	}
+	if err := manager.Set(config); err != nil {
+		manager.Destroy()
+		return nil, err
+	}
+
+	return &invocationCgroup{
+		manager: manager,
+	}, nil
+}
+
+// attach places the process into control groups, which should be done before
+// the process could fork
+func (c *invocationCgroup) attach(pid int) error {
+	return c.manager.Apply(pid)
+}
+
+func (c *invocationCgroup) collectUsage() (*ResourceUsage, error) {
+	var stats cgroup.Stats
+	if err := c.manager.GetStats(&stats); err != nil {
+		return nil, err
+	}
+
+	return &ResourceUsage{
+		PeakMemory: stats.MemoryStats.MaxUsage,
+		CpuTime:    stats.CpuStats.CpuUsage.TotalUsage / 1000000,
+		OomKilled:  stats.MemoryStats.OomKill > 0,
+	}, nil
+}
+
+func (c *invocationCgroup) kill() error {
+	return c.manager.Kill()
+}
+
+// destroy removes control groups, which fails with cgroup.ErrCgroupNotEmpty
+// when processes are left in them, e.g. daemons started by invocation
+func (c *invocationCgroup) destroy() error {
+	return c.manager.Destroy()
+}
@@ -0,0 +1,41 @@
+package taskengine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveResourceLimit(t *testing.T) {
+	task := NewTask(RunTaskInfo{
+		TaskId: "t-test",
+	}, nil, nil)
+	assert.Nil(t, task.effectiveResourceLimit())
+
+	task = NewTask(RunTaskInfo{
+		TaskId: "t-test",
+		ResourceLimit: ResourceLimitInfo{
+			CpuLimit:    50,
+			MemoryLimit: 64 * 1024 * 1024,
+		},
+	}, nil, nil)
+	limit := task.effectiveResourceLimit()
+	assert.NotNil(t, limit)
+	assert.Equal(t, int64(50), limit.CpuLimit)
+	assert.Equal(t, int64(64*1024*1024), limit.MemoryLimit)
+	assert.Equal(t, int64(0), limit.PidsLimit)
+}
+
+func TestResourceUsageQueryParams(t *testing.T) {
+	task := NewTask(RunTaskInfo{
+		TaskId: "t-test",
+	}, nil, nil)
+	assert.Equal(t, "", task.resourceUsageQueryParams())
+
+	task.resourceUsage = &ResourceUsage{
+		PeakMemory: 1024,
+		CpuTime:    15,
+		OomKilled:  true,
+	}
+	assert.Equal(t, "&peakMemory=1024&cpuTime=15&oomKilled=true", task.resourceUsageQueryParams())
+}
@@ -0,0 +1,34 @@
+// +build !linux
+
+package taskengine
+
+import (
+	"errors"
+)
+
+var (
+	errCgroupNotSupported = errors.New("Control group is not supported on this operating system")
+)
+
+// invocationCgroup is currently not supported on this operating system
+type invocationCgroup struct{}
+
+func newInvocationCgroup(name string, limit *ResourceLimitInfo) (*invocationCgroup, error) {
+	return nil, errCgroupNotSupported
+}
+
+func (c *invocationCgroup) attach(pid int) error {
+	return errCgroupNotSupported
+}
+
+func (c *invocationCgroup) collectUsage() (*ResourceUsage, error) {
+	return nil, errCgroupNotSupported
+}
+
+func (c *invocationCgroup) kill() error {
+	return errCgroupNotSupported
+}
+
+func (c *invocationCgroup) destroy() error {
+	return nil
+}
@@ -0,0 +1,210 @@
+package taskengine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	resultFileConfigFilename = "task_result_file.json"
+
+	// Name of base directory under script directory of agent by default
+	defaultResultBaseDirName = "result"
+	// Name of base directory created by agent under configured directory,
+	// which may be shared with others and thus is never modified or collected
+	// itself
+	dedicatedResultBaseDirName = "aliyun_assist_result"
+	resultFileName             = "result.json"
+
+	// 4KB, since structured result is reported in querystring
+	defaultResultFileMaxSize = 4 * 1024
+
+	// Environment variable exposing path of result file to command process
+	resultFileEnvName = "ASSIST_RESULT_FILE"
+)
+
+var (
+	ErrResultFileTooLarge   = errors.New("ResultFileTooLarge")
+	ErrResultFileInvalid    = errors.New("ResultFileInvalid")
+	ErrResultFileNotRegular = errors.New("ResultFileNotRegular")
+)
+
+// ResultFileConfig is loaded from task_result_file.json in config directory
+type ResultFileConfig struct {
+	Disabled bool `json:"disabled"`
+	// Directory under which dedicated base directory of result directories of
+	// invocations is created
+	BaseDir string `json:"baseDir"`
+	// Maximum size in bytes of result file
+	MaxSize int64 `json:"maxSize"`
+}
+
+// resultFileDir holds result file of one invocation, owned by the user whom
+// invocation runs as with 0700 permission, and is removed after invocation
+type resultFileDir struct {
+	path string
+}
+
+func loadResultFileConfig() ResultFileConfig {
+	config := ResultFileConfig{}
+	if _, err := loadTaskConfigFile(resultFileConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", resultFileConfigFilename)
+		config = ResultFileConfig{}
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultResultFileMaxSize
+	}
+	return config
+}
+
+func getResultBaseDir() (string, error) {
+	config := loadResultFileConfig()
+	if config.BaseDir != "" {
+		return filepath.Join(filepath.Clean(config.BaseDir), dedicatedResultBaseDirName), nil
+	}
+
+	scriptDir, err := util.GetScriptPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(scriptDir, defaultResultBaseDirName), nil
+}
+
+// createResultFileDir creates directory in which command process could write
+// result file, secured the same way as sandbox directory
+func createResultFileDir(taskId string, username string) (*resultFileDir, error) {
+	baseDir, err := getResultBaseDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureInvocationBaseDir(baseDir); err != nil {
+		return nil, err
+	}
+
+	// Directory is created with 0700 permission and unpredictable name, which
+	// is also recognized by garbage collection of saved scripts
+	path, err := ioutil.TempDir(baseDir, taskId+"-")
+	if err != nil {
+		return nil, err
+	}
+	uid, gid, err := invocationDirOwner(username)
+	if err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+	if err := chownInvocationDir(path, uid, gid); err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+	return &resultFileDir{
+		path: path,
+	}, nil
+}
+
+func (d *resultFileDir) filePath() string {
+	return filepath.Join(d.path, resultFileName)
+}
+
+func (d *resultFileDir) remove() error {
+	return os.RemoveAll(d.path)
+}
+
+// readResultFile returns compacted JSON object in result file, or empty string
+// when command process has not written it. Symbolic links and other special
+// files are refused since the file is read with privilege of agent.
+func readResultFile(path string, maxSize int64) (string, error) {
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return "", ErrResultFileNotRegular
+	}
+	if fileInfo.Size() > maxSize {
+		return "", fmt.Errorf("%w: %d bytes exceeds limit of %d bytes", ErrResultFileTooLarge, fileInfo.Size(), maxSize)
+	}
+
+	file, err := openResultFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	// The file may be replaced between Lstat and open
+	if openedInfo, err := file.Stat(); err != nil {
+		return "", err
+	} else if !openedInfo.Mode().IsRegular() || !os.SameFile(fileInfo, openedInfo) {
+		return "", ErrResultFileNotRegular
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(content)) > maxSize {
+		return "", fmt.Errorf("%w: exceeds limit of %d bytes", ErrResultFileTooLarge, maxSize)
+	}
+
+	// Only JSON object is accepted as key/value result
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !json.Valid(trimmed) {
+		return "", fmt.Errorf("%w: content is not a JSON object", ErrResultFileInvalid)
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, trimmed); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrResultFileInvalid, err.Error())
+	}
+	return compacted.String(), nil
+}
+
+// collectResult reads result file written by command process of the latest
+// attempt
+func (task *Task) collectResult(taskLogger logrus.FieldLogger) {
+	if task.resultFilePath == "" {
+		return
+	}
+	config := loadResultFileConfig()
+	result, err := readResultFile(task.resultFilePath, config.MaxSize)
+	if err != nil {
+		task.resultErr = err
+		taskLogger.WithError(err).Warningln("Invalid result file written by invocation")
+		return
+	}
+	task.result = result
+	if result != "" {
+		taskLogger.Infof("Collected structured result of invocation: %d bytes", len(result))
+	}
+}
+
+// resultQueryParams generates additional querystring parameters of structured
+// result, or why result file is rejected
+func (task *Task) resultQueryParams() string {
+	if task.resultErr != nil {
+		reason := "ReadFailed"
+		for _, knownErr := range []error{ErrResultFileTooLarge, ErrResultFileInvalid, ErrResultFileNotRegular} {
+			if errors.Is(task.resultErr, knownErr) {
+				reason = knownErr.Error()
+				break
+			}
+		}
+		return "&structuredResultError=" + reason
+	}
+	if task.result == "" {
+		return ""
+	}
+	// Secrets are masked the same as in output
+	return "&structuredResult=" + url.QueryEscape(task.redactor.Redact(task.result))
+}
@@ -0,0 +1,148 @@
+package taskengine
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util/stringutil"
+)
+
+func TestCreateResultFileDir(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	baseDir, err := getResultBaseDir()
+	assert.NoError(t, err)
+
+	resultDir, err := createResultFileDir("t-result", "")
+	assert.NoError(t, err)
+	assert.Equal(t, baseDir, filepath.Dir(resultDir.path))
+	assert.True(t, strings.HasPrefix(filepath.Base(resultDir.path), "t-result-"))
+	assert.Equal(t, filepath.Join(resultDir.path, resultFileName), resultDir.filePath())
+	info, err := os.Stat(resultDir.path)
+	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	}
+
+	assert.NoError(t, ioutil.WriteFile(resultDir.filePath(), []byte("{}"), 0600))
+	assert.NoError(t, resultDir.remove())
+	_, err = os.Stat(resultDir.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCreateResultFileDirUnderConfiguredDir(t *testing.T) {
+	configuredDir, err := ioutil.TempDir("", "shared")
+	assert.NoError(t, err)
+	defer os.RemoveAll(configuredDir)
+	assert.NoError(t, os.Chmod(configuredDir, 0777|os.ModeSticky))
+	guard := monkey.Patch(loadResultFileConfig, func() ResultFileConfig {
+		return ResultFileConfig{
+			BaseDir: configuredDir,
+			MaxSize: defaultResultFileMaxSize,
+		}
+	})
+	defer guard.Unpatch()
+
+	// Result directories are created in dedicated base directory, while
+	// configured directory is left untouched
+	resultDir, err := createResultFileDir("t-result", "")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(configuredDir, dedicatedResultBaseDirName), filepath.Dir(resultDir.path))
+	info, err := os.Stat(configuredDir)
+	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0777)|os.ModeSticky, info.Mode()&(os.ModePerm|os.ModeSticky))
+	}
+	assert.NoError(t, resultDir.remove())
+}
+
+func TestReadResultFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "result")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, resultFileName)
+
+	result, err := readResultFile(path, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, "", result)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{\n  \"passed\": 12,\n  \"failed\": [\"a b\"]\n}\n"), 0600))
+	result, err = readResultFile(path, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"passed":12,"failed":["a b"]}`, result)
+
+	_, err = readResultFile(path, 16)
+	assert.ErrorIs(t, err, ErrResultFileTooLarge)
+
+	for _, content := range []string{"", "  ", "[1, 2]", "\"ok\"", "{\"passed\": ", "passed=12"} {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		_, err = readResultFile(path, 64)
+		assert.ErrorIs(t, err, ErrResultFileInvalid, content)
+	}
+
+	if runtime.GOOS != "windows" {
+		secretPath := filepath.Join(dir, "secret")
+		assert.NoError(t, ioutil.WriteFile(secretPath, []byte("{\"secret\": true}"), 0600))
+		assert.NoError(t, os.Remove(path))
+		assert.NoError(t, os.Symlink(secretPath, path))
+		_, err = readResultFile(path, 64)
+		assert.ErrorIs(t, err, ErrResultFileNotRegular)
+	}
+}
+
+func TestResultQueryParams(t *testing.T) {
+	task := NewTask(RunTaskInfo{TaskId: "t-result"}, nil, nil)
+	assert.Equal(t, "", task.resultQueryParams())
+
+	task.result = `{"passed":12,"token":"s3cr3t"}`
+	task.redactor = stringutil.NewRedactor([]string{"s3cr3t"})
+	params, err := url.ParseQuery(strings.TrimPrefix(task.resultQueryParams(), "&"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"passed":12,"token":"******"}`, params.Get("structuredResult"))
+
+	record := task.newHistoryRecord(reportServiceFinish, "?taskId=t-result", "", 0)
+	assert.Equal(t, `{"passed":12,"token":"******"}`, record.Result)
+	assert.Contains(t, record.Detail(), `Result:            {"passed":12,"token":"******"}`)
+
+	task.resultErr = ErrResultFileTooLarge
+	assert.Equal(t, "&structuredResultError=ResultFileTooLarge", task.resultQueryParams())
+	task.resultErr = errors.New("permission denied")
+	assert.Equal(t, "&structuredResultError=ReadFailed", task.resultQueryParams())
+}
+
+func TestRunTaskWithResultFile(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shell script is only run on Linux in this test")
+	}
+	defer setupTaskFileDirs(t)()
+	baseDir, err := getResultBaseDir()
+	assert.NoError(t, err)
+
+	script := `printf '{"passed": 3, "failed": 0}' > "$ASSIST_RESULT_FILE"; echo done`
+	service, querystring, output := runShellTaskForReport(t, script, func(*RunTaskInfo) {})
+	assert.Equal(t, reportServiceFinish, service)
+	assert.Equal(t, "done\n", output)
+	params, err := url.ParseQuery(querystring[strings.Index(querystring, "?")+1:])
+	assert.NoError(t, err)
+	assert.Equal(t, `{"passed":3,"failed":0}`, params.Get("structuredResult"))
+
+	// Directory of result file is removed after invocation
+	entries, err := ioutil.ReadDir(baseDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0)
+
+	_, querystring, _ = runShellTaskForReport(t, `echo not-json > "$ASSIST_RESULT_FILE"`, func(*RunTaskInfo) {})
+	assert.Contains(t, querystring, "&structuredResultError=ResultFileInvalid")
+	assert.NotContains(t, querystring, "&structuredResult=")
+
+	_, querystring, _ = runShellTaskForReport(t, "echo no result", func(*RunTaskInfo) {})
+	assert.NotContains(t, querystring, "structuredResult")
+}
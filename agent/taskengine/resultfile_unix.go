@@ -0,0 +1,14 @@
+// +build linux freebsd
+
+package taskengine
+
+import (
+	"os"
+	"syscall"
+)
+
+// openResultFile fails on symbolic link, and never blocks on FIFO swapped in
+// place of result file by leftover processes of invocation
+func openResultFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+}
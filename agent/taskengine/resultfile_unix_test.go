@@ -0,0 +1,52 @@
+// +build linux freebsd
+
+package taskengine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadResultFileRefusesFifo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "result")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, resultFileName)
+
+	assert.NoError(t, syscall.Mkfifo(path, 0600))
+	_, err = readResultFile(path, 64)
+	assert.ErrorIs(t, err, ErrResultFileNotRegular)
+
+	// Result file is replaced by FIFO between Lstat and open, which must not
+	// block agent
+	assert.NoError(t, os.Remove(path))
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{}"), 0600))
+	var guard *monkey.PatchGuard
+	guard = monkey.Patch(os.Lstat, func(name string) (os.FileInfo, error) {
+		guard.Unpatch()
+		fileInfo, err := os.Lstat(name)
+		assert.NoError(t, os.Remove(name))
+		assert.NoError(t, syscall.Mkfifo(name, 0600))
+		return fileInfo, err
+	})
+	defer guard.Unpatch()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := readResultFile(path, 64)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		assert.ErrorIs(t, err, ErrResultFileNotRegular)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reading FIFO swapped in place of result file blocks")
+	}
+}
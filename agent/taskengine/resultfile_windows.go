@@ -0,0 +1,9 @@
+package taskengine
+
+import (
+	"os"
+)
+
+func openResultFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
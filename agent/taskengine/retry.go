@@ -0,0 +1,129 @@
+package taskengine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util/process"
+)
+
+const (
+	maxRetryAttempts = 10
+
+	defaultRetryBackoff    = 5
+	defaultRetryMaxBackoff = 300
+
+	// Interval of checking cancellation while waiting for next attempt
+	retryCancelCheckInterval = 200 * time.Millisecond
+)
+
+// RetryPolicyInfo makes failed invocation rerun locally. Every attempt has its
+// own timeout, and output of all attempts is reported together separated by
+// marker lines.
+type RetryPolicyInfo struct {
+	// Total attempts including the first one, thus 0 or 1 means no retry
+	MaxAttempts int `json:"maxAttempts"`
+	// Seconds waited before the second attempt, which is doubled for each
+	// following attempt until MaxBackoff seconds
+	Backoff    int `json:"backoff"`
+	MaxBackoff int `json:"maxBackoff"`
+	// Exit codes which trigger retry. Any non-zero exit code triggers retry
+	// when not specified.
+	RetryOnExitCodes []int `json:"retryOnExitCodes"`
+	RetryOnTimeout   bool  `json:"retryOnTimeout"`
+}
+
+func (p *RetryPolicyInfo) maxAttempts() int {
+	if p.MaxAttempts <= 1 {
+		return 1
+	}
+	if p.MaxAttempts > maxRetryAttempts {
+		return maxRetryAttempts
+	}
+	return p.MaxAttempts
+}
+
+// shouldRetry decides whether another attempt is needed after specified
+// attempt ended with status and exit code
+func (p *RetryPolicyInfo) shouldRetry(attempt int, status int, exitCode int) bool {
+	if attempt >= p.maxAttempts() {
+		return false
+	}
+	switch status {
+	case process.Timeout, process.IdleTimeout:
+		return p.RetryOnTimeout
+	case process.Success:
+		// Special exit codes instruct agent to poweroff or reboot instance,
+		// which are never considered as failure
+		if exitCode == 0 || exitCode == exitcodePoweroff || exitCode == exitcodeReboot {
+			return false
+		}
+		if len(p.RetryOnExitCodes) == 0 {
+			return true
+		}
+		for _, retryOnExitCode := range p.RetryOnExitCodes {
+			if exitCode == retryOnExitCode {
+				return true
+			}
+		}
+		return false
+	default:
+		// Process failed to start, and retry would not help
+		return false
+	}
+}
+
+// backoff returns duration to wait after specified attempt failed
+func (p *RetryPolicyInfo) backoff(attempt int) time.Duration {
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return time.Duration(backoff) * time.Second
+}
+
+// retryAttemptMarker is written into output between attempts
+func retryAttemptMarker(attempt int, status int, exitCode int, backoff time.Duration) string {
+	ending := fmt.Sprintf("exited with code %d", exitCode)
+	if status == process.Timeout {
+		ending = "timed out"
+	} else if status == process.IdleTimeout {
+		ending = "timed out without output"
+	}
+	return fmt.Sprintf("\n[Aliyun Assist: attempt %d %s, retry in %d seconds]\n", attempt, ending, int(backoff/time.Second))
+}
+
+// waitRetryBackoff returns false when invocation is canceled during waiting
+func (task *Task) waitRetryBackoff(backoff time.Duration) bool {
+	deadline := time.Now().Add(backoff)
+	for time.Now().Before(deadline) {
+		if task.IsCancled() {
+			return false
+		}
+		wait := time.Until(deadline)
+		if wait > retryCancelCheckInterval {
+			wait = retryCancelCheckInterval
+		}
+		time.Sleep(wait)
+	}
+	return !task.IsCancled()
+}
+
+// retryQueryParams generates additional querystring parameter of attempt
+// count, only for invocations with retry policy
+func (task *Task) retryQueryParams() string {
+	if task.taskInfo.Retry.maxAttempts() <= 1 || task.attempts == 0 {
+		return ""
+	}
+	return fmt.Sprintf("&attempts=%d", task.attempts)
+}
@@ -0,0 +1,191 @@
+package taskengine
+
+import (
+	"encoding/base64"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+	"github.com/aliyun/aliyun_assist_client/agent/util/process"
+)
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	noRetry := RetryPolicyInfo{}
+	assert.False(t, noRetry.shouldRetry(1, process.Success, 1))
+
+	anyExitCode := RetryPolicyInfo{MaxAttempts: 3}
+	assert.True(t, anyExitCode.shouldRetry(1, process.Success, 1))
+	assert.True(t, anyExitCode.shouldRetry(2, process.Success, 255))
+	assert.False(t, anyExitCode.shouldRetry(3, process.Success, 1))
+	assert.False(t, anyExitCode.shouldRetry(1, process.Success, 0))
+	assert.False(t, anyExitCode.shouldRetry(1, process.Success, exitcodePoweroff))
+	assert.False(t, anyExitCode.shouldRetry(1, process.Success, exitcodeReboot))
+	assert.False(t, anyExitCode.shouldRetry(1, process.Timeout, 1))
+	assert.False(t, anyExitCode.shouldRetry(1, process.Fail, 1))
+
+	specifiedExitCodes := RetryPolicyInfo{
+		MaxAttempts:      3,
+		RetryOnExitCodes: []int{2, 75},
+		RetryOnTimeout:   true,
+	}
+	assert.True(t, specifiedExitCodes.shouldRetry(1, process.Success, 75))
+	assert.False(t, specifiedExitCodes.shouldRetry(1, process.Success, 1))
+	assert.True(t, specifiedExitCodes.shouldRetry(2, process.Timeout, 1))
+	assert.False(t, specifiedExitCodes.shouldRetry(3, process.Timeout, 1))
+	assert.True(t, specifiedExitCodes.shouldRetry(1, process.IdleTimeout, 1))
+	assert.False(t, anyExitCode.shouldRetry(1, process.IdleTimeout, 1))
+
+	tooManyAttempts := RetryPolicyInfo{MaxAttempts: 100}
+	assert.True(t, tooManyAttempts.shouldRetry(maxRetryAttempts-1, process.Success, 1))
+	assert.False(t, tooManyAttempts.shouldRetry(maxRetryAttempts, process.Success, 1))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	defaultPolicy := RetryPolicyInfo{MaxAttempts: 5}
+	assert.Equal(t, defaultRetryBackoff*time.Second, defaultPolicy.backoff(1))
+	assert.Equal(t, 2*defaultRetryBackoff*time.Second, defaultPolicy.backoff(2))
+	assert.Equal(t, 4*defaultRetryBackoff*time.Second, defaultPolicy.backoff(3))
+
+	policy := RetryPolicyInfo{
+		MaxAttempts: 10,
+		Backoff:     10,
+		MaxBackoff:  60,
+	}
+	assert.Equal(t, 10*time.Second, policy.backoff(1))
+	assert.Equal(t, 40*time.Second, policy.backoff(3))
+	assert.Equal(t, 60*time.Second, policy.backoff(4))
+	assert.Equal(t, 60*time.Second, policy.backoff(9))
+}
+
+func TestRetryAttemptMarker(t *testing.T) {
+	assert.Equal(t, "\n[Aliyun Assist: attempt 1 exited with code 3, retry in 5 seconds]\n",
+		retryAttemptMarker(1, process.Success, 3, 5*time.Second))
+	assert.Equal(t, "\n[Aliyun Assist: attempt 2 timed out, retry in 10 seconds]\n",
+		retryAttemptMarker(2, process.Timeout, 1, 10*time.Second))
+	assert.Equal(t, "\n[Aliyun Assist: attempt 3 timed out without output, retry in 20 seconds]\n",
+		retryAttemptMarker(3, process.IdleTimeout, 1, 20*time.Second))
+}
+
+func TestWaitRetryBackoff(t *testing.T) {
+	task := NewTask(RunTaskInfo{TaskId: "t-retry"}, nil, nil)
+	assert.True(t, task.waitRetryBackoff(50*time.Millisecond))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		task.cancelMut.Lock()
+		task.canceled = true
+		task.cancelMut.Unlock()
+	}()
+	startTime := time.Now()
+	assert.False(t, task.waitRetryBackoff(time.Minute))
+	assert.True(t, time.Since(startTime) < 10*time.Second)
+}
+
+func TestRetryQueryParams(t *testing.T) {
+	task := NewTask(RunTaskInfo{TaskId: "t-retry"}, nil, nil)
+	task.attempts = 1
+	assert.Equal(t, "", task.retryQueryParams())
+
+	task = NewTask(RunTaskInfo{
+		TaskId: "t-retry",
+		Retry: RetryPolicyInfo{
+			MaxAttempts: 3,
+		},
+	}, nil, nil)
+	task.attempts = 2
+	assert.Equal(t, "&attempts=2", task.retryQueryParams())
+}
+
+func TestRunTaskWithRetry(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shell script is only run on Linux in this test")
+	}
+	defer setupTaskFileDirs(t)()
+	var reportedService, reportedQuerystring, reportedOutput string
+	guard := monkey.Patch(postTaskReport, func(service string, querystring string, output string, contentType string) (string, error) {
+		reportedService, reportedQuerystring, reportedOutput = service, querystring, output
+		return "", nil
+	})
+	defer guard.Unpatch()
+	guardHttpPost := monkey.Patch(util.HttpPost, func(string, string, string) (string, error) { return "", nil })
+	defer guardHttpPost.Unpatch()
+
+	task := NewTask(RunTaskInfo{
+		InstanceId:  "i-test",
+		CommandType: "RunShellScript",
+		TaskId:      fmt.Sprintf("t-retry%d", time.Now().UnixNano()),
+		TimeOut:     "60",
+		WorkingDir:  "/tmp",
+		Content:     base64.StdEncoding.EncodeToString([]byte("echo running; exit 3")),
+		// Output of all attempts is kept for final report instead of being
+		// sent as running output
+		Output: OutputInfo{
+			Interval: 60000,
+		},
+		Retry: RetryPolicyInfo{
+			MaxAttempts:      3,
+			Backoff:          1,
+			MaxBackoff:       1,
+			RetryOnExitCodes: []int{3},
+		},
+	}, nil, nil)
+	_, err := task.Run()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, task.attempts)
+	assert.Equal(t, reportServiceFinish, reportedService)
+	assert.Contains(t, reportedQuerystring, "&exitCode=3")
+	assert.Contains(t, reportedQuerystring, "&attempts=3")
+	assert.Equal(t, 3, strings.Count(reportedOutput, "running\n"))
+	assert.Contains(t, reportedOutput, "[Aliyun Assist: attempt 1 exited with code 3, retry in 1 seconds]")
+	assert.Contains(t, reportedOutput, "[Aliyun Assist: attempt 2 exited with code 3, retry in 1 seconds]")
+
+	record, err := GetHistory(task.taskInfo.TaskId)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, record.Attempts)
+}
+
+func TestRunTaskCanceledRightAfterBackoff(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shell script is only run on Linux in this test")
+	}
+	var reportedServices []string
+	guard := monkey.Patch(postTaskReport, func(service string, querystring string, output string, contentType string) (string, error) {
+		reportedServices = append(reportedServices, service)
+		return "", nil
+	})
+	defer guard.Unpatch()
+	guardHttpPost := monkey.Patch(util.HttpPost, func(string, string, string) (string, error) { return "", nil })
+	defer guardHttpPost.Unpatch()
+	// Cancellation arrives after backoff has been waited but before the next
+	// attempt is started
+	guardBackoff := monkey.Patch((*Task).waitRetryBackoff, func(task *Task, backoff time.Duration) bool {
+		task.Cancel()
+		return true
+	})
+	defer guardBackoff.Unpatch()
+
+	task := NewTask(RunTaskInfo{
+		InstanceId:  "i-test",
+		CommandType: "RunShellScript",
+		TaskId:      fmt.Sprintf("t-retrycancel%d", time.Now().UnixNano()),
+		TimeOut:     "60",
+		WorkingDir:  "/tmp",
+		Content:     base64.StdEncoding.EncodeToString([]byte("echo running; exit 3")),
+		Retry: RetryPolicyInfo{
+			MaxAttempts:      3,
+			RetryOnExitCodes: []int{3},
+		},
+	}, nil, nil)
+	_, err := task.Run()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, task.attempts)
+	assert.Equal(t, []string{reportServiceStopped}, reportedServices)
+}
@@ -0,0 +1,132 @@
+package taskengine
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	sandboxConfigFilename = "task_sandbox.json"
+
+	// Name of base directory under script directory of agent by default
+	defaultSandboxBaseDirName = "sandbox"
+	// Name of base directory created by agent under configured directory,
+	// which may be shared with others and thus is never modified or collected
+	// itself
+	dedicatedSandboxBaseDirName = "aliyun_assist_sandbox"
+
+	// Environment variable exposing sandbox directory to command process
+	sandboxWorkdirEnvName = "ASSIST_WORKDIR"
+)
+
+var (
+	ErrSandboxTmpfsUnsupported = errors.New("Sandbox directory on tmpfs is not supported on this platform")
+)
+
+// SandboxInfo requests fresh scratch directory for each invocation, which is
+// used as working directory when not specified and removed after invocation
+type SandboxInfo struct {
+	Enabled bool `json:"enabled"`
+	// Mount tmpfs of the size in bytes on sandbox directory when positive,
+	// only supported on Linux
+	TmpfsSize int64 `json:"tmpfsSize"`
+	// Keep sandbox directory of failed, timed out or canceled invocation for
+	// debugging, which is collected with saved scripts later
+	KeepOnFailure bool `json:"keepOnFailure"`
+}
+
+// SandboxConfig is loaded from task_sandbox.json in config directory
+type SandboxConfig struct {
+	// Directory under which dedicated base directory of sandbox directories
+	// of invocations is created
+	BaseDir string `json:"baseDir"`
+}
+
+// sandboxDir is scratch directory of one invocation, owned by the user whom
+// invocation runs as with 0700 permission
+type sandboxDir struct {
+	path    string
+	mounted bool
+}
+
+func getSandboxBaseDir() (string, error) {
+	config := SandboxConfig{}
+	if _, err := loadTaskConfigFile(sandboxConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", sandboxConfigFilename)
+		config = SandboxConfig{}
+	}
+	if config.BaseDir != "" {
+		return filepath.Join(filepath.Clean(config.BaseDir), dedicatedSandboxBaseDirName), nil
+	}
+
+	scriptDir, err := util.GetScriptPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(scriptDir, defaultSandboxBaseDirName), nil
+}
+
+func createSandboxDir(taskId string, username string, tmpfsSize int64) (*sandboxDir, error) {
+	if tmpfsSize > 0 && !sandboxTmpfsSupported() {
+		return nil, ErrSandboxTmpfsUnsupported
+	}
+	baseDir, err := getSandboxBaseDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureInvocationBaseDir(baseDir); err != nil {
+		return nil, err
+	}
+
+	// Directory is created with 0700 permission and unpredictable name, which
+	// is also recognized by garbage collection of saved scripts
+	path, err := ioutil.TempDir(baseDir, taskId+"-")
+	if err != nil {
+		return nil, err
+	}
+	sandbox := &sandboxDir{
+		path: path,
+	}
+	uid, gid, err := invocationDirOwner(username)
+	if err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+	if tmpfsSize > 0 {
+		if err := mountSandboxTmpfs(path, tmpfsSize, uid, gid); err != nil {
+			os.RemoveAll(path)
+			return nil, fmt.Errorf("Failed to mount tmpfs on sandbox directory: %w", err)
+		}
+		sandbox.mounted = true
+	} else if err := chownInvocationDir(path, uid, gid); err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+	return sandbox, nil
+}
+
+func (d *sandboxDir) remove() error {
+	if d.mounted {
+		if err := unmountSandbox(d.path); err != nil {
+			return err
+		}
+		d.mounted = false
+	}
+	return os.RemoveAll(d.path)
+}
+
+// sandboxQueryParams generates additional querystring parameters of sandbox
+// directory and whether it is kept after invocation
+func (task *Task) sandboxQueryParams(kept bool) string {
+	if task.sandboxPath == "" {
+		return ""
+	}
+	return fmt.Sprintf("&sandboxDir=%s&sandboxKept=%t", url.QueryEscape(task.sandboxPath), kept)
+}
@@ -0,0 +1,30 @@
+package taskengine
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func sandboxTmpfsSupported() bool {
+	return true
+}
+
+// mountSandboxTmpfs mounts tmpfs with size cap on sandbox directory, which is
+// owned by specified uid and gid with 0700 permission
+func mountSandboxTmpfs(path string, size int64, uid int, gid int) error {
+	options := fmt.Sprintf("size=%d,mode=0700,uid=%d,gid=%d", size, uid, gid)
+	return syscall.Mount("tmpfs", path, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, options)
+}
+
+// unmountSandbox unmounts tmpfs on sandbox directory, and detaches it lazily
+// if still busy due to processes left by invocation
+func unmountSandbox(path string) error {
+	if err := syscall.Unmount(path, 0); err != nil {
+		if err == syscall.EINVAL {
+			// Not a mount point at all
+			return nil
+		}
+		return syscall.Unmount(path, syscall.MNT_DETACH)
+	}
+	return nil
+}
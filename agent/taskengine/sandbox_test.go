@@ -0,0 +1,152 @@
+package taskengine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSandboxDir(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+	baseDir, err := getSandboxBaseDir()
+	assert.NoError(t, err)
+
+	sandbox, err := createSandboxDir("t-sandbox", "", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, baseDir, filepath.Dir(sandbox.path))
+	assert.True(t, strings.HasPrefix(filepath.Base(sandbox.path), "t-sandbox-"))
+	info, err := os.Stat(sandbox.path)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	}
+
+	another, err := createSandboxDir("t-sandbox", "", 0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, sandbox.path, another.path)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(sandbox.path, "leftover"), []byte("data"), 0600))
+	assert.NoError(t, sandbox.remove())
+	_, err = os.Stat(sandbox.path)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, another.remove())
+}
+
+func TestCreateSandboxDirUnderConfiguredDir(t *testing.T) {
+	configuredDir, err := ioutil.TempDir("", "shared")
+	assert.NoError(t, err)
+	defer os.RemoveAll(configuredDir)
+	assert.NoError(t, os.Chmod(configuredDir, 0777|os.ModeSticky))
+	defer setupTaskConfigDir(t, map[string]string{
+		sandboxConfigFilename: fmt.Sprintf(`{"baseDir": %q}`, configuredDir),
+	})()
+
+	// Sandbox directories are created in dedicated base directory, while
+	// configured directory is left untouched
+	sandbox, err := createSandboxDir("t-sandbox", "", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(configuredDir, dedicatedSandboxBaseDirName), filepath.Dir(sandbox.path))
+	info, err := os.Stat(configuredDir)
+	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0777)|os.ModeSticky, info.Mode()&(os.ModePerm|os.ModeSticky))
+	}
+	assert.NoError(t, sandbox.remove())
+}
+
+func TestCreateSandboxDirOnTmpfs(t *testing.T) {
+	defer setupTaskFileDirs(t)()
+
+	if !sandboxTmpfsSupported() {
+		_, err := createSandboxDir("t-sandbox", "", 1024*1024)
+		assert.ErrorIs(t, err, ErrSandboxTmpfsUnsupported)
+		return
+	}
+	sandbox, err := createSandboxDir("t-sandbox", "", 1024*1024)
+	if err != nil {
+		t.Skipf("Mounting tmpfs is not permitted: %s", err.Error())
+	}
+	defer sandbox.remove()
+	assert.True(t, sandbox.mounted)
+	// Writing beyond size cap fails
+	err = ioutil.WriteFile(filepath.Join(sandbox.path, "large"), make([]byte, 2*1024*1024), 0600)
+	assert.Error(t, err)
+	assert.NoError(t, sandbox.remove())
+	_, err = os.Stat(sandbox.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSandboxQueryParams(t *testing.T) {
+	task := NewTask(RunTaskInfo{TaskId: "t-sandbox"}, nil, nil)
+	assert.Equal(t, "", task.sandboxQueryParams(true))
+
+	task.sandboxPath = "/var/lib/sandbox/t-sandbox-1"
+	params, err := url.ParseQuery(strings.TrimPrefix(task.sandboxQueryParams(false), "&"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/sandbox/t-sandbox-1", params.Get("sandboxDir"))
+	assert.Equal(t, "false", params.Get("sandboxKept"))
+}
+
+func TestRunTaskWithSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shell script is only run on Linux in this test")
+	}
+	defer setupTaskFileDirs(t)()
+	baseDir, err := getSandboxBaseDir()
+	assert.NoError(t, err)
+
+	// Sandbox is working directory exposed via environment variable, and
+	// removed after successful invocation
+	script := `[ "$(pwd)" = "$ASSIST_WORKDIR" ] && echo same; echo data > "$ASSIST_WORKDIR/file"; echo "$ASSIST_WORKDIR"`
+	service, querystring, output := runShellTaskForReport(t, script, func(taskInfo *RunTaskInfo) {
+		taskInfo.WorkingDir = ""
+		taskInfo.Sandbox = SandboxInfo{
+			Enabled:       true,
+			KeepOnFailure: true,
+		}
+	})
+	assert.Equal(t, reportServiceFinish, service)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "same", lines[0])
+		assert.Equal(t, baseDir, filepath.Dir(lines[1]))
+		assert.Contains(t, querystring, "&sandboxDir="+url.QueryEscape(lines[1]))
+		assert.Contains(t, querystring, "&sandboxKept=false")
+		_, err := os.Stat(lines[1])
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// Sandbox of failed invocation is kept when required
+	service, querystring, output = runShellTaskForReport(t, `echo "$ASSIST_WORKDIR"; exit 1`, func(taskInfo *RunTaskInfo) {
+		taskInfo.Sandbox = SandboxInfo{
+			Enabled:       true,
+			KeepOnFailure: true,
+		}
+	})
+	assert.Equal(t, reportServiceFinish, service)
+	assert.Contains(t, querystring, "&sandboxKept=true")
+	keptPath := strings.TrimSpace(output)
+	info, err := os.Stat(keptPath)
+	if assert.NoError(t, err) {
+		assert.True(t, info.IsDir())
+	}
+
+	// Specified working directory is kept while sandbox is still provided
+	_, _, output = runShellTaskForReport(t, `pwd; [ -d "$ASSIST_WORKDIR" ] && echo exists; exit 1`, func(taskInfo *RunTaskInfo) {
+		taskInfo.Sandbox = SandboxInfo{
+			Enabled: true,
+		}
+	})
+	assert.Equal(t, "/tmp\nexists\n", output)
+	entries, err := ioutil.ReadDir(baseDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,15 @@
+// +build !linux
+
+package taskengine
+
+func sandboxTmpfsSupported() bool {
+	return false
+}
+
+func mountSandboxTmpfs(path string, size int64, uid int, gid int) error {
+	return ErrSandboxTmpfsUnsupported
+}
+
+func unmountSandbox(path string) error {
+	return nil
+}
@@ -2,6 +2,7 @@ package taskengine
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -13,7 +14,9 @@ import (
 	"github.com/aliyun/aliyun_assist_client/agent/log"
 	"github.com/aliyun/aliyun_assist_client/agent/metrics"
 	"github.com/aliyun/aliyun_assist_client/agent/taskengine/timermanager"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
 	"github.com/aliyun/aliyun_assist_client/agent/util/atomicutil"
+	"github.com/aliyun/aliyun_assist_client/agent/util/wrapgo"
 )
 
 const (
@@ -25,11 +28,38 @@ const (
 	SessionTaskType = 1
 )
 
+// Overlap policies deciding how run of periodic task is handled when previous
+// invocation is still running
+const (
+	// Drop the run, which is the default behavior
+	OverlapPolicySkip = "skip"
+	// Run it after previous invocation finished, and at most one run is queued
+	OverlapPolicyQueueOne = "queueOne"
+	// Terminate previous invocation and run the new one
+	OverlapPolicyReplace = "replace"
+	// Run it alongside previous invocation
+	OverlapPolicyAllowParallel = "allowParallel"
+)
+
 // PeriodicTaskSchedule consists of timer and reusable invocation data structure
 // for periodic task
 type PeriodicTaskSchedule struct {
 	timer              *timermanager.Timer
 	reusableInvocation *Task
+	// Number of missed runs still to be made up after current invocation,
+	// ONLY operated by atomic operation
+	pendingMisfireRuns int32
+
+	// Fields below are protected by invocationLock
+	invocationLock sync.Mutex
+	// Run waiting for the running invocation to finish, by queueOne or
+	// replace overlap policy
+	queuedRun bool
+	// Invocations started alongside the running one by allowParallel
+	// overlap policy, keyed by names registered in TaskFactory
+	parallelInvocations map[string]*Task
+	parallelSequence    int
+	deregistered        bool
 }
 
 var (
@@ -155,10 +185,15 @@ func dispatchRunTask(taskInfo RunTaskInfo) {
 		t := NewTask(taskInfo, nil, nil)
 
 		scheduleLogger.Info("Schedule non-periodic task")
+		// Record fetched task in journal, thus it could be reported as failed
+		// if agent exits before it finishes
+		if err := journalTransit(taskInfo.TaskId, taskInfo, TaskJournalPending, 0); err != nil {
+			scheduleLogger.WithError(err).Warningln("Failed to record pending state in task journal")
+		}
 		// Non-periodic tasks are managed by TaskFactory
 		taskFactory.AddTask(t)
 		pool := GetPool()
-		pool.RunTask(func ()  {
+		err := pool.RunTask(TaskLaneInteractive, func() {
 			code, err := t.Run()
 			if code != 0 || err != nil {
 				metrics.GetTaskFailedEvent(
@@ -167,9 +202,17 @@ func dispatchRunTask(taskInfo RunTaskInfo) {
 					"reason", strconv.Itoa(int(code)),
 				).ReportEvent()
 			}
+			if err := journalRemoveIfDelivered(t.taskInfo.TaskId); err != nil {
+				scheduleLogger.WithError(err).Warningln("Failed to remove entry from task journal")
+			}
 			taskFactory := GetTaskFactory()
 			taskFactory.RemoveTaskByName(t.taskInfo.TaskId)
 		})
+		if err != nil {
+			scheduleLogger.WithError(err).Errorln("Rejected by task pool")
+			rejectQueuedTask(t, t.taskInfo.TaskId, err)
+			return
+		}
 		scheduleLogger.Info("Scheduled for pending or running")
 	case RunTaskCron, RunTaskRate, RunTaskAt:
 		// Periodic tasks are managed by _periodicTaskSchedules
@@ -188,6 +231,28 @@ func dispatchRunTask(taskInfo RunTaskInfo) {
 	}
 }
 
+// rejectQueuedTask reports invocation rejected by task pool as failed, and
+// cleans it up as if it has finished. It may be called with invocationLock of
+// periodic task held, thus invocation is removed from TaskFactory at once but
+// reported in background, since reporting may take a long time with retries.
+func rejectQueuedTask(t *Task, name string, err error) {
+	GetTaskFactory().RemoveTaskByName(name)
+	wrapgo.GoWithDefaultPanicHandler(func() {
+		t.SendError("", wrapErrTaskQueueFull, fmt.Sprintf("TaskQueueFull: %s", err.Error()))
+		metrics.GetTaskFailedEvent(
+			"taskid", t.taskInfo.TaskId,
+			"errormsg", err.Error(),
+			"reason", strconv.Itoa(int(wrapErrTaskQueueFull)),
+		).ReportEvent()
+		if err := journalRemoveIfDelivered(name); err != nil {
+			log.GetLogger().WithFields(logrus.Fields{
+				"TaskId": t.taskInfo.TaskId,
+				"Phase":  "Scheduling",
+			}).WithError(err).Warningln("Failed to remove entry from task journal")
+		}
+	})
+}
+
 func dispatchStopTask(taskInfo RunTaskInfo) {
 	log.GetLogger().WithFields(logrus.Fields{
 		"TaskId": taskInfo.TaskId,
@@ -207,7 +272,7 @@ func dispatchStopTask(taskInfo RunTaskInfo) {
 			scheduledTask.Cancel()
 			cancelLogger.Info("Canceled task and invocation")
 		} else {
-			response, err := sendStoppedOutput(taskInfo.TaskId, 0, 0, 0, 0, "", stopReasonKilled)
+			response, err := sendStoppedOutput(taskInfo.TaskId, 0, 0, 0, 0, "", stopReasonKilled, "")
 			cancelLogger.WithFields(logrus.Fields{
 				"response": response,
 			}).WithError(err).Warning("Force cancelling task not found due to finished or error")
@@ -254,9 +319,14 @@ func dispatchTestTask(taskInfo RunTaskInfo) {
 
 		scheduleLogger.Info("Schedule testing task to be pre-checked")
 		pool := GetPrecheckPool()
-		pool.RunTask(func () {
+		err := pool.RunTask(TaskLanePrecheck, func() {
 			t.PreCheck(true)
 		})
+		if err != nil {
+			scheduleLogger.WithError(err).Errorln("Rejected by task pool")
+			t.SendInvalidTask("TaskQueueFull", err.Error())
+			return
+		}
 		scheduleLogger.Info("Scheduled testing task to be pre-checked")
 	default:
 		scheduleLogger.WithFields(logrus.Fields{
@@ -265,40 +335,253 @@ func dispatchTestTask(taskInfo RunTaskInfo) {
 	}
 }
 
+// validateOverlapPolicy checks policy before periodic task is scheduled
+func validateOverlapPolicy(overlapPolicy string) error {
+	switch overlapPolicy {
+	case "", OverlapPolicySkip, OverlapPolicyQueueOne, OverlapPolicyReplace, OverlapPolicyAllowParallel:
+		return nil
+	default:
+		return fmt.Errorf("Unknown overlap policy %s", overlapPolicy)
+	}
+}
+
+// startExclusiveInvocation is called when periodic task is triggered. Run
+// overlapping with the running invocation is handled according to overlap
+// policy of task, and only allowParallel policy lets them run at the same time.
 func (s *PeriodicTaskSchedule) startExclusiveInvocation() {
+	// Replaced invocation is terminated and reported without invocationLock
+	// held, since it may take a long time. The queued run starts after it
+	// exits.
+	if replacedInvocation := s.scheduleExclusiveInvocation(); replacedInvocation != nil {
+		replacedInvocation.Replace()
+		metrics.GetTaskReplacedEvent(
+			"taskid", replacedInvocation.taskInfo.TaskId,
+		).ReportEvent()
+	}
+}
+
+// scheduleExclusiveInvocation starts new invocation or handles overlapped run
+// with invocationLock held, and returns running invocation to be replaced
+func (s *PeriodicTaskSchedule) scheduleExclusiveInvocation() *Task {
+	s.invocationLock.Lock()
+	defer s.invocationLock.Unlock()
+
+	taskId := s.reusableInvocation.taskInfo.TaskId
 	// Reuse specified logger across task scheduling phase
 	invocateLogger := log.GetLogger().WithFields(logrus.Fields{
-		"TaskId": s.reusableInvocation.taskInfo.TaskId,
+		"TaskId": taskId,
 		"Phase":  "PeriodicInvocating",
 	})
+	if s.deregistered {
+		invocateLogger.Info("Ignore run of deregistered periodic task")
+		return nil
+	}
 
 	// NOTE: TaskPool has been closely wired with TaskFactory, thus:
 	taskFactory := GetTaskFactory()
 	// (3) Existed invocation in TaskFactory means task is running.
-	if taskFactory.ContainsTaskByName(s.reusableInvocation.taskInfo.TaskId) {
+	if runningInvocation, ok := taskFactory.GetTask(taskId); ok {
+		return s.handleOverlappedRun(runningInvocation, invocateLogger)
+	}
+
+	// Canceled invocation, e.g., the replaced one, could not be reused since
+	// its state would suppress reports of next invocation
+	if s.reusableInvocation.IsCancled() {
+		s.reusableInvocation = NewTask(s.reusableInvocation.taskInfo, s.reusableInvocation.scheduleLocation, s.reusableInvocation.onFinish)
+	}
+	s.startInvocation(s.reusableInvocation, taskId, invocateLogger)
+	return nil
+}
+
+// handleOverlappedRun must be called with invocationLock held, and returns
+// running invocation which caller should replace after releasing the lock
+func (s *PeriodicTaskSchedule) handleOverlappedRun(runningInvocation *Task, invocateLogger logrus.FieldLogger) *Task {
+	taskId := s.reusableInvocation.taskInfo.TaskId
+	overlapPolicy := s.reusableInvocation.taskInfo.OverlapPolicy
+	switch overlapPolicy {
+	case OverlapPolicyQueueOne:
+		if !s.queuedRun {
+			s.queuedRun = true
+			invocateLogger.Info("Queue run until existing invocation finished")
+			return nil
+		}
+		invocateLogger.Warn("Skip invocation since another run has been queued")
+		reportSkippedRun(taskId, overlapPolicy, "queueFull")
+	case OverlapPolicyReplace:
+		invocateLogger.Warn("Replace existing invocation with new run")
+		// New run starts after replaced invocation exits
+		s.queuedRun = true
+		return runningInvocation
+	case OverlapPolicyAllowParallel:
+		s.parallelSequence++
+		name := fmt.Sprintf("%s-parallel-%d", taskId, s.parallelSequence)
+		invocation := NewTask(s.reusableInvocation.taskInfo, s.reusableInvocation.scheduleLocation, s.reusableInvocation.onFinish)
+		if s.parallelInvocations == nil {
+			s.parallelInvocations = make(map[string]*Task)
+		}
+		s.parallelInvocations[name] = invocation
+		invocateLogger.Infof("Start parallel invocation %s alongside existing invocation", name)
+		s.startInvocation(invocation, name, invocateLogger)
+	default:
 		invocateLogger.Warn("Skip invocation since overlapped with existing invocation")
-		return
+		reportSkippedRun(taskId, overlapPolicy, "overlapped")
+	}
+	return nil
+}
+
+func reportSkippedRun(taskId string, overlapPolicy string, reason string) {
+	if overlapPolicy == "" {
+		overlapPolicy = OverlapPolicySkip
 	}
+	metrics.GetTaskSkippedEvent(
+		"taskid", taskId,
+		"overlapPolicy", overlapPolicy,
+		"reason", reason,
+	).ReportEvent()
+}
 
+// startInvocation registers invocation into TaskFactory by specified name and
+// submits it to task pool, which must be called with invocationLock held
+func (s *PeriodicTaskSchedule) startInvocation(invocation *Task, name string, invocateLogger logrus.FieldLogger) {
 	invocateLogger.Info("Schedule new invocation of periodic task")
+	if err := writePeriodicLastRun(invocation.taskInfo.TaskId, time.Now()); err != nil {
+		invocateLogger.WithError(err).Warningln("Failed to record last run time of periodic task")
+	}
+	// Parallel run keeps its own journal entry, spool file and staged
+	// artifacts under its name
+	invocation.runName = name
+	if err := journalTransit(name, invocation.taskInfo, TaskJournalPending, 0); err != nil {
+		invocateLogger.WithError(err).Warningln("Failed to record pending state in task journal")
+	}
 	// (2) Every time of invocation need to add itself into TaskFactory at first.
-	taskFactory.AddTask(s.reusableInvocation)
+	taskFactory := GetTaskFactory()
+	taskFactory.AddNamedTask(name, invocation)
 	pool := GetPool()
-	pool.RunTask(func ()  {
-		code, err := s.reusableInvocation.Run()
+	err := pool.RunTask(TaskLanePeriodic, func() {
+		code, err := invocation.Run()
 		if code != 0 || err != nil {
 			metrics.GetTaskFailedEvent(
-				"taskid", s.reusableInvocation.taskInfo.TaskId,
+				"taskid", invocation.taskInfo.TaskId,
 				"errormsg", err.Error(),
 				"reason", strconv.Itoa(int(code)),
 			).ReportEvent()
 		}
+		if err := journalRemoveIfDelivered(name); err != nil {
+			invocateLogger.WithError(err).Warningln("Failed to remove entry from task journal")
+		}
 		taskFactory := GetTaskFactory()
-		taskFactory.RemoveTaskByName(s.reusableInvocation.taskInfo.TaskId)
+		taskFactory.RemoveTaskByName(name)
+
+		s.onInvocationFinished(name, invocateLogger)
 	})
+	if err != nil {
+		invocateLogger.WithError(err).Errorln("Rejected by task pool")
+		if name == invocation.taskInfo.TaskId {
+			s.queuedRun = false
+			atomic.StoreInt32(&s.pendingMisfireRuns, 0)
+		} else {
+			delete(s.parallelInvocations, name)
+		}
+		rejectQueuedTask(invocation, name, err)
+		return
+	}
 	invocateLogger.Info("Scheduled new pending or running invocation")
 }
 
+// onInvocationFinished starts the run queued by overlap policy, or the next
+// missed run to be made up, after exclusive invocation finished
+func (s *PeriodicTaskSchedule) onInvocationFinished(name string, invocateLogger logrus.FieldLogger) {
+	s.invocationLock.Lock()
+	if _, ok := s.parallelInvocations[name]; ok {
+		delete(s.parallelInvocations, name)
+		s.invocationLock.Unlock()
+		return
+	}
+	queuedRun := s.queuedRun
+	s.queuedRun = false
+	s.invocationLock.Unlock()
+
+	if queuedRun {
+		invocateLogger.Info("Start queued run of periodic task")
+		s.startExclusiveInvocation()
+	} else if s.takePendingMisfireRun() {
+		invocateLogger.Info("Make up next missed run of periodic task")
+		s.startExclusiveInvocation()
+	}
+}
+
+// takePendingMisfireRun consumes one pending missed run if any
+func (s *PeriodicTaskSchedule) takePendingMisfireRun() bool {
+	for {
+		pending := atomic.LoadInt32(&s.pendingMisfireRuns)
+		if pending <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.pendingMisfireRuns, pending, pending-1) {
+			return true
+		}
+	}
+}
+
+// handleMisfire finds runs missed since last run recorded before agent or
+// instance went down, and makes them up according to misfire policy of task
+func (s *PeriodicTaskSchedule) handleMisfire(scheduleLogger logrus.FieldLogger) {
+	taskInfo := s.reusableInvocation.taskInfo
+	now := time.Now()
+	lastRunTime, recorded, err := readPeriodicLastRun(taskInfo.TaskId)
+	if err != nil {
+		scheduleLogger.WithError(err).Warningln("Failed to read last run time of periodic task")
+	}
+	// Record current time as baseline, thus runs missed before the next run
+	// could still be found after restarting agent
+	if err := writePeriodicLastRun(taskInfo.TaskId, now); err != nil {
+		scheduleLogger.WithError(err).Warningln("Failed to record last run time of periodic task")
+	}
+	if !recorded {
+		return
+	}
+
+	schedule, ok := s.timer.Schedule.(misfireSchedule)
+	if !ok {
+		return
+	}
+	missedRuns := findMissedRuns(schedule, lastRunTime, now)
+	if len(missedRuns) == 0 {
+		return
+	}
+	runsToMakeUp := misfireRunsToMakeUp(taskInfo.Misfire, len(missedRuns))
+	misfireLogger := scheduleLogger.WithFields(logrus.Fields{
+		"lastRunTime":    lastRunTime,
+		"firstMissedRun": missedRuns[0],
+		"missedRuns":     len(missedRuns),
+		"misfirePolicy":  taskInfo.Misfire.Policy,
+		"runsToMakeUp":   runsToMakeUp,
+	})
+	if runsToMakeUp == 0 {
+		misfireLogger.Warningln("Skip runs of periodic task missed during downtime")
+		return
+	}
+	misfireLogger.Infoln("Make up runs of periodic task missed during downtime")
+	atomic.StoreInt32(&s.pendingMisfireRuns, int32(runsToMakeUp-1))
+	go s.startExclusiveInvocation()
+}
+
+// periodicTaskSplay returns splay of periodic task seeded by instance ID, thus
+// the same task on different instances would be spread across the window
+func periodicTaskSplay(taskInfo RunTaskInfo) timermanager.Splay {
+	if taskInfo.Splay <= 0 {
+		return timermanager.Splay{}
+	}
+	instanceId := taskInfo.InstanceId
+	if instanceId == "" {
+		instanceId = util.GetInstanceId()
+	}
+	return timermanager.Splay{
+		Window: time.Duration(taskInfo.Splay) * time.Second,
+		Seed:   instanceId,
+	}
+}
+
 func schedulePeriodicTask(taskInfo RunTaskInfo) error {
 	timerManager := timermanager.GetTimerManager()
 	if timerManager == nil {
@@ -322,6 +605,25 @@ func schedulePeriodicTask(taskInfo RunTaskInfo) error {
 		return nil
 	}
 
+	if err := validateOverlapPolicy(taskInfo.OverlapPolicy); err != nil {
+		response, reportErr := reportInvalidTask(taskInfo.TaskId, invalidParamOverlap, err.Error())
+		scheduleLogger.WithFields(logrus.Fields{
+			"overlapPolicy": taskInfo.OverlapPolicy,
+			"reportErr": reportErr,
+			"response": response,
+		}).WithError(err).Info("Report errors for invalid overlap policy")
+		return err
+	}
+	if err := validateMisfirePolicy(taskInfo.Misfire); err != nil {
+		response, reportErr := reportInvalidTask(taskInfo.TaskId, invalidParamMisfire, err.Error())
+		scheduleLogger.WithFields(logrus.Fields{
+			"misfirePolicy": taskInfo.Misfire.Policy,
+			"reportErr": reportErr,
+			"response": response,
+		}).WithError(err).Info("Report errors for invalid misfire policy")
+		return err
+	}
+
 	// 2. Create PeriodicTaskSchedule object
 	scheduleLogger.Info("Create timer of periodic task")
 	periodicTaskSchedule := &PeriodicTaskSchedule{
@@ -344,7 +646,7 @@ func schedulePeriodicTask(taskInfo RunTaskInfo) error {
 		creationTime := time.Unix(creationTimeSeconds, creationTimeMs * int64(time.Millisecond))
 		timer, err = timerManager.CreateRateTimer(func() {
 			periodicTaskSchedule.startExclusiveInvocation()
-		}, taskInfo.Cronat, creationTime)
+		}, taskInfo.Cronat, creationTime, periodicTaskSplay(taskInfo))
 	} else if taskInfo.Repeat == RunTaskAt {
 		timer, err = timerManager.CreateAtTimer(func() {
 			periodicTaskSchedule.startExclusiveInvocation()
@@ -352,7 +654,7 @@ func schedulePeriodicTask(taskInfo RunTaskInfo) error {
 	} else {
 		timer, err = timerManager.CreateCronTimer(func() {
 			periodicTaskSchedule.startExclusiveInvocation()
-		}, taskInfo.Cronat)
+		}, taskInfo.Cronat, periodicTaskSplay(taskInfo))
 	}
 	if err != nil {
 		// Report errors for invalid cron/rate/at expression
@@ -395,7 +697,7 @@ func schedulePeriodicTask(taskInfo RunTaskInfo) error {
 			}
 
 			if cronScheduled.NoNextRun() {
-				response, err := sendStoppedOutput(taskInfo.TaskId, 0, 0, 0, 0, "", stopReasonCompleted)
+				response, err := sendStoppedOutput(taskInfo.TaskId, 0, 0, 0, 0, "", stopReasonCompleted, "")
 				onFinishLogger.WithFields(logrus.Fields{
 					"response": response,
 				}).WithError(err).Infoln("Sent completion event for cron task on last invocation finished")
@@ -421,6 +723,9 @@ func schedulePeriodicTask(taskInfo RunTaskInfo) error {
 	}
 	scheduleLogger.Info("Running timer of periodic task")
 
+	// 6. Make up runs missed while agent or instance was down
+	periodicTaskSchedule.handleMisfire(scheduleLogger)
+
 	return nil
 }
 
@@ -430,45 +735,78 @@ func cancelPeriodicTask(taskInfo RunTaskInfo) error {
 		return errors.New("Global TimerManager instance is not initialized")
 	}
 
-	_periodicTaskSchedulesLock.Lock()
-	defer _periodicTaskSchedulesLock.Unlock()
-
 	cancelLogger := log.GetLogger().WithFields(logrus.Fields{
 		"TaskId": taskInfo.TaskId,
 		"Phase":  "Cancelling",
 	})
 
-	// 1. Check whether task is registered in local storage
-	periodicTaskSchedule, ok := _periodicTaskSchedules[taskInfo.TaskId]
+	// 1-3. Deregister periodic task, and decide invocations to cancel
+	parallelInvocations, runningInvocation, lastInvocation, ok := deregisterPeriodicTask(taskInfo.TaskId, timerManager, cancelLogger)
 	if !ok {
-		response, err := sendStoppedOutput(taskInfo.TaskId, 0, 0, 0, 0, "", stopReasonKilled)
+		response, err := sendStoppedOutput(taskInfo.TaskId, 0, 0, 0, 0, "", stopReasonKilled, "")
 		cancelLogger.WithFields(logrus.Fields{
 			"response": response,
 		}).WithError(err).Warning("Force cancelling periodic task unregistered due to finished or previous errors")
 		return nil
 	}
 
-	// 2. Delete timer of periodic task from TimerManager, which contains stopping
-	// timer operation
-	timerManager.DeleteTimer(periodicTaskSchedule.timer)
-	cancelLogger.Infof("Stop and remove timer of periodic task")
-
-	// 3. Delete registered task record from local storage
-	delete(_periodicTaskSchedules, taskInfo.TaskId)
-	cancelLogger.Infof("Deregistered periodic task")
-
-	// 4. Cancel existing invocation of periodic task and send ACK
-	runningInvocation, ok := GetTaskFactory().GetTask(taskInfo.TaskId)
-	if ok {
+	// 4. Cancel existing invocation of periodic task and send ACK without
+	// locks held, since terminating process tree and reporting may take a
+	// long time
+	for name, parallelInvocation := range parallelInvocations {
+		cancelLogger.Infof("Cancel parallel invocation %s of periodic task", name)
+		parallelInvocation.Cancel()
+	}
+	if runningInvocation != nil {
 		cancelLogger.Infof("Cancel running invocation of periodic task")
 		runningInvocation.Cancel()
 		cancelLogger.Infof("Canceled running invocation of periodic task")
 	} else {
 		cancelLogger.Infof("Not need to cancel running invocation of periodic task")
 		// Since no running
-		lastInvocation := periodicTaskSchedule.reusableInvocation
-		lastInvocation.sendOutput("canceled", lastInvocation.getReportString(lastInvocation.output))
+		lastInvocation.sendOutput("canceled", lastInvocation.getReportString())
 		cancelLogger.Infof("Sent canceled ACK with output of last invocation")
 	}
 	return nil
 }
+
+// deregisterPeriodicTask stops and removes schedule of periodic task with
+// locks held, and returns its parallel and running invocations to be canceled,
+// or the last invocation when none is running
+func deregisterPeriodicTask(taskId string, timerManager *timermanager.TimerManager, cancelLogger logrus.FieldLogger) (map[string]*Task, *Task, *Task, bool) {
+	_periodicTaskSchedulesLock.Lock()
+	defer _periodicTaskSchedulesLock.Unlock()
+
+	// 1. Check whether task is registered in local storage
+	periodicTaskSchedule, ok := _periodicTaskSchedules[taskId]
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	// 2. Delete timer of periodic task from TimerManager, which contains stopping
+	// timer operation
+	timerManager.DeleteTimer(periodicTaskSchedule.timer)
+	cancelLogger.Infof("Stop and remove timer of periodic task")
+
+	// 3. Delete registered task record from local storage
+	delete(_periodicTaskSchedules, taskId)
+	periodicTaskSchedule.invocationLock.Lock()
+	defer periodicTaskSchedule.invocationLock.Unlock()
+	// Neither queued run nor missed runs would start after deregistered
+	periodicTaskSchedule.deregistered = true
+	periodicTaskSchedule.queuedRun = false
+	atomic.StoreInt32(&periodicTaskSchedule.pendingMisfireRuns, 0)
+	if err := removePeriodicLastRun(taskId); err != nil {
+		cancelLogger.WithError(err).Warningln("Failed to remove last run time of periodic task")
+	}
+	cancelLogger.Infof("Deregistered periodic task")
+
+	parallelInvocations := make(map[string]*Task, len(periodicTaskSchedule.parallelInvocations))
+	for name, parallelInvocation := range periodicTaskSchedule.parallelInvocations {
+		parallelInvocations[name] = parallelInvocation
+	}
+	if runningInvocation, ok := GetTaskFactory().GetTask(taskId); ok {
+		return parallelInvocations, runningInvocation, nil, true
+	}
+	return parallelInvocations, nil, periodicTaskSchedule.reusableInvocation, true
+}
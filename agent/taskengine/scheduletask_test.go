@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"bou.ke/monkey"
 	"github.com/aliyun/aliyun_assist_client/agent/taskengine/timermanager"
@@ -516,7 +517,7 @@ func Test_cancelPeriodicTask(t *testing.T) {
 				timermanager.InitTimerManager()
 				_periodicTaskSchedulesLock.Lock()
 				timerManager := timermanager.GetTimerManager()
-				timer, _ := timerManager.CreateCronTimer(func() {}, "0 0 0 1 1 1")
+				timer, _ := timerManager.CreateCronTimer(func() {}, "0 0 0 1 1 1", timermanager.Splay{})
 				_periodicTaskSchedules[tt.args.taskInfo.TaskId] = &PeriodicTaskSchedule{
 					timer: timer,
 					reusableInvocation: &Task{
@@ -540,7 +541,7 @@ func Test_cancelPeriodicTask(t *testing.T) {
 				timermanager.InitTimerManager()
 				_periodicTaskSchedulesLock.Lock()
 				timerManager := timermanager.GetTimerManager()
-				timer, _ := timerManager.CreateCronTimer(func() {}, "0 0 0 1 1 1")
+				timer, _ := timerManager.CreateCronTimer(func() {}, "0 0 0 1 1 1", timermanager.Splay{})
 				_periodicTaskSchedules[tt.args.taskInfo.TaskId] = &PeriodicTaskSchedule{
 					timer: timer,
 					reusableInvocation: &Task{
@@ -562,3 +563,170 @@ func Test_cancelPeriodicTask(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateOverlapPolicy(t *testing.T) {
+	assert.NoError(t, validateOverlapPolicy(""))
+	assert.NoError(t, validateOverlapPolicy(OverlapPolicySkip))
+	assert.NoError(t, validateOverlapPolicy(OverlapPolicyQueueOne))
+	assert.NoError(t, validateOverlapPolicy(OverlapPolicyReplace))
+	assert.NoError(t, validateOverlapPolicy(OverlapPolicyAllowParallel))
+	assert.Error(t, validateOverlapPolicy("queueAll"))
+}
+
+func TestPeriodicTaskSchedule_overlapPolicy(t *testing.T) {
+	mockMetrics()
+	defer util.NilRequest.Clear()
+	defer httpmock.DeactivateAndReset()
+	defer setupTaskFileDirs(t)()
+
+	newSchedule := func(overlapPolicy string) *PeriodicTaskSchedule {
+		return &PeriodicTaskSchedule{
+			reusableInvocation: NewTask(RunTaskInfo{
+				TaskId:        "t-overlap",
+				Repeat:        RunTaskRate,
+				OverlapPolicy: overlapPolicy,
+			}, nil, nil),
+		}
+	}
+	taskFactory := GetTaskFactory()
+	runningInvocation := NewTask(RunTaskInfo{TaskId: "t-overlap"}, nil, nil)
+	taskFactory.AddTask(runningInvocation)
+	defer taskFactory.RemoveTaskByName("t-overlap")
+
+	t.Run("skip", func(t *testing.T) {
+		s := newSchedule(OverlapPolicySkip)
+		s.startExclusiveInvocation()
+		assert.False(t, s.queuedRun)
+		assert.Empty(t, s.parallelInvocations)
+	})
+
+	t.Run("queueOne", func(t *testing.T) {
+		s := newSchedule(OverlapPolicyQueueOne)
+		s.startExclusiveInvocation()
+		assert.True(t, s.queuedRun)
+		// Only one run could be queued and the others are skipped
+		s.startExclusiveInvocation()
+		assert.True(t, s.queuedRun)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		s := newSchedule(OverlapPolicyReplace)
+		replaced := 0
+		var task *Task
+		guard := monkey.PatchInstanceMethod(reflect.TypeOf(task), "Replace", func(*Task) {
+			replaced++
+			// Invocation is terminated without invocationLock held
+			if assert.True(t, s.invocationLock.TryLock()) {
+				s.invocationLock.Unlock()
+			}
+		})
+		defer guard.Unpatch()
+
+		s.startExclusiveInvocation()
+		assert.Equal(t, 1, replaced)
+		assert.True(t, s.queuedRun)
+	})
+
+	t.Run("allowParallel", func(t *testing.T) {
+		finished := make(chan struct{})
+		var task *Task
+		guard := monkey.PatchInstanceMethod(reflect.TypeOf(task), "Run", func(*Task) (presetWrapErrorCode, error) {
+			<-finished
+			return 0, nil
+		})
+		defer guard.Unpatch()
+
+		s := newSchedule(OverlapPolicyAllowParallel)
+		s.startExclusiveInvocation()
+		assert.True(t, taskFactory.ContainsTaskByName("t-overlap-parallel-1"))
+		s.invocationLock.Lock()
+		assert.Len(t, s.parallelInvocations, 1)
+		// Parallel run keeps its own on-disk state apart from exclusive one
+		assert.Equal(t, "t-overlap-parallel-1", s.parallelInvocations["t-overlap-parallel-1"].runKey())
+		s.invocationLock.Unlock()
+		journalPath, err := taskJournalFilePath("t-overlap-parallel-1")
+		assert.NoError(t, err)
+		entry, err := readTaskJournalEntry(journalPath)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "t-overlap", entry.TaskInfo.TaskId)
+		}
+
+		close(finished)
+		assert.Eventually(t, func() bool {
+			return !taskFactory.ContainsTaskByName("t-overlap-parallel-1")
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Eventually(t, func() bool {
+			s.invocationLock.Lock()
+			defer s.invocationLock.Unlock()
+			return len(s.parallelInvocations) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+		// Exclusive invocation is left untouched
+		assert.True(t, taskFactory.ContainsTaskByName("t-overlap"))
+		assert.NoFileExists(t, journalPath)
+	})
+
+	t.Run("deregistered", func(t *testing.T) {
+		s := newSchedule(OverlapPolicyQueueOne)
+		s.deregistered = true
+		s.startExclusiveInvocation()
+		assert.False(t, s.queuedRun)
+	})
+}
+
+func TestPeriodicTaskSchedule_rejectedByPool(t *testing.T) {
+	mockMetrics()
+	defer util.NilRequest.Clear()
+	defer httpmock.DeactivateAndReset()
+	defer setupTaskFileDirs(t)()
+
+	var pool *taskPool
+	poolGuard := monkey.PatchInstanceMethod(reflect.TypeOf(pool), "RunTask", func(*taskPool, TaskLane, TaskFunction) error {
+		return ErrTaskQueueFull
+	})
+	defer poolGuard.Unpatch()
+	s := &PeriodicTaskSchedule{
+		reusableInvocation: NewTask(RunTaskInfo{
+			TaskId: "t-rejected",
+			Repeat: RunTaskRate,
+		}, nil, nil),
+	}
+	releaseReport := make(chan struct{})
+	reported := make(chan struct{})
+	var task *Task
+	reportGuard := monkey.PatchInstanceMethod(reflect.TypeOf(task), "SendError", func(_ *Task, output string, errCode presetWrapErrorCode, errDesc string) {
+		<-releaseReport
+		close(reported)
+	})
+	defer reportGuard.Unpatch()
+
+	// Scheduling is never blocked by reporting rejected invocation
+	scheduled := make(chan struct{})
+	go func() {
+		s.startExclusiveInvocation()
+		close(scheduled)
+	}()
+	select {
+	case <-scheduled:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Scheduling is blocked by reporting rejected invocation")
+	}
+	if assert.True(t, s.invocationLock.TryLock()) {
+		s.invocationLock.Unlock()
+	}
+	assert.False(t, GetTaskFactory().ContainsTaskByName("t-rejected"))
+
+	close(releaseReport)
+	select {
+	case <-reported:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Rejected invocation is not reported")
+	}
+}
+
+func TestPeriodicTaskSplay(t *testing.T) {
+	assert.Equal(t, timermanager.Splay{}, periodicTaskSplay(RunTaskInfo{InstanceId: "i-test"}))
+	assert.Equal(t, timermanager.Splay{
+		Window: 5 * time.Minute,
+		Seed:   "i-test",
+	}, periodicTaskSplay(RunTaskInfo{InstanceId: "i-test", Splay: 300}))
+}
@@ -0,0 +1,297 @@
+package taskengine
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/taskengine/timermanager"
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+const (
+	scriptRetentionConfigFilename = "task_script_retention.json"
+
+	defaultScriptMaxAgeHours    = 7 * 24
+	defaultScriptMaxCount       = 5000
+	defaultScriptMaxTotalSize   = 256 * 1024 * 1024
+	defaultScriptGCIntervalMins = 60
+	// Scripts younger than this are never collected, since they may belong to
+	// invocations just dispatched after protected tasks were listed
+	minScriptGCAge = 10 * time.Minute
+)
+
+var (
+	_scriptGCTimer         *timermanager.Timer
+	_scriptGCTimerInitLock sync.Mutex
+	// Only one collection runs at the same time
+	_scriptGCLock sync.Mutex
+
+	// Directories named like "<taskId>-<random>" by ioutil.TempDir are created
+	// for invocations, and nothing else in base directories is collected
+	invocationDirNamePattern = regexp.MustCompile(`^.+-[0-9]+$`)
+)
+
+// ScriptRetentionConfig is loaded from task_script_retention.json in config
+// directory, and limits saved scripts, private directories and kept sandbox
+// directories of invocations
+type ScriptRetentionConfig struct {
+	Disabled        bool  `json:"disabled"`
+	MaxAgeHours     int   `json:"maxAgeHours"`
+	MaxCount        int   `json:"maxCount"`
+	MaxTotalSize    int64 `json:"maxTotalSize"`
+	IntervalMinutes int   `json:"intervalMinutes"`
+}
+
+type scriptGCEntry struct {
+	path    string
+	name    string
+	isDir   bool
+	modTime time.Time
+	size    int64
+}
+
+type scriptGCResult struct {
+	Scanned        int
+	Protected      int
+	Removed        int
+	Failed         int
+	ReclaimedBytes int64
+	RemainingBytes int64
+}
+
+func loadScriptRetentionConfig() ScriptRetentionConfig {
+	config := ScriptRetentionConfig{}
+	if _, err := loadTaskConfigFile(scriptRetentionConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", scriptRetentionConfigFilename)
+		config = ScriptRetentionConfig{}
+	}
+	if config.MaxAgeHours <= 0 {
+		config.MaxAgeHours = defaultScriptMaxAgeHours
+	}
+	if config.MaxCount <= 0 {
+		config.MaxCount = defaultScriptMaxCount
+	}
+	if config.MaxTotalSize <= 0 {
+		config.MaxTotalSize = defaultScriptMaxTotalSize
+	}
+	if config.IntervalMinutes <= 0 {
+		config.IntervalMinutes = defaultScriptGCIntervalMins
+	}
+	return config
+}
+
+// scriptGCProtectedTaskIds returns ids of running and periodic tasks, whose
+// scripts and private directories must not be collected
+func scriptGCProtectedTaskIds() []string {
+	taskIds := GetTaskFactory().TaskNames()
+
+	_periodicTaskSchedulesLock.Lock()
+	defer _periodicTaskSchedulesLock.Unlock()
+	for taskId := range _periodicTaskSchedules {
+		taskIds = append(taskIds, taskId)
+	}
+	return taskIds
+}
+
+// scriptEntryOwnedBy reports whether script file named like "<taskId><ext>" or
+// "<commandName>-<taskId><ext>", or private directory named like
+// "<taskId>-<random>", belongs to task
+func scriptEntryOwnedBy(entry scriptGCEntry, taskId string) bool {
+	if taskId == "" {
+		return false
+	}
+	if entry.isDir {
+		return strings.HasPrefix(entry.name, taskId+"-")
+	}
+	name := strings.TrimSuffix(entry.name, filepath.Ext(entry.name))
+	return name == taskId || strings.HasSuffix(name, "-"+taskId)
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// listScriptGCEntries lists regular files in script directory and invocation
+// directories in base directories of private invocation directories, sandboxes
+// and result files
+func listScriptGCEntries(scriptDir string, baseDirs ...string) []scriptGCEntry {
+	var entries []scriptGCEntry
+	if scriptDir != "" {
+		if infos, err := ioutil.ReadDir(scriptDir); err == nil {
+			for _, info := range infos {
+				if !info.Mode().IsRegular() {
+					continue
+				}
+				entries = append(entries, scriptGCEntry{
+					path:    filepath.Join(scriptDir, info.Name()),
+					name:    info.Name(),
+					modTime: info.ModTime(),
+					size:    info.Size(),
+				})
+			}
+		}
+	}
+	for _, baseDir := range baseDirs {
+		if baseDir == "" {
+			continue
+		}
+		if infos, err := ioutil.ReadDir(baseDir); err == nil {
+			for _, info := range infos {
+				if !info.IsDir() || !invocationDirNamePattern.MatchString(info.Name()) {
+					continue
+				}
+				path := filepath.Join(baseDir, info.Name())
+				entries = append(entries, scriptGCEntry{
+					path:    path,
+					name:    info.Name(),
+					isDir:   true,
+					modTime: info.ModTime(),
+					size:    dirSize(path),
+				})
+			}
+		}
+	}
+	return entries
+}
+
+// collectGarbageScripts removes unprotected entries older than max age, and
+// then the oldest ones until both count and total size are within limits
+func collectGarbageScripts(entries []scriptGCEntry, config ScriptRetentionConfig, protectedTaskIds []string, now time.Time) scriptGCResult {
+	result := scriptGCResult{
+		Scanned: len(entries),
+	}
+	var candidates []scriptGCEntry
+	remainingCount := len(entries)
+	for _, entry := range entries {
+		result.RemainingBytes += entry.size
+		protected := now.Sub(entry.modTime) < minScriptGCAge
+		for _, taskId := range protectedTaskIds {
+			if protected {
+				break
+			}
+			protected = scriptEntryOwnedBy(entry, taskId)
+		}
+		if protected {
+			result.Protected++
+			continue
+		}
+		candidates = append(candidates, entry)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].modTime.Before(candidates[j].modTime)
+	})
+
+	maxAge := time.Duration(config.MaxAgeHours) * time.Hour
+	for _, entry := range candidates {
+		expired := now.Sub(entry.modTime) > maxAge
+		if !expired && remainingCount <= config.MaxCount && result.RemainingBytes <= config.MaxTotalSize {
+			// Candidates are sorted from the oldest, thus no more to collect
+			break
+		}
+		if entry.isDir {
+			// Sandbox directory kept for debugging may still be mounted
+			if err := unmountSandbox(entry.path); err != nil {
+				log.GetLogger().WithError(err).Warningf("Failed to unmount sandbox directory %s", entry.path)
+			}
+		}
+		if err := os.RemoveAll(entry.path); err != nil {
+			log.GetLogger().WithError(err).Warningf("Failed to remove saved script %s", entry.path)
+			result.Failed++
+			continue
+		}
+		result.Removed++
+		result.ReclaimedBytes += entry.size
+		result.RemainingBytes -= entry.size
+		remainingCount--
+	}
+	return result
+}
+
+// CollectGarbageScripts enforces retention policy on saved scripts and private
+// directories of invocations
+func CollectGarbageScripts() {
+	_scriptGCLock.Lock()
+	defer _scriptGCLock.Unlock()
+
+	logger := log.GetLogger().WithFields(logrus.Fields{
+		"module": "scriptGC",
+	})
+	config := loadScriptRetentionConfig()
+	if config.Disabled {
+		return
+	}
+
+	scriptDir, err := util.GetScriptPath()
+	if err != nil {
+		logger.WithError(err).Errorln("Failed to get script directory")
+		scriptDir = ""
+	}
+	privateBaseDir, err := getPrivateBaseDir()
+	if err != nil {
+		logger.WithError(err).Errorln("Failed to get base directory of private invocation directories")
+		privateBaseDir = ""
+	}
+	sandboxBaseDir, err := getSandboxBaseDir()
+	if err != nil {
+		logger.WithError(err).Errorln("Failed to get base directory of sandbox directories")
+		sandboxBaseDir = ""
+	}
+	resultBaseDir, err := getResultBaseDir()
+	if err != nil {
+		logger.WithError(err).Errorln("Failed to get base directory of result file directories")
+		resultBaseDir = ""
+	}
+
+	entries := listScriptGCEntries(scriptDir, privateBaseDir, sandboxBaseDir, resultBaseDir)
+	result := collectGarbageScripts(entries, config, scriptGCProtectedTaskIds(), time.Now())
+	logger.WithFields(logrus.Fields{
+		"scanned":        result.Scanned,
+		"protected":      result.Protected,
+		"removed":        result.Removed,
+		"failed":         result.Failed,
+		"reclaimedBytes": result.ReclaimedBytes,
+		"remainingBytes": result.RemainingBytes,
+	}).Infoln("Collected garbage saved scripts")
+}
+
+// InitScriptGCTimer collects garbage scripts immediately and then periodically
+func InitScriptGCTimer() error {
+	_scriptGCTimerInitLock.Lock()
+	defer _scriptGCTimerInitLock.Unlock()
+
+	if _scriptGCTimer != nil {
+		return errors.New("Script garbage collection timer has been initialized")
+	}
+	timerManager := timermanager.GetTimerManager()
+	if timerManager == nil {
+		return errors.New("Global TimerManager instance is not initialized")
+	}
+	config := loadScriptRetentionConfig()
+	timer, err := timerManager.CreateTimerInSeconds(CollectGarbageScripts, config.IntervalMinutes*60)
+	if err != nil {
+		return err
+	}
+	if _, err := timer.Run(); err != nil {
+		timerManager.DeleteTimer(timer)
+		return err
+	}
+	_scriptGCTimer = timer
+	return nil
+}
@@ -0,0 +1,137 @@
+package taskengine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createScriptGCEntry(t *testing.T, dir string, name string, size int, modTime time.Time) scriptGCEntry {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, make([]byte, size), 0600)
+	assert.NoError(t, err)
+	err = os.Chtimes(path, modTime, modTime)
+	assert.NoError(t, err)
+	return scriptGCEntry{
+		path:    path,
+		name:    name,
+		modTime: modTime,
+		size:    int64(size),
+	}
+}
+
+func TestScriptEntryOwnedBy(t *testing.T) {
+	assert.True(t, scriptEntryOwnedBy(scriptGCEntry{name: "t-123.sh"}, "t-123"))
+	assert.True(t, scriptEntryOwnedBy(scriptGCEntry{name: "mycommand-t-123.ps1"}, "t-123"))
+	assert.True(t, scriptEntryOwnedBy(scriptGCEntry{name: "t-123-abcdef", isDir: true}, "t-123"))
+	assert.False(t, scriptEntryOwnedBy(scriptGCEntry{name: "t-1234.sh"}, "t-123"))
+	assert.False(t, scriptEntryOwnedBy(scriptGCEntry{name: "t-1234-abcdef", isDir: true}, "t-123"))
+	assert.False(t, scriptEntryOwnedBy(scriptGCEntry{name: "t-123.sh"}, ""))
+}
+
+func TestCollectGarbageScripts(t *testing.T) {
+	now := time.Now()
+	config := ScriptRetentionConfig{
+		MaxAgeHours:  24,
+		MaxCount:     100,
+		MaxTotalSize: 1024 * 1024,
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "scriptgc")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		expired := createScriptGCEntry(t, dir, "t-1.sh", 10, now.Add(-48*time.Hour))
+		protected := createScriptGCEntry(t, dir, "t-2.sh", 20, now.Add(-48*time.Hour))
+		fresh := createScriptGCEntry(t, dir, "t-3.sh", 30, now.Add(-time.Hour))
+
+		entries := listScriptGCEntries(dir, "")
+		assert.Len(t, entries, 3)
+		result := collectGarbageScripts(entries, config, []string{"t-2"}, now)
+		assert.Equal(t, 3, result.Scanned)
+		assert.Equal(t, 1, result.Protected)
+		assert.Equal(t, 1, result.Removed)
+		assert.Equal(t, int64(10), result.ReclaimedBytes)
+		assert.Equal(t, int64(50), result.RemainingBytes)
+		assert.NoFileExists(t, expired.path)
+		assert.FileExists(t, protected.path)
+		assert.FileExists(t, fresh.path)
+	})
+
+	t.Run("overCountAndSize", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "scriptgc")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		entries := []scriptGCEntry{
+			createScriptGCEntry(t, dir, "t-1.sh", 100, now.Add(-4*time.Hour)),
+			createScriptGCEntry(t, dir, "t-2.sh", 100, now.Add(-3*time.Hour)),
+			createScriptGCEntry(t, dir, "t-3.sh", 100, now.Add(-2*time.Hour)),
+			createScriptGCEntry(t, dir, "t-4.sh", 100, now.Add(-time.Hour)),
+		}
+
+		countLimited := config
+		countLimited.MaxCount = 3
+		result := collectGarbageScripts(entries, countLimited, nil, now)
+		assert.Equal(t, 1, result.Removed)
+		assert.NoFileExists(t, entries[0].path)
+		assert.FileExists(t, entries[1].path)
+
+		sizeLimited := config
+		sizeLimited.MaxTotalSize = 150
+		result = collectGarbageScripts(entries[1:], sizeLimited, nil, now)
+		assert.Equal(t, 2, result.Removed)
+		assert.Equal(t, int64(100), result.RemainingBytes)
+		assert.NoFileExists(t, entries[2].path)
+		assert.FileExists(t, entries[3].path)
+	})
+
+	t.Run("gracePeriod", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "scriptgc")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		young := createScriptGCEntry(t, dir, "t-1.sh", 100, now.Add(-time.Minute))
+		limited := config
+		limited.MaxCount = 0
+		limited.MaxTotalSize = 0
+		result := collectGarbageScripts([]scriptGCEntry{young}, limited, nil, now)
+		assert.Equal(t, 1, result.Protected)
+		assert.Equal(t, 0, result.Removed)
+		assert.FileExists(t, young.path)
+	})
+
+	t.Run("privateDirectory", func(t *testing.T) {
+		baseDir, err := ioutil.TempDir("", "scriptgc")
+		assert.NoError(t, err)
+		defer os.RemoveAll(baseDir)
+
+		privateDir := filepath.Join(baseDir, "t-1-123456")
+		assert.NoError(t, os.Mkdir(privateDir, 0700))
+		createScriptGCEntry(t, privateDir, "script.sh", 10, now)
+		modTime := now.Add(-48 * time.Hour)
+		assert.NoError(t, os.Chtimes(privateDir, modTime, modTime))
+		// Directories not created for invocations are never collected
+		foreignDirs := []string{filepath.Join(baseDir, "data"), filepath.Join(baseDir, "t-1-abcdef")}
+		for _, foreignDir := range foreignDirs {
+			assert.NoError(t, os.Mkdir(foreignDir, 0700))
+			assert.NoError(t, os.Chtimes(foreignDir, modTime, modTime))
+		}
+
+		entries := listScriptGCEntries("", baseDir)
+		assert.Len(t, entries, 1)
+		assert.True(t, entries[0].isDir)
+		assert.Equal(t, int64(10), entries[0].size)
+		result := collectGarbageScripts(entries, config, nil, now)
+		assert.Equal(t, 1, result.Removed)
+		assert.NoDirExists(t, privateDir)
+		for _, foreignDir := range foreignDirs {
+			assert.DirExists(t, foreignDir)
+		}
+	})
+}
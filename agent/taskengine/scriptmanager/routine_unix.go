@@ -0,0 +1,28 @@
+// +build linux freebsd
+
+package scriptmanager
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// SaveScriptFileExclusive creates script file which must not exist before,
+// and refuses to follow symbolic link at savePath, thus content could never be
+// written into file prepared by others
+func SaveScriptFileExclusive(savePath string, content string, perm os.FileMode) error {
+	file, err := os.OpenFile(savePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, perm)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return ErrScriptFileExists
+		}
+		return err
+	}
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,37 @@
+package taskengine
+
+import (
+	"sync"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/taskengine/parameters"
+)
+
+const (
+	secretResolversConfigFilename = "task_secret_resolvers.json"
+)
+
+var (
+	_secretResolvers     *parameters.SecretResolvers
+	_secretResolversOnce sync.Once
+)
+
+// getSecretResolvers returns resolvers shared by all tasks, thus resolved
+// values could be cached across invocations. Configuration is loaded only once
+// from task_secret_resolvers.json in config directory.
+func getSecretResolvers() *parameters.SecretResolvers {
+	_secretResolversOnce.Do(func() {
+		config := parameters.SecretResolversConfig{}
+		if _, err := loadTaskConfigFile(secretResolversConfigFilename, &config); err != nil {
+			log.GetLogger().WithError(err).Errorf("Failed to load %s, only built-in secret resolvers are available", secretResolversConfigFilename)
+			config = parameters.SecretResolversConfig{}
+		}
+
+		var errs []error
+		_secretResolvers, errs = parameters.NewSecretResolvers(config)
+		for _, err := range errs {
+			log.GetLogger().WithError(err).Errorln("Ignored invalid secret resolver configuration")
+		}
+	})
+	return _secretResolvers
+}
@@ -2,8 +2,9 @@ package taskengine
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	neturl "net/url"
 	"os"
 	"os/user"
 	"path"
@@ -15,24 +16,27 @@ import (
 	"github.com/aliyun/aliyun_assist_client/agent/log"
 	"github.com/aliyun/aliyun_assist_client/agent/metrics"
 	"github.com/aliyun/aliyun_assist_client/agent/util"
+	"github.com/aliyun/aliyun_assist_client/agent/util/langutil"
 )
 
 const (
-	ESuccess            = 0
-	EFileCreateFail     = 1
-	EChownError         = 2
-	EChmodError         = 3
-	ECreateDirFailed    = 4
-	EInvalidFilePath    = 10
-	EFileAlreadyExist   = 11
-	EEmptyContent       = 12
-	EInvalidContent     = 13
-	EInvalidContentType = 14
-	EInvalidFileType    = 15
-	EInvalidSignature   = 16
-	EInalidFileMode     = 17
-	EInalidGID          = 18
-	EInalidUID          = 19
+	ESuccess             = 0
+	EFileCreateFail      = 1
+	EChownError          = 2
+	EChmodError          = 3
+	ECreateDirFailed     = 4
+	EInvalidFilePath     = 10
+	EFileAlreadyExist    = 11
+	EEmptyContent        = 12
+	EInvalidContent      = 13
+	EInvalidContentType  = 14
+	EInvalidFileType     = 15
+	EInvalidSignature    = 16
+	EInalidFileMode      = 17
+	EInalidGID           = 18
+	EInalidUID           = 19
+	EPolicyDenied        = 20
+	EInvalidTextEncoding = 21
 )
 
 var G_IsWindows bool = false
@@ -80,6 +84,12 @@ func SendFileFinished(sendFile SendFileTaskInfo, status int) {
 }
 
 func SendFileInvalid(sendFile SendFileTaskInfo, status int) {
+	sendFileInvalid(sendFile, status, nil)
+}
+
+// sendFileInvalid reports invalid file sending, with rule and reason of local
+// policy when denied by it the same as invocations
+func sendFileInvalid(sendFile SendFileTaskInfo, status int, reason error) {
 	url := util.GetInvalidTaskService()
 	key := ""
 	value := ""
@@ -105,12 +115,27 @@ func SendFileInvalid(sendFile SendFileTaskInfo, status int) {
 	} else if status == EInalidUID {
 		key = "FileOwnerNotExist"
 		value = sendFile.Owner
+	} else if status == EPolicyDenied {
+		key = "PolicyDenied"
+		value = sendFile.Destination
+		var deniedErr *PolicyDeniedError
+		if errors.As(reason, &deniedErr) {
+			value = deniedErr.Error()
+		}
+	} else if status == EInvalidTextEncoding {
+		key = "InvalidTextEncoding"
+		value = sendFile.TextEncoding
 	}
 	metrics.GetTaskFailedEvent(
 		"taskid", sendFile.TaskID,
 		"errormsg", fmt.Sprintf("%s : %s", key, value),
 	).ReportEvent()
-	url = url + "?" + "taskId=" + sendFile.TaskID + "&taskType=sendfile&param=" + key + "&value=" + value
+	params := neturl.Values{}
+	params.Set("taskId", sendFile.TaskID)
+	params.Set("taskType", "sendfile")
+	params.Set("param", key)
+	params.Set("value", value)
+	url = url + "?" + params.Encode()
 	log.GetLogger().Printf("post = %s", url)
 	_, err := util.HttpPost(url, "", "text")
 	if err != nil {
@@ -119,21 +144,23 @@ func SendFileInvalid(sendFile SendFileTaskInfo, status int) {
 }
 
 func doSendFile(task SendFileTaskInfo) {
-	ret := sendFile(task)
+	ret, err := sendFile(task)
 	log.GetLogger().Println("sendFile ret: ", ret)
 	if ret <= ECreateDirFailed {
 		SendFileFinished(task, ret)
 	} else {
-		SendFileInvalid(task, ret)
+		sendFileInvalid(task, ret, err)
 	}
 }
 
-func sendFile(sendFile SendFileTaskInfo) int {
-	if sendFile.Name == "" {
-		return EInvalidFilePath
+// sendFile returns error describing the failure only when denied by local
+// policy
+func sendFile(sendFile SendFileTaskInfo) (int, error) {
+	if !isSinglePathElement(sendFile.Name) {
+		return EInvalidFilePath, nil
 	}
 	if sendFile.Content == "" {
-		return EEmptyContent
+		return EEmptyContent, nil
 	}
 	fileDir := ""
 	if sendFile.Destination == "" {
@@ -148,47 +175,66 @@ func sendFile(sendFile SendFileTaskInfo) int {
 		fileDir = sendFile.Destination
 	}
 
+	file_path := path.Join(fileDir, sendFile.Name)
+
+	// Policy is evaluated on the file itself, thus neither symbolic link at
+	// its place nor in the destination could lead it out of allowed directory
+	if err := evaluateLocalPolicy(func(policy *CommandPolicy) error {
+		return policy.EvaluateSendFile(file_path)
+	}); err != nil {
+		log.GetLogger().WithError(err).Errorln("PolicyDenied: file sending denied by local policy")
+		return EPolicyDenied, err
+	}
+
 	if sendFile.Destination != "" {
 		err := os.MkdirAll(sendFile.Destination, os.ModePerm)
 		if err != nil {
 			log.GetLogger().Errorln("MkdirAll error: ", err)
-			return ECreateDirFailed
+			return ECreateDirFailed, nil
 		}
 	}
 	if G_IsLinux || G_IsFreebsd {
 		//文件下发时，如果root目录有一个test的文件，又创建了一个/root/test下的文件，则会报错。报错应通过invalid接口上报
 		if util.IsFile(sendFile.Destination) {
-			return EInvalidFilePath
+			return EInvalidFilePath, nil
 		}
 	}
-	file_path := path.Join(fileDir, sendFile.Name)
 	fileContent, err := base64.StdEncoding.DecodeString(sendFile.Content)
 	if err != nil {
 		log.GetLogger().Errorln("base64 decode error: ", err)
-		return EInvalidContent
+		return EInvalidContent, nil
 	}
 
 	contentMd5 := util.ComputeStrMd5(sendFile.Content)
 
 	if strings.ToLower(contentMd5) != strings.ToLower(sendFile.Signature) {
-		return EInvalidSignature
+		return EInvalidSignature, nil
+	}
+	if charset, err := sendFileCharset(sendFile.TextEncoding); err != nil {
+		log.GetLogger().WithError(err).Errorln("Invalid text encoding of file")
+		return EInvalidTextEncoding, nil
+	} else if charset != nil {
+		if fileContent, err = langutil.EncodeFromUTF8(fileContent, charset); err != nil {
+			log.GetLogger().WithError(err).Errorln("Failed to convert text encoding of file")
+			return EInvalidTextEncoding, nil
+		}
 	}
 	fileMode := sendFile.Mode
 	if len(fileMode) != 3 && len(fileMode) != 4 && len(fileMode) != 0 {
-		return EInalidFileMode
+		return EInalidFileMode, nil
 	}
 	if len(fileMode) == 0 {
 		fileMode = "0644"
 	}
 	fMode, err := strconv.ParseInt(fileMode, 8, 32)
 	if err != nil {
-		return EInalidFileMode
+		return EInalidFileMode, nil
 	}
 	ret := writeFile(file_path, fileContent, sendFile.Overwrite, os.FileMode(fMode))
 	if ret != ESuccess {
-		return ret
+		return ret, nil
 	}
-	return changeFileOwner(file_path, sendFile.Owner, sendFile.Group)
+	return changeFileOwner(file_path, sendFile.Owner, sendFile.Group), nil
 }
 
 func changeFileOwner(filePath string, User string, Group string) int {
@@ -222,7 +268,7 @@ func changeFileOwner(filePath string, User string, Group string) int {
 		return EInalidGID
 	}
 	gid, _ := strconv.Atoi(lg.Gid)
-	err = os.Chown(filePath, uid, gid)
+	err = os.Lchown(filePath, uid, gid)
 	if err != nil {
 		log.GetLogger().Printf("Chown file %s error:%s ", filePath, err.Error())
 		return EChownError
@@ -235,13 +281,27 @@ func writeFile(filePath string, data []byte, overWrite bool, fileMode os.FileMod
 	if fileExist && !overWrite {
 		return EFileAlreadyExist
 	}
-	err := ioutil.WriteFile(filePath, data, 0644)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overWrite {
+		flag |= os.O_EXCL
+	}
+	// Symbolic link swapped in place of the file after policy evaluation is
+	// never followed
+	f, err := openSendFile(filePath, flag, 0644)
 	if err != nil {
+		log.GetLogger().Errorln("WriteFile: ", err)
+		if os.IsExist(err) {
+			return EFileAlreadyExist
+		}
+		return EFileCreateFail
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
 		log.GetLogger().Errorln("WriteFile: ", err)
 		return EFileCreateFail
 	}
 	if G_IsLinux {
-		err = os.Chmod(filePath, fileMode)
+		err = f.Chmod(fileMode)
 		if err != nil {
 			log.GetLogger().Errorln(" Chmod faild", err)
 			return EChmodError
@@ -1,12 +1,22 @@
 package taskengine
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"bou.ke/monkey"
 	"github.com/aliyun/aliyun_assist_client/agent/util"
 	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSendFileFinished(t *testing.T) {
@@ -100,3 +110,101 @@ func TestSendFileInvalid(t *testing.T) {
 		})
 	}
 }
+
+func TestSendFileDeniedByPolicy(t *testing.T) {
+	mockMetrics()
+	defer util.NilRequest.Clear()
+	defer httpmock.DeactivateAndReset()
+	dir, err := ioutil.TempDir("", "sendfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	allowedDir := filepath.Join(dir, "conf")
+	defer setupTaskConfigDir(t, map[string]string{
+		policyConfigFilename: fmt.Sprintf(`{"allowedFileDestinations": [%q]}`, allowedDir),
+	})()
+	var reportedUrl string
+	guard := monkey.Patch(util.HttpPostWithTimeout, func(url string, data string, contentType string, timeout time.Duration, noLog bool) (string, error) {
+		reportedUrl = url
+		return "", nil
+	})
+	defer guard.Unpatch()
+
+	sendFileTask := SendFileTaskInfo{
+		Content:     "Y29uZg==",
+		Destination: dir,
+		Name:        "passwd",
+		TaskID:      "t-sendfile-denied",
+	}
+	ret, err := sendFile(sendFileTask)
+	assert.Equal(t, EPolicyDenied, ret)
+	assertDeniedByRule(t, "allowedFileDestinations", err)
+
+	// Rule and reason are reported the same as denied invocations
+	doSendFile(sendFileTask)
+	params, err := url.ParseQuery(reportedUrl[strings.Index(reportedUrl, "?")+1:])
+	assert.NoError(t, err)
+	assert.Equal(t, "PolicyDenied", params.Get("param"))
+	assert.Equal(t, fmt.Sprintf("Denied by rule allowedFileDestinations of local policy: destination %s is not allowed", filepath.Join(dir, "passwd")), params.Get("value"))
+
+	// Values from the task are escaped in query string as well
+	sendFileTask.Destination = allowedDir
+	sendFileTask.Signature = util.ComputeStrMd5(sendFileTask.Content)
+	sendFileTask.TextEncoding = "no-such&param=x"
+	doSendFile(sendFileTask)
+	params, err = url.ParseQuery(reportedUrl[strings.Index(reportedUrl, "?")+1:])
+	assert.NoError(t, err)
+	assert.Equal(t, "t-sendfile-denied", params.Get("taskId"))
+	assert.Equal(t, "sendfile", params.Get("taskType"))
+	assert.Equal(t, "InvalidTextEncoding", params.Get("param"))
+	assert.Equal(t, "no-such&param=x", params.Get("value"))
+}
+
+func TestSendFileNeverEscapesDestination(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symbolic links requires privilege on Windows")
+	}
+	dir, err := ioutil.TempDir("", "sendfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	allowedDir := filepath.Join(dir, "conf")
+	outsideDir := filepath.Join(dir, "outside")
+	assert.NoError(t, os.MkdirAll(allowedDir, 0755))
+	assert.NoError(t, os.MkdirAll(outsideDir, 0755))
+	defer setupTaskConfigDir(t, map[string]string{
+		policyConfigFilename: fmt.Sprintf(`{"allowedFileDestinations": [%q]}`, allowedDir),
+	})()
+
+	content := base64.StdEncoding.EncodeToString([]byte("conf"))
+	sendFileTask := SendFileTaskInfo{
+		Content:     content,
+		Destination: allowedDir,
+		Signature:   util.ComputeStrMd5(content),
+		Overwrite:   true,
+		TaskID:      "t-sendfile-escape",
+	}
+	for _, name := range []string{"", ".", "..", "../outside/x", "sub/x", `sub\x`} {
+		sendFileTask.Name = name
+		ret, _ := sendFile(sendFileTask)
+		assert.Equal(t, EInvalidFilePath, ret, name)
+	}
+
+	// Symbolic link at the place of file is resolved by policy evaluation
+	assert.NoError(t, os.Symlink(filepath.Join(outsideDir, "x"), filepath.Join(allowedDir, "link")))
+	sendFileTask.Name = "link"
+	ret, err := sendFile(sendFileTask)
+	assert.Equal(t, EPolicyDenied, ret)
+	assertDeniedByRule(t, "allowedFileDestinations", err)
+
+	// and never followed when writing file
+	assert.Equal(t, EFileCreateFail, writeFile(filepath.Join(allowedDir, "link"), []byte("conf"), true, 0644))
+	_, err = os.Lstat(filepath.Join(outsideDir, "x"))
+	assert.True(t, os.IsNotExist(err))
+
+	sendFileTask.Name = "app.conf"
+	ret, err = sendFile(sendFileTask)
+	assert.Equal(t, ESuccess, ret)
+	assert.NoError(t, err)
+	written, err := ioutil.ReadFile(filepath.Join(allowedDir, "app.conf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "conf", string(written))
+}
@@ -0,0 +1,13 @@
+// +build linux freebsd
+
+package taskengine
+
+import (
+	"os"
+	"syscall"
+)
+
+// openSendFile fails on symbolic link at the place of file to be written
+func openSendFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag|syscall.O_NOFOLLOW, perm)
+}
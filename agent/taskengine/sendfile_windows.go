@@ -0,0 +1,9 @@
+package taskengine
+
+import (
+	"os"
+)
+
+func openSendFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag, perm)
+}
@@ -164,8 +164,27 @@ func DoSessionTask(tasks [] SessionTaskInfo) {
 	}()
 }
 
+// sessionRunAsUser returns the user whom session would run as, which is
+// consistent with shell plugin
+func (sessionTask *SessionTask) sessionRunAsUser() string {
+	if sessionTask.username != "" {
+		return sessionTask.username
+	}
+	if G_IsWindows {
+		return "system"
+	}
+	return "ecs-assist-user"
+}
+
 func (sessionTask *SessionTask) RunTask(taskid string) error{
 	log.GetLogger().Infoln("run task", taskid, sessionTask.sessionId)
+	if err := evaluateLocalPolicy(func(policy *CommandPolicy) error {
+		return policy.EvaluateSession(sessionTask.sessionRunAsUser(), sessionTask.isPortForwardTask())
+	}); err != nil {
+		log.GetLogger().WithError(err).Errorln("PolicyDenied: session denied by local policy", sessionTask.sessionId)
+		ReportSessionResult(taskid, shell.Policy_denied)
+		return err
+	}
 	code,err := sessionTask.runTask()
 	ReportSessionResult(taskid, code)
 	sessionTask.sessionChannel.Close()
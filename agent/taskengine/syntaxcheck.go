@@ -0,0 +1,175 @@
+package taskengine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/util/langutil"
+)
+
+const (
+	syntaxCheckConfigFilename = "task_syntax_check.json"
+
+	defaultSyntaxCheckTimeout = 30
+	// Parser message longer than this is truncated in report
+	maxSyntaxCheckOutputSize = 4096
+)
+
+var (
+	ErrSyntaxCheckTimeout = errors.New("Syntax check timed out")
+
+	// Shells supporting -n option to read commands without executing them
+	syntaxCheckShells = map[string]bool{
+		"sh":   true,
+		"bash": true,
+		"dash": true,
+		"ksh":  true,
+		"zsh":  true,
+	}
+
+	// `python -m py_compile` always writes bytecode next to script, thus the
+	// source is compiled in memory instead
+	pythonSyntaxCheckArgs = []string{
+		"-c",
+		"import sys; compile(open(sys.argv[1], 'rb').read(), sys.argv[1], 'exec')",
+		interpreterScriptPlaceholder,
+	}
+)
+
+// SyntaxCheckConfig is loaded from task_syntax_check.json in config directory.
+// Syntax check could also be requested per invocation by syntaxCheck field.
+type SyntaxCheckConfig struct {
+	Enabled bool `json:"enabled"`
+	// Timeout of syntax check in seconds
+	Timeout int `json:"timeout"`
+}
+
+// SyntaxCheckError carries message of parser when script fails syntax check
+type SyntaxCheckError struct {
+	Output string
+}
+
+func (e *SyntaxCheckError) Error() string {
+	// Only the first line is used as brief description
+	firstLine := strings.TrimSpace(e.Output)
+	if idx := strings.IndexByte(firstLine, '\n'); idx >= 0 {
+		firstLine = strings.TrimSpace(firstLine[:idx])
+	}
+	if firstLine == "" {
+		return "Script failed syntax check"
+	}
+	return "Script failed syntax check: " + firstLine
+}
+
+func loadSyntaxCheckConfig() SyntaxCheckConfig {
+	config := SyntaxCheckConfig{}
+	if _, err := loadTaskConfigFile(syntaxCheckConfigFilename, &config); err != nil {
+		log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", syntaxCheckConfigFilename)
+		config = SyntaxCheckConfig{}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultSyntaxCheckTimeout
+	}
+	return config
+}
+
+// substituteScriptPath replaces {{script}} placeholder in argument template
+func substituteScriptPath(argsTemplate []string, scriptPath string) []string {
+	args := make([]string, 0, len(argsTemplate))
+	for _, arg := range argsTemplate {
+		args = append(args, strings.ReplaceAll(arg, interpreterScriptPlaceholder, scriptPath))
+	}
+	return args
+}
+
+// envCommandName returns command run by env with specified arguments, after
+// its leading options and variable assignments are skipped
+func envCommandName(envArgs []string) string {
+	for i := 0; i < len(envArgs); i++ {
+		arg := envArgs[i]
+		switch {
+		case arg == "-u" || arg == "-C":
+			// Option taking value in the following argument
+			i++
+		case strings.HasPrefix(arg, "-") || strings.Contains(arg, "="):
+		default:
+			return arg
+		}
+	}
+	return ""
+}
+
+// syntaxCheckCommand returns command to check syntax of saved script without
+// executing it. false is returned when syntax of the script could not be
+// checked, e.g., batch scripts or scripts of interpreters without syntax check
+// configured.
+func syntaxCheckCommand(cmdType string, content string, interpreter *Interpreter, scriptPath string) (string, []string, bool) {
+	switch cmdType {
+	case "RunShellScript":
+		if G_IsWindows {
+			return "", nil, false
+		}
+		shebangInterpreter, shebangArgs, ok := parseShebang(content)
+		if !ok {
+			return "sh", []string{"-n", scriptPath}, true
+		}
+		// Support "#!/usr/bin/env bash" and "#!/usr/bin/env -S bash -e" as well
+		if filepath.Base(shebangInterpreter) == "env" && len(shebangArgs) > 0 {
+			shebangInterpreter = envCommandName(strings.Fields(shebangArgs[0]))
+		}
+		if syntaxCheckShells[filepath.Base(shebangInterpreter)] {
+			return shebangInterpreter, []string{"-n", scriptPath}, true
+		}
+		if strings.HasPrefix(filepath.Base(shebangInterpreter), "python") {
+			return shebangInterpreter, substituteScriptPath(pythonSyntaxCheckArgs, scriptPath), true
+		}
+		return "", nil, false
+	case "RunPowerShellScript":
+		// Parse script by PowerShell language parser, and single quotes in
+		// path are escaped by doubling them
+		quotedPath := "'" + strings.ReplaceAll(scriptPath, "'", "''") + "'"
+		parseScript := "$errors = $null; " +
+			"[System.Management.Automation.Language.Parser]::ParseFile(" + quotedPath + ", [ref]$null, [ref]$errors) | Out-Null; " +
+			"if ($errors) { $errors | ForEach-Object { $_.ToString() }; exit 1 }"
+		return "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", parseScript}, true
+	default:
+		if interpreter == nil || len(interpreter.SyntaxCheckArgs) == 0 {
+			return "", nil, false
+		}
+		return interpreter.Path, substituteScriptPath(interpreter.SyntaxCheckArgs, scriptPath), true
+	}
+}
+
+// runSyntaxCheck runs syntax checking command and returns SyntaxCheckError
+// with parser message when the script is invalid
+func runSyntaxCheck(name string, args []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrSyntaxCheckTimeout
+	}
+	if err == nil {
+		return nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	message := convertCommandOutput(output.String())
+	return &SyntaxCheckError{
+		Output: langutil.SafeTruncateStringInBytes(message, maxSyntaxCheckOutputSize),
+	}
+}
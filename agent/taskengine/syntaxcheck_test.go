@@ -0,0 +1,86 @@
+package taskengine
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyntaxCheckCommand(t *testing.T) {
+	if G_IsWindows {
+		t.Skip("Shell script is not checked on Windows")
+	}
+
+	name, args, ok := syntaxCheckCommand("RunShellScript", "echo hello", nil, "/tmp/t.sh")
+	assert.True(t, ok)
+	assert.Equal(t, "sh", name)
+	assert.Equal(t, []string{"-n", "/tmp/t.sh"}, args)
+
+	name, args, ok = syntaxCheckCommand("RunShellScript", "#!/usr/bin/env bash\necho hello", nil, "/tmp/t.sh")
+	assert.True(t, ok)
+	assert.Equal(t, "bash", name)
+	assert.Equal(t, []string{"-n", "/tmp/t.sh"}, args)
+
+	name, args, ok = syntaxCheckCommand("RunShellScript", "#!/usr/bin/env -S bash -e\necho hello", nil, "/tmp/t.sh")
+	assert.True(t, ok)
+	assert.Equal(t, "bash", name)
+	assert.Equal(t, []string{"-n", "/tmp/t.sh"}, args)
+
+	name, args, ok = syntaxCheckCommand("RunShellScript", "#!/usr/bin/env -i -u HOME LANG=C python3\nprint(1)", nil, "/tmp/t.sh")
+	assert.True(t, ok)
+	assert.Equal(t, "python3", name)
+	assert.Equal(t, "/tmp/t.sh", args[len(args)-1])
+
+	_, _, ok = syntaxCheckCommand("RunShellScript", "#!/usr/bin/env -S\necho hello", nil, "/tmp/t.sh")
+	assert.False(t, ok)
+
+	name, args, ok = syntaxCheckCommand("RunShellScript", "#!/usr/bin/python3\nprint(1)", nil, "/tmp/t.sh")
+	assert.True(t, ok)
+	assert.Equal(t, "/usr/bin/python3", name)
+	assert.Equal(t, "/tmp/t.sh", args[len(args)-1])
+
+	_, _, ok = syntaxCheckCommand("RunShellScript", "#!/usr/bin/perl\nprint 1", nil, "/tmp/t.sh")
+	assert.False(t, ok)
+
+	python := builtinInterpreters()["python"]
+	name, args, ok = syntaxCheckCommand("RunPythonScript", "print(1)", &python, "/tmp/t.py")
+	assert.True(t, ok)
+	assert.Equal(t, python.Path, name)
+	assert.Equal(t, "/tmp/t.py", args[len(args)-1])
+
+	_, _, ok = syntaxCheckCommand("RunInterpreterScript", "", &Interpreter{Path: "perl"}, "/tmp/t.pl")
+	assert.False(t, ok)
+}
+
+func TestRunSyntaxCheck(t *testing.T) {
+	if G_IsWindows {
+		t.Skip("Shell script is not checked on Windows")
+	}
+
+	dir, err := ioutil.TempDir("", "syntax_check")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Script body must never be executed during syntax check
+	marker := filepath.Join(dir, "executed")
+	validScript := filepath.Join(dir, "valid.sh")
+	assert.NoError(t, ioutil.WriteFile(validScript, []byte("touch "+marker+"\n"), 0600))
+	assert.NoError(t, runSyntaxCheck("sh", []string{"-n", validScript}, 10*time.Second))
+	assert.NoFileExists(t, marker)
+
+	invalidScript := filepath.Join(dir, "invalid.sh")
+	assert.NoError(t, ioutil.WriteFile(invalidScript, []byte("touch "+marker+"\nif true; then\necho unterminated\n"), 0600))
+	err = runSyntaxCheck("sh", []string{"-n", invalidScript}, 10*time.Second)
+	var syntaxErr *SyntaxCheckError
+	if assert.True(t, errors.As(err, &syntaxErr)) {
+		assert.NotEmpty(t, syntaxErr.Output)
+		assert.True(t, strings.HasPrefix(syntaxErr.Error(), "Script failed syntax check"))
+	}
+	assert.NoFileExists(t, marker)
+}
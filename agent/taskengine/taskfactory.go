@@ -58,6 +58,18 @@ func (t *TaskFactory) ContainsTaskByName(name string) bool {
 	return ok
 }
 
+// TaskNames returns names of all tasks registered in TaskFactory
+func (t *TaskFactory) TaskNames() []string {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	names := make([]string, 0, len(t.tasks))
+	for name := range t.tasks {
+		names = append(names, name)
+	}
+	return names
+}
+
 // IsAnyTaskRunning returns true when any task exists in TaskFactory, otherwise
 // false.
 func (t *TaskFactory) IsAnyTaskRunning() bool {
@@ -0,0 +1,23 @@
+package taskengine
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// taskIdFileName returns task id as name of files kept by agent for the task,
+// or false when it is not a single path element and thus unsafe to be joined
+// with any directory
+func taskIdFileName(taskId string) (string, bool) {
+	if !isSinglePathElement(taskId) {
+		return "", false
+	}
+	return taskId, true
+}
+
+// isSinglePathElement reports whether name could only refer to an entry right
+// in the directory it is joined with
+func isSinglePathElement(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
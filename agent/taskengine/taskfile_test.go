@@ -0,0 +1,70 @@
+package taskengine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/agent/util"
+)
+
+// setupTaskFileDirs redirects cache and script directories of agent, under
+// which files are kept for tasks, into a temporary directory
+func setupTaskFileDirs(t *testing.T) func() {
+	tempDir, err := ioutil.TempDir("", "task_files")
+	assert.NoError(t, err)
+	cacheDir := filepath.Join(tempDir, "cache")
+	scriptDir := filepath.Join(tempDir, "script")
+	assert.NoError(t, os.MkdirAll(cacheDir, 0700))
+	assert.NoError(t, os.MkdirAll(scriptDir, 0700))
+
+	cacheGuard := monkey.Patch(util.GetCachePath, func() (string, error) {
+		return cacheDir, nil
+	})
+	scriptGuard := monkey.Patch(util.GetScriptPath, func() (string, error) {
+		return scriptDir, nil
+	})
+	return func() {
+		cacheGuard.Unpatch()
+		scriptGuard.Unpatch()
+		os.RemoveAll(tempDir)
+	}
+}
+
+// setupTaskConfigDir redirects configuration directories of agent into a
+// temporary directory, where specified configuration files are written
+func setupTaskConfigDir(t *testing.T, files map[string]string) func() {
+	configDir, err := ioutil.TempDir("", "task_config")
+	assert.NoError(t, err)
+	for filename, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(configDir, filename), []byte(content), 0600))
+	}
+
+	crossVersionGuard := monkey.Patch(util.GetCrossVersionConfigPath, func() (string, error) {
+		return configDir, nil
+	})
+	currentVersionGuard := monkey.Patch(util.GetConfigPath, func() (string, error) {
+		return configDir, nil
+	})
+	return func() {
+		crossVersionGuard.Unpatch()
+		currentVersionGuard.Unpatch()
+		os.RemoveAll(configDir)
+	}
+}
+
+func TestTaskIdFileName(t *testing.T) {
+	for _, taskId := range []string{"t-1", "t-1-parallel-2", "t.1"} {
+		name, ok := taskIdFileName(taskId)
+		assert.True(t, ok, taskId)
+		assert.Equal(t, taskId, name)
+	}
+	for _, taskId := range []string{"", ".", "..", "../t-1", "t/1", `t\1`, "/t-1"} {
+		_, ok := taskIdFileName(taskId)
+		assert.False(t, ok, taskId)
+	}
+}
@@ -1,17 +1,119 @@
 package taskengine
 
-import "sync"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
 
-const maxPendingTasks  = 50
-const maxRunningTasks  = 10
+	"github.com/aliyun/aliyun_assist_client/agent/log"
+	"github.com/aliyun/aliyun_assist_client/agent/metrics"
+)
+
+const (
+	taskPoolConfigFilename = "task_pool.json"
+
+	defaultMaxPendingTasks = 50
+	defaultMaxRunningTasks = 10
+)
 
 type TaskFunction func()
 
-var poolTask *taskPool
-var lockPool    sync.Mutex
+// TaskLane classifies tasks submitted to pool. Each lane has its own queue,
+// and pending tasks in lane of higher priority are always picked first.
+type TaskLane int
+
+const (
+	// One-off invocations triggered by user
+	TaskLaneInteractive TaskLane = iota
+	// Invocations of cron, rate and at tasks
+	TaskLanePeriodic
+	// Pre-checking of testing tasks
+	TaskLanePrecheck
+)
+
+var (
+	ErrTaskQueueFull   = errors.New("Task queue is full")
+	ErrUnknownTaskLane = errors.New("Unknown task lane")
+
+	taskLaneNames = map[TaskLane]string{
+		TaskLaneInteractive: "interactive",
+		TaskLanePeriodic:    "periodic",
+		TaskLanePrecheck:    "precheck",
+	}
+)
+
+func (l TaskLane) String() string {
+	if name, ok := taskLaneNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("lane(%d)", int(l))
+}
+
+// TaskPoolConfig limits concurrency of pool and length of queue of each lane,
+// where MaxPendingTasks is keyed by lane name
+type TaskPoolConfig struct {
+	MaxRunningTasks int            `json:"maxRunningTasks"`
+	MaxPendingTasks map[string]int `json:"maxPendingTasks"`
+}
+
+// taskPoolsConfig is loaded from task_pool.json in config directory
+type taskPoolsConfig struct {
+	Task     TaskPoolConfig `json:"task"`
+	Precheck TaskPoolConfig `json:"precheck"`
+}
+
+// TaskLaneStats is the snapshot of queue of one lane
+type TaskLaneStats struct {
+	Lane       string `json:"lane"`
+	Pending    int    `json:"pending"`
+	MaxPending int    `json:"maxPending"`
+	Rejected   uint64 `json:"rejected"`
+}
+
+// TaskPoolStats is the snapshot of pool for monitoring
+type TaskPoolStats struct {
+	Name       string          `json:"name"`
+	Running    int             `json:"running"`
+	MaxRunning int             `json:"maxRunning"`
+	Lanes      []TaskLaneStats `json:"lanes"`
+}
+
+var (
+	poolTask *taskPool
+	lockPool sync.Mutex
+
+	_taskPoolsConfig     *taskPoolsConfig
+	_taskPoolsConfigLock sync.Mutex
+)
 
 type taskPool struct {
-	taskQueue   chan TaskFunction
+	name string
+	// Lanes served by pool in descending order of priority
+	lanes      []TaskLane
+	maxRunning int
+	maxPending map[TaskLane]int
+
+	pending  map[TaskLane][]TaskFunction
+	running  int
+	rejected map[TaskLane]uint64
+	mutex    sync.Mutex
+	cond     *sync.Cond
+}
+
+func loadTaskPoolsConfig() taskPoolsConfig {
+	_taskPoolsConfigLock.Lock()
+	defer _taskPoolsConfigLock.Unlock()
+
+	if _taskPoolsConfig == nil {
+		config := taskPoolsConfig{}
+		if _, err := loadTaskConfigFile(taskPoolConfigFilename, &config); err != nil {
+			log.GetLogger().WithError(err).Errorf("Failed to load %s, use default configuration", taskPoolConfigFilename)
+			config = taskPoolsConfig{}
+		}
+		_taskPoolsConfig = &config
+	}
+	return *_taskPoolsConfig
 }
 
 func GetPool() *taskPool {
@@ -19,22 +121,38 @@ func GetPool() *taskPool {
 	defer lockPool.Unlock()
 
 	if poolTask == nil {
-		poolTask = newTaskPool()
+		poolTask = newTaskPool("task", []TaskLane{TaskLaneInteractive, TaskLanePeriodic}, loadTaskPoolsConfig().Task)
 	}
 
 	return poolTask
 }
 
-func newTaskPool() *taskPool {
-	pool := &taskPool {
-		taskQueue: make(chan TaskFunction, maxPendingTasks),
+func newTaskPool(name string, lanes []TaskLane, config TaskPoolConfig) *taskPool {
+	pool := &taskPool{
+		name:       name,
+		lanes:      lanes,
+		maxRunning: config.MaxRunningTasks,
+		maxPending: map[TaskLane]int{},
+		pending:    map[TaskLane][]TaskFunction{},
+		rejected:   map[TaskLane]uint64{},
+	}
+	if pool.maxRunning <= 0 {
+		pool.maxRunning = defaultMaxRunningTasks
 	}
+	for _, lane := range lanes {
+		maxPending, ok := config.MaxPendingTasks[lane.String()]
+		if !ok || maxPending <= 0 {
+			maxPending = defaultMaxPendingTasks
+		}
+		pool.maxPending[lane] = maxPending
+	}
+	pool.cond = sync.NewCond(&pool.mutex)
 	pool.start()
 	return pool
 }
 
 func (p *taskPool) start() {
-	for i := 0; i < maxRunningTasks; i++ {
+	for i := 0; i < p.maxRunning; i++ {
 		go func() {
 			p.slave()
 		}()
@@ -42,30 +160,109 @@ func (p *taskPool) start() {
 }
 
 func (p *taskPool) slave() {
-	for task := range p.taskQueue {
+	for {
+		task := p.take()
 		task()
+
+		p.mutex.Lock()
+		p.running--
+		p.mutex.Unlock()
+	}
+}
+
+// take blocks until any task is pending, and returns the earliest one in lane
+// of the highest priority
+func (p *taskPool) take() TaskFunction {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for {
+		for _, lane := range p.lanes {
+			if queue := p.pending[lane]; len(queue) > 0 {
+				p.pending[lane] = queue[1:]
+				p.running++
+				return queue[0]
+			}
+		}
+		p.cond.Wait()
+	}
+}
+
+// RunTask queues task in specified lane without blocking caller, and returns
+// ErrTaskQueueFull when the queue of lane is full
+func (p *taskPool) RunTask(lane TaskLane, task TaskFunction) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	maxPending, ok := p.maxPending[lane]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTaskLane, lane.String())
+	}
+	if len(p.pending[lane]) >= maxPending {
+		p.rejected[lane]++
+		return fmt.Errorf("%w: %d tasks pending in %s lane of %s pool", ErrTaskQueueFull, len(p.pending[lane]), lane.String(), p.name)
 	}
+	p.pending[lane] = append(p.pending[lane], task)
+	p.cond.Signal()
+	return nil
 }
 
-func (pool *taskPool) RunTask(task TaskFunction) {
-	pool.taskQueue <- task
+func (p *taskPool) Stats() TaskPoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := TaskPoolStats{
+		Name:       p.name,
+		Running:    p.running,
+		MaxRunning: p.maxRunning,
+		Lanes:      make([]TaskLaneStats, 0, len(p.lanes)),
+	}
+	for _, lane := range p.lanes {
+		stats.Lanes = append(stats.Lanes, TaskLaneStats{
+			Lane:       lane.String(),
+			Pending:    len(p.pending[lane]),
+			MaxPending: p.maxPending[lane],
+			Rejected:   p.rejected[lane],
+		})
+	}
+	return stats
 }
 
 // Another global task pool for pre-checking tasks with limited concurrency
 var (
-	_precheckPool *taskPool
+	_precheckPool     *taskPool
 	_precheckPoolLock sync.Mutex
 )
 
 func GetPrecheckPool() *taskPool {
-	if _precheckPool == nil {
-		_precheckPoolLock.Lock()
-		defer _precheckPoolLock.Unlock()
+	_precheckPoolLock.Lock()
+	defer _precheckPoolLock.Unlock()
 
-		if _precheckPool == nil {
-			_precheckPool = newTaskPool()
-		}
+	if _precheckPool == nil {
+		_precheckPool = newTaskPool("precheck", []TaskLane{TaskLanePrecheck}, loadTaskPoolsConfig().Precheck)
 	}
 
 	return _precheckPool
 }
+
+// GetTaskPoolStats returns snapshots of all task pools
+func GetTaskPoolStats() []TaskPoolStats {
+	return []TaskPoolStats{
+		GetPool().Stats(),
+		GetPrecheckPool().Stats(),
+	}
+}
+
+// ReportTaskPoolStats logs snapshots of all task pools and reports them as
+// metrics event for monitoring
+func ReportTaskPoolStats() {
+	stats := GetTaskPoolStats()
+	statsJSON, err := json.Marshal(stats)
+	if err != nil {
+		log.GetLogger().WithError(err).Errorln("Failed to encode task pool stats")
+		return
+	}
+	log.GetLogger().Infof("Task pool stats: %s", string(statsJSON))
+	metrics.GetTaskPoolEvent(
+		"stats", string(statsJSON),
+	).ReportEvent()
+}
@@ -1,11 +1,61 @@
 package taskengine
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+)
 
 func TestAddTask(t *testing.T) {
- // pool := GetPool()
+	pool := newTaskPool("test", []TaskLane{TaskLaneInteractive}, TaskPoolConfig{})
+	done := make(chan struct{})
+	assert.NoError(t, pool.RunTask(TaskLaneInteractive, func() {
+		close(done)
+	}))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Task is not run by pool")
+	}
 
- // pool.RunTask()
+	err := pool.RunTask(TaskLanePrecheck, func() {})
+	assert.True(t, errors.Is(err, ErrUnknownTaskLane))
+}
 
-}
\ No newline at end of file
+func TestTaskPoolPriorityAndRejection(t *testing.T) {
+	pool := newTaskPool("test", []TaskLane{TaskLaneInteractive, TaskLanePeriodic}, TaskPoolConfig{
+		MaxRunningTasks: 1,
+		MaxPendingTasks: map[string]int{
+			"periodic": 1,
+		},
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	assert.NoError(t, pool.RunTask(TaskLanePeriodic, func() {
+		close(started)
+		<-release
+	}))
+	<-started
+
+	order := make(chan string, 3)
+	assert.NoError(t, pool.RunTask(TaskLanePeriodic, func() { order <- "periodic" }))
+	err := pool.RunTask(TaskLanePeriodic, func() { order <- "rejected" })
+	assert.True(t, errors.Is(err, ErrTaskQueueFull))
+	assert.NoError(t, pool.RunTask(TaskLaneInteractive, func() { order <- "interactive" }))
+
+	stats := pool.Stats()
+	assert.Equal(t, "test", stats.Name)
+	assert.Equal(t, 1, stats.Running)
+	assert.Equal(t, 1, stats.MaxRunning)
+	assert.Equal(t, []TaskLaneStats{
+		{Lane: "interactive", Pending: 1, MaxPending: defaultMaxPendingTasks},
+		{Lane: "periodic", Pending: 1, MaxPending: 1, Rejected: 1},
+	}, stats.Lanes)
+
+	close(release)
+	assert.Equal(t, "interactive", <-order)
+	assert.Equal(t, "periodic", <-order)
+}
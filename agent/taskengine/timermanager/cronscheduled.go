@@ -15,6 +15,8 @@ import (
 type CronScheduled struct {
 	expression *cronexpr.Expression
 	location *time.Location
+	// Every scheduled time of expression is shifted by the offset
+	splayOffset time.Duration
 
 	isNoNextRun bool
 }
@@ -164,13 +166,19 @@ func (c *CronScheduled) NoNextRun() bool {
 	return c.isNoNextRun
 }
 
+func (c *CronScheduled) setSplayOffset(offset time.Duration) {
+	c.splayOffset = offset
+}
+
 func (c *CronScheduled) NextRunFrom(t time.Time) (time.Duration, error) {
-	nextRunTime := c.expression.Next(t)
+	// Find the next time of expression after t without offset, thus the
+	// shifted one is always after t
+	nextRunTime := c.expression.Next(t.Add(-c.splayOffset))
 	if nextRunTime.IsZero() {
 		return time.Duration(-1), ErrNoNextRun
 	}
 
-	return nextRunTime.Sub(t), nil
+	return nextRunTime.Add(c.splayOffset).Sub(t), nil
 }
 
 func (c *CronScheduled) nextRun() (time.Duration, error) {
@@ -185,3 +193,23 @@ func (c *CronScheduled) nextRun() (time.Duration, error) {
 	}
 	return timeToWait, err
 }
+
+// ScheduledTimesBetween returns at most limit scheduled times in (from, to]
+// in ascending order, which is used to find runs missed during downtime
+func (c *CronScheduled) ScheduledTimesBetween(from time.Time, to time.Time, limit int) []time.Time {
+	if c.location != nil {
+		from = from.In(c.location)
+	}
+
+	var scheduledTimes []time.Time
+	from = from.Add(-c.splayOffset)
+	for len(scheduledTimes) < limit {
+		nextRunTime := c.expression.Next(from)
+		if nextRunTime.IsZero() || nextRunTime.Add(c.splayOffset).After(to) {
+			break
+		}
+		scheduledTimes = append(scheduledTimes, nextRunTime.Add(c.splayOffset))
+		from = nextRunTime
+	}
+	return scheduledTimes
+}
@@ -5,27 +5,37 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/aliyun/aliyun_assist_client/thirdparty/cronexpr"
 )
 
+// parseCronExpression builds expected schedule from the same canonicalized
+// expression as NewCronScheduled does
+func parseCronExpression(t *testing.T, cronat string) *cronexpr.Expression {
+	canonicalizedCronat, _, err := _splitExpressionAndLocation(cronat)
+	assert.NoError(t, err)
+	expression, err := cronexpr.Parse(canonicalizedCronat)
+	assert.NoError(t, err, "cronexpr.Parse should not raise error")
+	return expression
+}
+
 func TestNewCronScheduled(t *testing.T) {
 	const CronExpression = "*/20 * * * * ?"
 
 	scheduled, err := NewCronScheduled(CronExpression)
 	assert.NoError(t, err, "NewCronScheduled should correctly parse specified cron expression")
 
-	expectedSchedule, err := _cronExpressionParser.Parse(CronExpression)
-	assert.NoError(t, err, "_cronExpressionParser.Parse should not raise error")
+	expectedSchedule := parseCronExpression(t, CronExpression)
 
 	testTime := time.Now()
 	assert.Exactly(t, expectedSchedule.Next(testTime),
-		scheduled.schedule.Next(testTime),
+		scheduled.expression.Next(testTime),
 		"CronScheduled should generate same time of next schedule for same cron expression")
 }
 
 func TestNextRunFrom(t *testing.T) {
 	const CronExpression = "*/20 * * * * ?"
-	expectedSchedule, err := _cronExpressionParser.Parse(CronExpression)
-	assert.NoError(t, err, "_cronExpressionParser.Parse should not raise error")
+	expectedSchedule := parseCronExpression(t, CronExpression)
 
 	scheduled, _ := NewCronScheduled(CronExpression)
 	testTime := time.Now()
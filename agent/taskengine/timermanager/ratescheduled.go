@@ -73,6 +73,12 @@ func NewRateScheduled(cronat string, startTime time.Time) (*RateScheduled, error
 	}, nil
 }
 
+// setSplayOffset shifts start time of rate scheduler, which shifts every
+// scheduled time by the offset as well
+func (r *RateScheduled) setSplayOffset(offset time.Duration) {
+	r.startTime = r.startTime.Add(offset)
+}
+
 func (r *RateScheduled) NextRunFrom(t time.Time) (time.Duration, error) {
 	nextRunTime, err := r.scheduleNextRunTimeFrom(t)
 	if err != nil {
@@ -101,3 +107,18 @@ func (r *RateScheduled) scheduleNextRunTimeFrom(t time.Time) (time.Time, error)
 	nextRunTime := r.startTime.Add(time.Duration(passedPeriods + 1) * r.period)
 	return nextRunTime, nil
 }
+
+// ScheduledTimesBetween returns at most limit scheduled times in (from, to]
+// in ascending order, which is used to find runs missed during downtime
+func (r *RateScheduled) ScheduledTimesBetween(from time.Time, to time.Time, limit int) []time.Time {
+	var scheduledTimes []time.Time
+	for len(scheduledTimes) < limit {
+		nextRunTime, err := r.scheduleNextRunTimeFrom(from)
+		if err != nil || nextRunTime.After(to) {
+			break
+		}
+		scheduledTimes = append(scheduledTimes, nextRunTime)
+		from = nextRunTime
+	}
+	return scheduledTimes
+}
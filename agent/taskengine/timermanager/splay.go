@@ -0,0 +1,27 @@
+package timermanager
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// Splay shifts every scheduled time of timer by a stable offset within window,
+// thus timers of the same expression on a fleet of instances would not fire at
+// the same moment. The offset is derived from seed, e.g., instance ID, which is
+// deterministic across restarts but uniformly distributed across instances.
+// Zero value means no offset.
+type Splay struct {
+	Window time.Duration
+	Seed   string
+}
+
+// Offset returns the offset within [0, Window) in precision of milliseconds
+func (s Splay) Offset() time.Duration {
+	windowMs := uint64(s.Window / time.Millisecond)
+	if windowMs == 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(s.Seed))
+	return time.Duration(hash.Sum64()%windowMs) * time.Millisecond
+}
@@ -0,0 +1,57 @@
+package timermanager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplayOffset(t *testing.T) {
+	assert.Equal(t, time.Duration(0), Splay{}.Offset())
+	assert.Equal(t, time.Duration(0), Splay{Seed: "i-test"}.Offset())
+
+	splay := Splay{Window: 10 * time.Minute, Seed: "i-test"}
+	offset := splay.Offset()
+	assert.True(t, offset >= 0 && offset < splay.Window)
+	// Offset is deterministic for the same seed
+	assert.Equal(t, offset, splay.Offset())
+
+	// Offsets of instances are spread across the window
+	buckets := make(map[time.Duration]int)
+	for i := 0; i < 1000; i++ {
+		offset := Splay{Window: 10 * time.Minute, Seed: fmt.Sprintf("i-%d", i)}.Offset()
+		buckets[offset/time.Minute]++
+	}
+	assert.Len(t, buckets, 10)
+	for _, count := range buckets {
+		assert.True(t, count > 50)
+	}
+}
+
+func TestSplayedSchedules(t *testing.T) {
+	offset := 90 * time.Second
+	now := time.Date(2021, 3, 1, 1, 59, 0, 0, time.UTC)
+
+	cronScheduled, err := NewCronScheduled("0 0 2 * * ? * UTC")
+	assert.NoError(t, err)
+	cronScheduled.setSplayOffset(offset)
+	timeToWait, err := cronScheduled.NextRunFrom(now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute+offset, timeToWait)
+	// Run is still ahead when its unshifted time has passed
+	timeToWait, err = cronScheduled.NextRunFrom(now.Add(2 * time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, timeToWait)
+	assert.Equal(t, []time.Time{
+		time.Date(2021, 3, 1, 2, 1, 30, 0, time.UTC),
+	}, cronScheduled.ScheduledTimesBetween(now, now.Add(time.Hour), 10))
+
+	rateScheduled, err := NewRateScheduled("rate(1h)", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	rateScheduled.setSplayOffset(offset)
+	timeToWait, err = rateScheduled.NextRunFrom(now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute+offset, timeToWait)
+}
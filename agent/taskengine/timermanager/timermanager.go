@@ -57,11 +57,14 @@ func (m *TimerManager) Stop() {
 	}
 }
 
-func (m *TimerManager) CreateCronTimer(callback TimerCallback, cronat string) (*Timer, error) {
+// CreateCronTimer returns new registered timer for cron expression, whose
+// scheduled times are shifted by offset of splay
+func (m *TimerManager) CreateCronTimer(callback TimerCallback, cronat string, splay Splay) (*Timer, error) {
 	s, err := NewCronScheduled(cronat)
 	if err != nil {
 		return nil, err
 	}
+	s.setSplayOffset(splay.Offset())
 	t := NewTimer(s, callback)
 
 	m.lock.Lock()
@@ -70,11 +73,14 @@ func (m *TimerManager) CreateCronTimer(callback TimerCallback, cronat string) (*
 	return t, nil
 }
 
-func (m *TimerManager) CreateRateTimer(callback TimerCallback, cronat string, creationTime time.Time) (*Timer, error) {
+// CreateRateTimer returns new registered timer for rate expression, whose
+// scheduled times are shifted by offset of splay
+func (m *TimerManager) CreateRateTimer(callback TimerCallback, cronat string, creationTime time.Time, splay Splay) (*Timer, error) {
 	s, err := NewRateScheduled(cronat, creationTime)
 	if err != nil {
 		return nil, err
 	}
+	s.setSplayOffset(splay.Offset())
 	t := NewTimer(s, callback)
 
 	m.lock.Lock()
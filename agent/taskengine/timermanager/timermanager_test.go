@@ -61,7 +61,7 @@ func TestCreateCronTimer(t *testing.T) {
 	assert.Equal(t, 0, len(timerManager.timers),
 		"TimerManager instance should contain 0 timer initially")
 
-	timer, err := timerManager.CreateCronTimer(func (){}, CronExpression)
+	timer, err := timerManager.CreateCronTimer(func (){}, CronExpression, Splay{})
 	assert.NoErrorf(t, err,
 		"CreateCronTimer should not return error for cron expression %s", CronExpression)
 	if _, ok := timer.Schedule.(*CronScheduled); !ok {
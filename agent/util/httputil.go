@@ -161,6 +161,12 @@ func HttpGetWithTimeout(url string, timeout time.Duration, noLog bool) (error, s
 }
 
 func addHttpHeads(req *HttpRequest.Request) {
+	req.SetHeaders(hybridHttpHeads())
+}
+
+// hybridHttpHeads returns headers identifying and authenticating hybrid
+// instance for a single request
+func hybridHttpHeads() map[string]string {
 	u4 := uuid.New()
 	str_request_id := u4.String()
 
@@ -185,25 +191,17 @@ func addHttpHeads(req *HttpRequest.Request) {
 	output := RsaSign(input, string(pri_key))
 	log.GetLogger().Infoln(input, output)
 
+	headers := map[string]string{
+		"x-acs-instance-id": instance_id,
+		"x-acs-timestamp":   str_timestamp,
+		"x-acs-request-id":  str_request_id,
+		"x-acs-signature":   output,
+	}
 	internal_ip, err := osutil.ExternalIP()
 	if err == nil {
-		req.SetHeaders(map[string]string{
-			"X-Client-IP": internal_ip.String(),
-		})
+		headers["X-Client-IP"] = internal_ip.String()
 	}
-
-	req.SetHeaders(map[string]string{
-		"x-acs-instance-id": instance_id,
-	})
-	req.SetHeaders(map[string]string{
-		"x-acs-timestamp": str_timestamp, //这也是HttpRequest包的默认设置
-	})
-	req.SetHeaders(map[string]string{
-		"x-acs-request-id": str_request_id, //这也是HttpRequest包的默认设置
-	})
-	req.SetHeaders(map[string]string{
-		"x-acs-signature": output, //这也是HttpRequest包的默认设置
-	})
+	return headers
 }
 
 func HttpPost(url string, data string, contentType string) (string, error) {
@@ -264,6 +262,63 @@ func HttpPostWithTimeout(url string, data string, contentType string, timeout ti
 
 }
 
+// HttpPostFileWithTimeout sends content of file at filePath to url via HTTP
+// POST as plain text with specified timeout. The file is streamed as request
+// body instead of being read into memory, and only its size at the time of
+// call is sent. Response status above 400 is returned as *HttpErrorCode, the
+// same as HttpPostWithTimeout.
+func HttpPostFileWithTimeout(url string, filePath string, timeout time.Duration) (string, error) {
+	client := http.Client{
+		// NOTE: `transport` variable would be nil when init function fails, and
+		// DefaultTransport will be used instead, thus it's safe to directly
+		// reference `transport` variable.
+		Transport: GetHTTPTransport(),
+		Timeout:   timeout,
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, io.LimitReader(f, fileInfo.Size()))
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = fileInfo.Size()
+	req.Header.Set(UserAgentHeader, UserAgentValue)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	//excude Hybrid instance id
+	if IsHybrid() {
+		for key, value := range hybridHttpHeads() {
+			req.Header.Set(key, value)
+		}
+	} else {
+		req.Header.Set("X-Client-Instance-ID", GetInstanceId())
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		log.GetLogger().Infoln(url, filePath, err)
+		return "", err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	content := string(body)
+	if res.StatusCode > 400 {
+		err = &HttpErrorCode{
+			errorCode: res.StatusCode,
+		}
+	}
+
+	log.GetLogger().Infoln(url, content, filePath, err)
+	return content, err
+}
+
 func HttpDownlod(url string, FilePath string) error {
 	client := http.Client{
 		// NOTE: `transport` variable would be nil when init function fails, and
@@ -310,6 +365,52 @@ func HttpDownloadWithTimeout(url string, filePath string, timeout time.Duration)
 	return err
 }
 
+// HttpPutFileWithTimeout uploads content of file at filePath to url via HTTP
+// PUT with specified timeout. Response status other than 2xx is returned as
+// *HttpErrorCode.
+func HttpPutFileWithTimeout(url string, filePath string, headers map[string]string, timeout time.Duration) error {
+	client := http.Client{
+		// NOTE: `transport` variable would be nil when init function fails, and
+		// DefaultTransport will be used instead, thus it's safe to directly
+		// reference `transport` variable.
+		Transport: GetHTTPTransport(),
+		Timeout:   timeout,
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, url, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fileInfo.Size()
+	req.Header.Set(UserAgentHeader, UserAgentValue)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &HttpErrorCode{
+			errorCode: res.StatusCode,
+		}
+	}
+	return nil
+}
+
 func CallApi(httpMethod, url string, parameters map[string]interface{}, respObj interface{}, apiTimeout time.Duration, noLog bool) error {
 	var response string
 	var err error
@@ -0,0 +1,179 @@
+package langutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var (
+	ErrUnknownCharset = errors.New("Unknown charset")
+
+	// Charset names used by glibc locales but not known by WHATWG encoding
+	// standard
+	charsetAliases = map[string]string{
+		"utf8":      "utf-8",
+		"eucjp":     "euc-jp",
+		"euckr":     "euc-kr",
+		"big5hkscs": "big5",
+		"sjis":      "shift_jis",
+		"cp936":     "gbk",
+		"cp950":     "big5",
+		"cp932":     "shift_jis",
+	}
+)
+
+// LookupCharset returns encoding of charset name, which could be either label
+// in WHATWG encoding standard or charset part of glibc locale like GB18030,
+// eucJP or ISO8859-1
+func LookupCharset(name string) (encoding.Encoding, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := charsetAliases[normalized]; ok {
+		normalized = alias
+	} else if strings.HasPrefix(normalized, "iso8859") {
+		normalized = "iso-8859-" + strings.TrimLeft(strings.TrimPrefix(normalized, "iso8859"), "-_")
+	}
+	enc, err := htmlindex.Get(normalized)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCharset, name)
+	}
+	return enc, nil
+}
+
+// CharsetFromLocale extracts charset from locale name like zh_CN.GB18030 or
+// ja_JP.eucJP@euro, and returns empty string for locale without charset
+func CharsetFromLocale(locale string) string {
+	if i := strings.IndexByte(locale, '@'); i >= 0 {
+		locale = locale[:i]
+	}
+	i := strings.IndexByte(locale, '.')
+	if i < 0 {
+		return ""
+	}
+	return locale[i+1:]
+}
+
+// CharsetFromEnv returns charset of effective locale in environment variables,
+// in which LC_ALL overrides LC_CTYPE and LC_CTYPE overrides LANG. Later
+// entries of the same variable win as exec does.
+func CharsetFromEnv(env []string) string {
+	values := make(map[string]string, 3)
+	for _, entry := range env {
+		if i := strings.IndexByte(entry, '='); i > 0 {
+			switch name := entry[:i]; name {
+			case "LC_ALL", "LC_CTYPE", "LANG":
+				values[name] = entry[i+1:]
+			}
+		}
+	}
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if values[name] != "" {
+			return CharsetFromLocale(values[name])
+		}
+	}
+	return ""
+}
+
+// IsUTF8 reports whether encoding is UTF-8, in which no conversion is needed
+// except replacing invalid sequences
+func IsUTF8(enc encoding.Encoding) bool {
+	return enc == unicode.UTF8 || enc == encoding.Nop
+}
+
+// DecodingWriter converts data in specified charset to UTF-8 before writing
+// it to underlying writer. Invalid sequences are replaced with U+FFFD, and
+// incomplete character at the end of written data is held until following
+// write or Flush. Write and Flush are safe to be called concurrently.
+type DecodingWriter struct {
+	decoder transform.Transformer
+	writer  io.Writer
+	held    []byte
+	mutex   sync.Mutex
+}
+
+func NewDecodingWriter(w io.Writer, enc encoding.Encoding) *DecodingWriter {
+	var decoder transform.Transformer = enc.NewDecoder()
+	if IsUTF8(enc) {
+		// encoding.Nop passes invalid sequences through
+		decoder = unicode.UTF8.NewDecoder()
+	}
+	return &DecodingWriter{
+		decoder: decoder,
+		writer:  w,
+	}
+}
+
+// Write always reports len(p) bytes written as long as underlying writer
+// succeeds, since the length of converted data differs from the original one
+func (w *DecodingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	data := append(w.held, p...)
+	converted, consumed := w.decode(data, false)
+	w.held = append([]byte(nil), data[consumed:]...)
+	if len(converted) > 0 {
+		if _, err := w.writer.Write(converted); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes held data to underlying writer, with incomplete character
+// replaced
+func (w *DecodingWriter) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.held) == 0 {
+		return nil
+	}
+	converted, _ := w.decode(w.held, true)
+	w.held = nil
+	w.decoder.Reset()
+	_, err := w.writer.Write(converted)
+	return err
+}
+
+func (w *DecodingWriter) decode(src []byte, atEOF bool) ([]byte, int) {
+	// Every byte is decoded into at most one replacement character in
+	// supported charsets
+	dst := make([]byte, len(src)*3+utf8.UTFMax)
+	converted := make([]byte, 0, len(src))
+	consumed := 0
+	for consumed < len(src) {
+		nDst, nSrc, err := w.decoder.Transform(dst, src[consumed:], atEOF)
+		converted = append(converted, dst[:nDst]...)
+		consumed += nSrc
+		switch err {
+		case nil:
+		case transform.ErrShortSrc:
+			return converted, consumed
+		case transform.ErrShortDst:
+			if nDst == 0 && nSrc == 0 {
+				dst = make([]byte, len(dst)*2)
+			}
+		default:
+			// Skip the byte decoder fails on
+			converted = append(converted, string(utf8.RuneError)...)
+			consumed++
+		}
+	}
+	return converted, consumed
+}
+
+// EncodeFromUTF8 converts UTF-8 text into specified charset, in which
+// characters not representable are replaced
+func EncodeFromUTF8(data []byte, enc encoding.Encoding) ([]byte, error) {
+	if IsUTF8(enc) {
+		return data, nil
+	}
+	return encoding.ReplaceUnsupported(enc.NewEncoder()).Bytes(data)
+}
@@ -0,0 +1,134 @@
+package langutil
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func TestLookupCharset(t *testing.T) {
+	for name, expected := range map[string]string{
+		"UTF-8":     "UTF-8",
+		"utf8":      "UTF-8",
+		"GB18030":   "GB18030",
+		"gbk":       "GBK",
+		"GB2312":    "GBK",
+		"BIG5":      "Big5",
+		"big5hkscs": "Big5",
+		"eucJP":     "EUC-JP",
+		"SJIS":      "Shift JIS",
+		"euckr":     "EUC-KR",
+	} {
+		enc, err := LookupCharset(name)
+		if assert.NoError(t, err, name) {
+			assert.Contains(t, enc.(interface{ String() string }).String(), expected, name)
+		}
+	}
+	enc, err := LookupCharset("ISO8859-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, enc)
+
+	_, err = LookupCharset("no-such-charset")
+	assert.ErrorIs(t, err, ErrUnknownCharset)
+}
+
+func TestCharsetFromLocale(t *testing.T) {
+	assert.Equal(t, "GB18030", CharsetFromLocale("zh_CN.GB18030"))
+	assert.Equal(t, "eucJP", CharsetFromLocale("ja_JP.eucJP@euro"))
+	assert.Equal(t, "", CharsetFromLocale("C"))
+	assert.Equal(t, "", CharsetFromLocale("de_DE@euro"))
+}
+
+func TestCharsetFromEnv(t *testing.T) {
+	assert.Equal(t, "", CharsetFromEnv([]string{"PATH=/bin"}))
+	assert.Equal(t, "UTF-8", CharsetFromEnv([]string{"LANG=en_US.UTF-8"}))
+	assert.Equal(t, "BIG5", CharsetFromEnv([]string{"LANG=en_US.UTF-8", "LC_CTYPE=zh_TW.BIG5"}))
+	assert.Equal(t, "GB18030", CharsetFromEnv([]string{"LC_ALL=zh_CN.GB18030", "LC_CTYPE=zh_TW.BIG5"}))
+	assert.Equal(t, "GBK", CharsetFromEnv([]string{"LANG=zh_CN.UTF-8", "LANG=zh_CN.GBK"}))
+	assert.Equal(t, "UTF-8", CharsetFromEnv([]string{"LC_ALL=", "LANG=zh_CN.UTF-8"}))
+}
+
+func TestDecodingWriter(t *testing.T) {
+	text := "中文输出：測試"
+	encoded, err := simplifiedchinese.GB18030.NewEncoder().Bytes([]byte(text))
+	assert.NoError(t, err)
+
+	// Characters split across writes are decoded correctly
+	var buffer bytes.Buffer
+	writer := NewDecodingWriter(&buffer, simplifiedchinese.GB18030)
+	for i := range encoded {
+		n, err := writer.Write(encoded[i : i+1])
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+	assert.NoError(t, writer.Flush())
+	assert.Equal(t, text, buffer.String())
+
+	// Incomplete character at the end is replaced on flush
+	buffer.Reset()
+	big5Encoded, err := traditionalchinese.Big5.NewEncoder().Bytes([]byte("測試"))
+	assert.NoError(t, err)
+	writer = NewDecodingWriter(&buffer, traditionalchinese.Big5)
+	writer.Write(big5Encoded[:3])
+	assert.Equal(t, "測", buffer.String())
+	assert.NoError(t, writer.Flush())
+	assert.Equal(t, "測�", buffer.String())
+
+	// Invalid sequences in UTF-8 are replaced
+	buffer.Reset()
+	utf8Encoding, _ := LookupCharset("utf-8")
+	writer = NewDecodingWriter(&buffer, utf8Encoding)
+	writer.Write([]byte("ok\xff\xfe"))
+	writer.Write([]byte("\xe4\xb8"))
+	writer.Write([]byte("\xad"))
+	assert.NoError(t, writer.Flush())
+	assert.Equal(t, "ok��中", buffer.String())
+}
+
+func TestDecodingWriterConcurrentFlush(t *testing.T) {
+	encoded, err := simplifiedchinese.GB18030.NewEncoder().Bytes([]byte("中文\n"))
+	assert.NoError(t, err)
+	var buffer bytes.Buffer
+	writer := NewDecodingWriter(&buffer, simplifiedchinese.GB18030)
+
+	// Output may still be copied when Flush is called after process exited
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			writer.Write(encoded)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, writer.Flush())
+	}
+	wg.Wait()
+	assert.NoError(t, writer.Flush())
+	assert.Equal(t, 1000, strings.Count(buffer.String(), "中文\n"))
+}
+
+func TestEncodeFromUTF8(t *testing.T) {
+	encoded, err := EncodeFromUTF8([]byte("日本語テキスト"), japanese.ShiftJIS)
+	assert.NoError(t, err)
+	decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "日本語テキスト", string(decoded))
+
+	// Characters not representable are replaced rather than failing
+	encoded, err = EncodeFromUTF8([]byte("a\U0001F600b"), japanese.ShiftJIS)
+	assert.NoError(t, err)
+	assert.Equal(t, byte('a'), encoded[0])
+	assert.Equal(t, byte('b'), encoded[len(encoded)-1])
+
+	utf8Encoding, _ := LookupCharset("utf-8")
+	encoded, err = EncodeFromUTF8([]byte("不变"), utf8Encoding)
+	assert.NoError(t, err)
+	assert.Equal(t, "不变", string(encoded))
+}
@@ -0,0 +1,98 @@
+// +build linux freebsd
+
+package langutil
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxLocaleFileSize limits content read from locale configuration file
+const maxLocaleFileSize = 64 * 1024
+
+// systemLocaleFiles configure default locale of system on various
+// distributions
+var systemLocaleFiles = []string{
+	"/etc/locale.conf",
+	"/etc/default/locale",
+	"/etc/sysconfig/i18n",
+}
+
+// userLocaleFiles configure locale of user login session, relative to home
+// directory of the user
+var userLocaleFiles = []string{
+	".pam_environment",
+	".config/locale.conf",
+	".i18n",
+}
+
+// UserCharset returns charset of locale configured for login session of the
+// user with specified home directory, or empty string if not configured
+func UserCharset(homeDir string) string {
+	if homeDir == "" {
+		return ""
+	}
+	for _, name := range userLocaleFiles {
+		if charset := charsetFromLocaleFile(filepath.Join(homeDir, name), true); charset != "" {
+			return charset
+		}
+	}
+	return ""
+}
+
+// SystemCharset returns charset of system default locale, or empty string if
+// not configured
+func SystemCharset() string {
+	for _, path := range systemLocaleFiles {
+		if charset := charsetFromLocaleFile(path, false); charset != "" {
+			return charset
+		}
+	}
+	return ""
+}
+
+// charsetFromLocaleFile reads shell-like assignments of LC_ALL, LC_CTYPE and
+// LANG in locale configuration file, as well as pam_env style entries like
+// "LANG DEFAULT=zh_CN.GB18030". Symbolic link is not followed when noFollow
+// is set, e.g., for files under home directory controlled by the user, and
+// the file must be regular one so that reading it never blocks on FIFO.
+func charsetFromLocaleFile(path string, noFollow bool) string {
+	flag := os.O_RDONLY | syscall.O_NONBLOCK
+	if noFollow {
+		flag |= syscall.O_NOFOLLOW
+	}
+	file, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	if fileInfo, err := file.Stat(); err != nil || !fileInfo.Mode().IsRegular() {
+		return ""
+	}
+
+	var env []string
+	scanner := bufio.NewScanner(io.LimitReader(file, maxLocaleFileSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		if fields := strings.Fields(line); len(fields) == 2 {
+			for _, option := range []string{"DEFAULT=", "OVERRIDE="} {
+				if strings.HasPrefix(fields[1], option) {
+					line = fields[0] + "=" + strings.TrimPrefix(fields[1], option)
+					break
+				}
+			}
+		}
+		if i := strings.IndexByte(line, '='); i > 0 {
+			env = append(env, line[:i]+"="+strings.Trim(line[i+1:], `"'`))
+		}
+	}
+	return CharsetFromEnv(env)
+}
@@ -0,0 +1,76 @@
+// +build linux freebsd
+
+package langutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemCharset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locale")
+	assert.NoError(t, err)
+	originalSystemLocaleFiles := systemLocaleFiles
+	defer func() {
+		systemLocaleFiles = originalSystemLocaleFiles
+		os.RemoveAll(dir)
+	}()
+	localeConf := filepath.Join(dir, "locale.conf")
+	i18n := filepath.Join(dir, "i18n")
+	systemLocaleFiles = []string{localeConf, i18n}
+
+	assert.Equal(t, "", SystemCharset())
+
+	assert.NoError(t, ioutil.WriteFile(i18n, []byte("# comment\nexport LANG=\"zh_CN.GB18030\"\nSUPPORTED=\"zh_CN.GB18030:zh_CN:zh\"\n"), 0644))
+	assert.Equal(t, "GB18030", SystemCharset())
+
+	assert.NoError(t, ioutil.WriteFile(localeConf, []byte("LANG=en_US.UTF-8\nLC_CTYPE='ja_JP.eucJP'\n"), 0644))
+	assert.Equal(t, "eucJP", SystemCharset())
+}
+
+func TestUserCharset(t *testing.T) {
+	home, err := ioutil.TempDir("", "home")
+	assert.NoError(t, err)
+	defer os.RemoveAll(home)
+
+	assert.Equal(t, "", UserCharset(""))
+	assert.Equal(t, "", UserCharset(home))
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, ".config"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, ".config", "locale.conf"), []byte("LANG=zh_TW.Big5\n"), 0644))
+	assert.Equal(t, "Big5", UserCharset(home))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, ".pam_environment"), []byte("# comment\nLANG DEFAULT=zh_CN.GB18030\nLC_CTYPE\tOVERRIDE=ja_JP.eucJP\n"), 0644))
+	assert.Equal(t, "eucJP", UserCharset(home))
+}
+
+func TestUserCharsetIgnoresSpecialFiles(t *testing.T) {
+	home, err := ioutil.TempDir("", "home")
+	assert.NoError(t, err)
+	defer os.RemoveAll(home)
+
+	// Symbolic link under home directory is never followed
+	target := filepath.Join(home, "target")
+	assert.NoError(t, ioutil.WriteFile(target, []byte("LANG=zh_TW.Big5\n"), 0644))
+	assert.NoError(t, os.Symlink(target, filepath.Join(home, ".pam_environment")))
+	assert.Equal(t, "", UserCharset(home))
+
+	// Reading FIFO never blocks
+	assert.NoError(t, syscall.Mkfifo(filepath.Join(home, ".i18n"), 0644))
+	charset := make(chan string, 1)
+	go func() {
+		charset <- UserCharset(home)
+	}()
+	select {
+	case c := <-charset:
+		assert.Equal(t, "", c)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Reading locale file blocks on FIFO")
+	}
+}
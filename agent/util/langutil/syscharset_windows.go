@@ -0,0 +1,16 @@
+package langutil
+
+// SystemCharset returns GBK on Windows not in English, consistent with
+// conversion of task output
+func SystemCharset() string {
+	if GetDefaultLang() != 0x409 {
+		return "gbk"
+	}
+	return ""
+}
+
+// UserCharset returns empty string on Windows, where charset of output does not
+// depend on locale of user
+func UserCharset(homeDir string) string {
+	return ""
+}
@@ -0,0 +1,77 @@
+package process
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Interval of checking whether output has been idle for too long
+const idleCheckInterval = time.Second
+
+// activityRecorder records when output was written by the process last time
+type activityRecorder struct {
+	lastActive int64
+}
+
+type activityWriter struct {
+	recorder *activityRecorder
+	writer   io.Writer
+}
+
+func newActivityRecorder() *activityRecorder {
+	recorder := &activityRecorder{}
+	recorder.Touch()
+	return recorder
+}
+
+// Touch marks the process as active right now
+func (r *activityRecorder) Touch() {
+	atomic.StoreInt64(&r.lastActive, time.Now().UnixNano())
+}
+
+// IdleFor returns how long the process has written nothing
+func (r *activityRecorder) IdleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&r.lastActive)))
+}
+
+// Writer returns writer which touches the recorder on every non-empty write
+func (r *activityRecorder) Writer(w io.Writer) io.Writer {
+	return &activityWriter{
+		recorder: r,
+		writer:   w,
+	}
+}
+
+func (w *activityWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.recorder.Touch()
+	}
+	return w.writer.Write(p)
+}
+
+// watchIdle returns channel notified once the process has written nothing for
+// idle timeout, and nil channel which blocks forever for nil recorder
+func (r *activityRecorder) watchIdle(idleTimeout time.Duration, exited <-chan struct{}) <-chan struct{} {
+	if r == nil {
+		return nil
+	}
+	r.Touch()
+	idleChan := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if r.IdleFor() >= idleTimeout {
+					idleChan <- struct{}{}
+					return
+				}
+			case <-exited:
+				return
+			}
+		}
+	}()
+	return idleChan
+}
@@ -0,0 +1,46 @@
+// +build linux freebsd
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// holdBeforeExec makes the command wait in a shell wrapper until the returned
+// release function is called, thus the started process could be set up by
+// agent before anything in the command is executed. The wrapper keeps the pid
+// and process group, and is replaced by the command via exec.
+func holdBeforeExec(command *exec.Cmd) (func(), error) {
+	// Path is left as the bare name by exec.Command when not found, and the
+	// same error as starting the command directly is returned
+	if !strings.ContainsRune(command.Path, os.PathSeparator) {
+		if _, err := exec.LookPath(command.Path); err != nil {
+			return nil, err
+		}
+	}
+	shellPath, err := exec.LookPath("sh")
+	if err != nil {
+		return nil, err
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// The wrapper blocks on reading the pipe, and closes it before executing
+	// the command
+	fd := 3 + len(command.ExtraFiles)
+	script := fmt.Sprintf(`read _ <&%d; exec %d<&-; exec "$0" "$@"`, fd, fd)
+	command.Args = append([]string{"sh", "-c", script, command.Path}, command.Args[1:]...)
+	command.Path = shellPath
+	command.ExtraFiles = append(command.ExtraFiles, reader)
+
+	return func() {
+		reader.Close()
+		writer.Write([]byte("\n"))
+		writer.Close()
+	}, nil
+}
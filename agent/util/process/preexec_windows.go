@@ -0,0 +1,11 @@
+package process
+
+import (
+	"os/exec"
+)
+
+// holdBeforeExec is not supported on Windows, where the command has been
+// running when the process is set up by agent
+func holdBeforeExec(command *exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
@@ -20,9 +20,26 @@ const (
 	Success int = iota
 	Fail
 	Timeout
+	// Terminated since no output was produced during idle timeout
+	IdleTimeout
 	groupsIdentifier = "groups="
 )
 
+const (
+	// Phases in which the process tree is terminated
+	NotTerminated int = iota
+	TerminatedBySigterm
+	TerminatedBySigkill
+)
+
+var (
+	errGracefulTerminationNotSupported = errors.New("Graceful termination is not supported")
+
+	// ErrCanceledBeforeStart is returned by SyncRun when Cancel has been called
+	// before the process is started
+	ErrCanceledBeforeStart = errors.New("canceled before the process is started")
+)
+
 type WaitProcessResult struct {
 	processState *os.ProcessState
 	err error
@@ -34,6 +51,17 @@ type ProcessCmd struct {
     user_name string
     password string
 	homeDir string
+	env []string
+	preExecCallback preExecCallbackFunc
+	forceKillCallback forceKillCallbackFunc
+	gracePeriod time.Duration
+	exited chan struct{}
+	terminationPhase int
+	terminateLock sync.Mutex
+	// Cancellation is remembered, thus following SyncRun refuses to start
+	// another process
+	canceled bool
+	idleTimeout time.Duration
 }
 
 func NewProcessCmd() *ProcessCmd {
@@ -51,12 +79,91 @@ type cancellableAndSafeWriter struct {
 
 type readCallbackFunc func(stdoutWriter io.Reader, stderrWriter io.Reader)
 
+// preExecCallbackFunc would be invoked with pid of the process after it has
+// been started but before the command is executed, e.g. to place the process
+// into control group before it could fork
+type preExecCallbackFunc func(pid int)
+
+// forceKillCallbackFunc would be invoked when the process tree is being killed
+// forcibly, to kill processes escaped from the process group
+type forceKillCallbackFunc func()
+
+// Cancel terminates the running process tree if any, and prevents any process
+// from being started by following SyncRun
 func (p *ProcessCmd) Cancel() {
-	if p.command != nil {
-		p.command.Process.Kill()
+	p.terminateLock.Lock()
+	p.canceled = true
+	p.terminateLock.Unlock()
+	p.terminate()
+}
+
+// terminate ends the whole process tree. SIGTERM is sent to the process group
+// at first, and SIGKILL would be sent after grace period. Processes left in the
+// process group are always killed even if the process exited gracefully, or
+// had already exited before termination.
+func (p *ProcessCmd) terminate() {
+	p.terminateLock.Lock()
+	defer p.terminateLock.Unlock()
+
+	if p.command == nil || p.command.Process == nil || p.terminationPhase != NotTerminated {
+		return
+	}
+	// Termination phase is only recorded for the process itself, while its
+	// leftover descendants are still terminated after it has exited
+	alreadyExited := false
+	select {
+	case <-p.exited:
+		alreadyExited = true
+	default:
+	}
+	logger := log.GetLogger().WithFields(logrus.Fields{
+		"pid":           p.command.Process.Pid,
+		"gracePeriod":   p.gracePeriod,
+		"alreadyExited": alreadyExited,
+	})
+
+	if p.gracePeriod > 0 {
+		deadline := time.Now().Add(p.gracePeriod)
+		switch err := terminateProcessTree(p.command); {
+		case err == nil:
+			select {
+			case <-p.exited:
+				if !alreadyExited {
+					p.terminationPhase = TerminatedBySigterm
+					logger.Infoln("Process exited during grace period of termination")
+				}
+				// Leftover processes in the process group get the rest of
+				// grace period as well
+				waitProcessTreeExited(p.command, deadline)
+			case <-time.After(time.Until(deadline)):
+				logger.Infoln("Process did not exit during grace period of termination")
+			}
+		case errors.Is(err, errGracefulTerminationNotSupported):
+		default:
+			logger.WithError(err).Warningln("Failed to terminate process tree gracefully")
+		}
+	}
+
+	if err := killProcessTree(p.command); err != nil && p.terminationPhase == NotTerminated && !alreadyExited {
+		logger.WithError(err).Warningln("Failed to kill process tree")
+	}
+	if p.forceKillCallback != nil {
+		p.forceKillCallback()
+	}
+	if p.terminationPhase == NotTerminated && !alreadyExited {
+		p.terminationPhase = TerminatedBySigkill
+		logger.Infoln("Killed process tree")
 	}
 }
 
+// TerminationPhase returns in which phase the process tree has been terminated
+// due to timeout or cancellation during last run
+func (p *ProcessCmd) TerminationPhase() int {
+	p.terminateLock.Lock()
+	defer p.terminateLock.Unlock()
+	return p.terminationPhase
+}
+
 func (p *ProcessCmd) SetUserInfo(name string) {
 	p.user_name = name
 }
@@ -69,6 +176,32 @@ func (p *ProcessCmd) SetHomeDir(homeDir string) {
 	p.homeDir = homeDir
 }
 
+// SetEnv sets additional environment variables in "key=value" form, which are
+// appended to environment of agent for the process
+func (p *ProcessCmd) SetEnv(env []string) {
+	p.env = env
+}
+
+func (p *ProcessCmd) SetPreExecCallback(callback preExecCallbackFunc) {
+	p.preExecCallback = callback
+}
+
+func (p *ProcessCmd) SetForceKillCallback(callback forceKillCallbackFunc) {
+	p.forceKillCallback = callback
+}
+
+// SetTerminationGracePeriod sets how long to wait for the process to exit
+// after SIGTERM when terminated due to timeout or cancellation
+func (p *ProcessCmd) SetTerminationGracePeriod(gracePeriod time.Duration) {
+	p.gracePeriod = gracePeriod
+}
+
+// SetIdleTimeout sets how long the process could run without writing anything
+// to stdout or stderr before being terminated, and zero disables the check
+func (p *ProcessCmd) SetIdleTimeout(idleTimeout time.Duration) {
+	p.idleTimeout = idleTimeout
+}
+
 func (p *ProcessCmd)  SyncRunSimple(commandName string, commandArguments []string, timeOut int) error {
 	p.command = exec.Command(commandName, commandArguments...)
 	logger := log.GetLogger().WithFields(logrus.Fields{
@@ -119,6 +252,15 @@ func (p *ProcessCmd)  SyncRun(
 	exitCode = 0
 
 	p.command = exec.Command(commandName, commandArguments...)
+	if len(p.env) > 0 {
+		p.command.Env = append(os.Environ(), p.env...)
+	}
+	var activity *activityRecorder
+	if p.idleTimeout > 0 {
+		activity = newActivityRecorder()
+		stdoutWriter = activity.Writer(stdoutWriter)
+		stderrWriter = activity.Writer(stderrWriter)
+	}
 	p.command.Stdout = stdoutWriter
 	p.command.Stderr = stderrWriter
 	p.command.Stdin = stdinReader
@@ -133,15 +275,48 @@ func (p *ProcessCmd)  SyncRun(
 		}
 	}
 
-	if err = p.command.Start(); err != nil {
+	releaseExec := func() {}
+	if p.preExecCallback != nil {
+		if releaseExec, err = holdBeforeExec(p.command); err != nil {
+			if p.user_name != "" {
+				p.removeCredential()
+			}
+			return 1, Fail, err
+		}
+	}
+
+	// The process is started with terminateLock held, thus Cancel either
+	// prevents it from being started or terminates it after started
+	p.terminateLock.Lock()
+	if p.canceled {
+		p.terminateLock.Unlock()
+		releaseExec()
+		if p.user_name != "" {
+			p.removeCredential()
+		}
+		return 1, Fail, ErrCanceledBeforeStart
+	}
+	p.exited = make(chan struct{})
+	p.terminationPhase = NotTerminated
+	err = p.command.Start()
+	p.terminateLock.Unlock()
+	if err != nil {
+		releaseExec()
 		log.GetLogger().Errorln("error occurred starting the command", err)
 		exitCode = 1
 		return exitCode, Fail, err
 	}
+	if p.preExecCallback != nil {
+		p.preExecCallback(p.command.Process.Pid)
+	}
+	releaseExec()
 
 	finished := make(chan WaitProcessResult, 1)
+	exited := p.exited
+	idleChan := activity.watchIdle(p.idleTimeout, exited)
 	go func() {
 		processState, err := p.command.Process.Wait()
+		close(exited)
 		finished <- WaitProcessResult{
 			processState: processState,
 			err: err,
@@ -173,7 +348,13 @@ func (p *ProcessCmd)  SyncRun(
 		exitCode = 1
 		status = Timeout
 		err = errors.New("timeout")
-        p.command.Process.Kill()
+		p.terminate()
+	case <-idleChan:
+		log.GetLogger().Errorln("Idle timeout in run command.", commandName)
+		exitCode = 1
+		status = IdleTimeout
+		err = errors.New("idle timeout")
+		p.terminate()
 	}
 
 	if(p.user_name != "") {
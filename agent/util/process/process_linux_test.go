@@ -2,8 +2,14 @@ package process
 
 import (
 	"bytes"
-	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestPwdCommnad(t *testing.T) {
@@ -16,4 +22,164 @@ func TestPwdCommnad(t *testing.T) {
 		commandName, nil, &stdoutWrite, &stderrWrite,  nil, nil, 30)
 
 	assert.Contains(t,  stdoutWrite.String(), "/tmp")
-}
\ No newline at end of file
+}
+func TestTerminateProcessTree(t *testing.T) {
+	var stdoutWrite bytes.Buffer
+	var stderrWrite bytes.Buffer
+	processer := ProcessCmd{}
+	processer.SetTerminationGracePeriod(2 * time.Second)
+
+	// Background sleep holds stdout open and would be left orphaned if only the
+	// direct child was killed
+	exitCode, status, _ := processer.SyncRun("/tmp",
+		"sh", []string{"-c", "sleep 60 & echo started; sleep 60"}, &stdoutWrite, &stderrWrite, nil, nil, 1)
+	assert.Equal(t, Timeout, status)
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, TerminatedBySigterm, processer.TerminationPhase())
+
+	// The whole process group should have gone
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, aliveProcessesInGroup(processer.Pid()))
+}
+
+// aliveProcessesInGroup lists processes in the process group except zombies,
+// which may not be reaped in time by init process of container
+func aliveProcessesInGroup(pgid int) []string {
+	var alive []string
+	statPaths, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, statPath := range statPaths {
+		content, err := ioutil.ReadFile(statPath)
+		if err != nil {
+			continue
+		}
+		// Fields after the command name wrapped by parentheses
+		fields := strings.Fields(string(content[strings.LastIndex(string(content), ")")+1:]))
+		if len(fields) < 3 || fields[0] == "Z" {
+			continue
+		}
+		if fields[2] == strconv.Itoa(pgid) {
+			alive = append(alive, statPath)
+		}
+	}
+	return alive
+}
+
+func TestTerminateLeftoverProcessesAfterExited(t *testing.T) {
+	var stdoutWrite bytes.Buffer
+	var stderrWrite bytes.Buffer
+	processer := ProcessCmd{}
+	processer.SetTerminationGracePeriod(2 * time.Second)
+	forceKilled := false
+	processer.SetForceKillCallback(func() {
+		forceKilled = true
+	})
+
+	// Background sleep is left in the process group after shell exited
+	exitCode, status, _ := processer.SyncRun("/tmp",
+		"sh", []string{"-c", "sleep 60 > /dev/null 2>&1 & exit 0"}, &stdoutWrite, &stderrWrite, nil, nil, 30)
+	assert.Equal(t, Success, status)
+	assert.Equal(t, 0, exitCode)
+	assert.NotEmpty(t, aliveProcessesInGroup(processer.Pid()))
+
+	processer.Cancel()
+	assert.True(t, forceKilled)
+	// Process itself was not terminated
+	assert.Equal(t, NotTerminated, processer.TerminationPhase())
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, aliveProcessesInGroup(processer.Pid()))
+}
+
+func TestKillProcessTreeAfterGracePeriod(t *testing.T) {
+	var stdoutWrite bytes.Buffer
+	var stderrWrite bytes.Buffer
+	processer := ProcessCmd{}
+	processer.SetTerminationGracePeriod(500 * time.Millisecond)
+	forceKilled := false
+	processer.SetForceKillCallback(func() {
+		forceKilled = true
+	})
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		processer.Cancel()
+	}()
+	_, status, _ := processer.SyncRun("/tmp",
+		"sh", []string{"-c", "trap '' TERM; sleep 60"}, &stdoutWrite, &stderrWrite, nil, nil, 30)
+	assert.Equal(t, Success, status)
+	assert.Equal(t, TerminatedBySigkill, processer.TerminationPhase())
+	assert.True(t, forceKilled)
+}
+
+func TestCancelBeforeStart(t *testing.T) {
+	var stdoutWrite bytes.Buffer
+	var stderrWrite bytes.Buffer
+	processer := ProcessCmd{}
+
+	// Cancellation between runs is remembered by following run
+	_, status, _ := processer.SyncRun("/tmp",
+		"echo", []string{"first"}, &stdoutWrite, &stderrWrite, nil, nil, 30)
+	assert.Equal(t, Success, status)
+	processer.Cancel()
+	var secondStdoutWrite bytes.Buffer
+	exitCode, status, err := processer.SyncRun("/tmp",
+		"echo", []string{"second"}, &secondStdoutWrite, &stderrWrite, nil, nil, 30)
+	assert.Equal(t, Fail, status)
+	assert.Equal(t, 1, exitCode)
+	assert.ErrorIs(t, err, ErrCanceledBeforeStart)
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, secondStdoutWrite.String())
+}
+
+func TestPreExecCallback(t *testing.T) {
+	var stdoutWrite bytes.Buffer
+	var stderrWrite bytes.Buffer
+	processer := ProcessCmd{}
+	var cmdlineBeforeExec string
+	processer.SetPreExecCallback(func(pid int) {
+		// Command is not executed yet and has not written anything
+		time.Sleep(100 * time.Millisecond)
+		cmdline, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+		assert.NoError(t, err)
+		cmdlineBeforeExec = string(cmdline)
+	})
+
+	exitCode, status, err := processer.SyncRun("/tmp",
+		"printf", []string{"%s|%s", "a b", "c"}, &stdoutWrite, &stderrWrite, nil, nil, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, Success, status)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "a b|c", stdoutWrite.String())
+	assert.True(t, strings.HasPrefix(cmdlineBeforeExec, "sh\x00-c\x00"), cmdlineBeforeExec)
+
+	_, status, err = processer.SyncRun("/tmp",
+		"command-not-exist", nil, &stdoutWrite, &stderrWrite, nil, nil, 30)
+	assert.Equal(t, Fail, status)
+	assert.Error(t, err)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	var stdoutWrite bytes.Buffer
+	var stderrWrite bytes.Buffer
+	processer := ProcessCmd{}
+	processer.SetTerminationGracePeriod(time.Second)
+	processer.SetIdleTimeout(2 * time.Second)
+
+	// Output keeps the process active until it stops printing
+	startTime := time.Now()
+	exitCode, status, err := processer.SyncRun("/tmp",
+		"sh", []string{"-c", "for i in 1 2 3; do echo $i; sleep 1; done; sleep 60"}, &stdoutWrite, &stderrWrite, nil, nil, 30)
+	assert.Equal(t, IdleTimeout, status)
+	assert.Equal(t, 1, exitCode)
+	assert.Error(t, err)
+	assert.Equal(t, "1\n2\n3\n", stdoutWrite.String())
+	elapsed := time.Since(startTime)
+	assert.True(t, elapsed >= 4*time.Second, elapsed)
+	assert.True(t, elapsed < 20*time.Second, elapsed)
+
+	// Process writing output regularly is not affected
+	stdoutWrite.Reset()
+	exitCode, status, _ = processer.SyncRun("/tmp",
+		"sh", []string{"-c", "for i in 1 2 3 4; do echo $i; sleep 1; done"}, &stdoutWrite, &stderrWrite, nil, nil, 30)
+	assert.Equal(t, Success, status)
+	assert.Equal(t, 0, exitCode)
+}
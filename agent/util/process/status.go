@@ -9,9 +9,24 @@ func StrStatus(status int) string {
 		return "Success"
 	case Timeout:
 		return "Timeout"
+	case IdleTimeout:
+		return "IdleTimeout"
 	case Fail:
 		return "Failed"
 	default:
 		return fmt.Sprintf("InvalidStatusCode: %d", status)
 	}
 }
+
+// StrTerminationPhase function converts integer termination phase into string
+// description, which is empty when not terminated
+func StrTerminationPhase(phase int) string {
+	switch phase {
+	case TerminatedBySigterm:
+		return "sigterm"
+	case TerminatedBySigkill:
+		return "sigkill"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,37 @@
+// +build linux freebsd
+
+package process
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// signalProcessGroup sends signal to the whole process group led by the
+// process, since Setpgid is always set in prepareProcess()
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+func terminateProcessTree(cmd *exec.Cmd) error {
+	return signalProcessGroup(cmd, syscall.SIGTERM)
+}
+
+func killProcessTree(cmd *exec.Cmd) error {
+	return signalProcessGroup(cmd, syscall.SIGKILL)
+}
+
+// waitProcessTreeExited polls until no process is left in the process group
+// or deadline is reached
+func waitProcessTreeExited(cmd *exec.Cmd, deadline time.Time) {
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(-cmd.Process.Pid, 0); err == syscall.ESRCH {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
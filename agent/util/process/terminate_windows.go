@@ -0,0 +1,27 @@
+package process
+
+import (
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// terminateProcessTree is not supported on Windows since there is no signal
+// like SIGTERM for console applications
+func terminateProcessTree(cmd *exec.Cmd) error {
+	return errGracefulTerminationNotSupported
+}
+
+// waitProcessTreeExited returns immediately since graceful termination is not
+// supported on Windows
+func waitProcessTreeExited(cmd *exec.Cmd, deadline time.Time) {
+}
+
+func killProcessTree(cmd *exec.Cmd) error {
+	// taskkill /T terminates the specified process and any child processes
+	// started by it
+	if err := exec.Command("taskkill", "/F", "/T", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
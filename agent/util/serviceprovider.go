@@ -81,6 +81,12 @@ func GetErrorOutputService() string {
 	return url
 }
 
+func GetSpooledOutputService() string {
+	url := "https://" + GetServerHost()
+	url += "/luban/api/v1/task/spooled-output"
+	return url
+}
+
 func GetPingService() string {
 	url := "https://" + GetServerHost()
 	url += "/luban/api/heart-beat"
@@ -0,0 +1,140 @@
+package stringutil
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedMask replaces every occurrence of secrets
+const RedactedMask = "******"
+
+// Redactor masks occurrences of a fixed set of secret values
+type Redactor struct {
+	// Sorted by length in descending order, thus the longest secret matched at
+	// the same position wins
+	secrets    []string
+	firstBytes [256]bool
+	replacer   *strings.Replacer
+}
+
+func NewRedactor(secrets []string) *Redactor {
+	r := &Redactor{}
+	seen := map[string]bool{}
+	for _, secret := range secrets {
+		if secret == "" || seen[secret] {
+			continue
+		}
+		seen[secret] = true
+		r.secrets = append(r.secrets, secret)
+		r.firstBytes[secret[0]] = true
+	}
+	sort.SliceStable(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+
+	oldnew := make([]string, 0, 2*len(r.secrets))
+	for _, secret := range r.secrets {
+		oldnew = append(oldnew, secret, RedactedMask)
+	}
+	r.replacer = strings.NewReplacer(oldnew...)
+	return r
+}
+
+// Empty reports whether there is no secret to be masked
+func (r *Redactor) Empty() bool {
+	return r == nil || len(r.secrets) == 0
+}
+
+// Redact returns s with all secrets masked
+func (r *Redactor) Redact(s string) string {
+	if r.Empty() {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// scan masks secrets in data. Unless final is true, the tail of data which
+// may be the beginning of a secret is held and returned for next scanning.
+func (r *Redactor) scan(data []byte, final bool) (redacted []byte, held []byte) {
+	redacted = make([]byte, 0, len(data))
+	i := 0
+	for i < len(data) {
+		if !r.firstBytes[data[i]] {
+			redacted = append(redacted, data[i])
+			i++
+			continue
+		}
+
+		remaining := data[i:]
+		if !final {
+			for _, secret := range r.secrets {
+				if len(remaining) < len(secret) && secret[:len(remaining)] == string(remaining) {
+					return redacted, remaining
+				}
+			}
+		}
+		matched := false
+		for _, secret := range r.secrets {
+			if len(remaining) >= len(secret) && string(remaining[:len(secret)]) == secret {
+				redacted = append(redacted, RedactedMask...)
+				i += len(secret)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			redacted = append(redacted, data[i])
+			i++
+		}
+	}
+	return redacted, nil
+}
+
+// RedactingWriter masks secrets in stream written to underlying writer, even
+// if a secret is split across writes. Flush MUST be called at the end of the
+// stream to write held data. Write and Flush are safe to be called
+// concurrently, e.g., Flush after process exited while output is still copied.
+type RedactingWriter struct {
+	redactor *Redactor
+	writer   io.Writer
+	held     []byte
+	mutex    sync.Mutex
+}
+
+func (r *Redactor) NewWriter(w io.Writer) *RedactingWriter {
+	return &RedactingWriter{
+		redactor: r,
+		writer:   w,
+	}
+}
+
+// Write always reports len(p) bytes written as long as underlying writer
+// succeeds, since the length of masked data differs from the original one
+func (w *RedactingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	data := append(w.held, p...)
+	redacted, held := w.redactor.scan(data, false)
+	w.held = append([]byte(nil), held...)
+	if len(redacted) > 0 {
+		if _, err := w.writer.Write(redacted); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes held data with secrets masked to underlying writer
+func (w *RedactingWriter) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.held) == 0 {
+		return nil
+	}
+	redacted, _ := w.redactor.scan(w.held, true)
+	w.held = nil
+	_, err := w.writer.Write(redacted)
+	return err
+}
@@ -0,0 +1,69 @@
+package stringutil
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	r := NewRedactor([]string{"abc", "", "abcdef", "abc"})
+	assert.Equal(t, "x******y******z", r.Redact("xabcdefyabcz"))
+	assert.Equal(t, "nothing", r.Redact("nothing"))
+
+	var empty *Redactor
+	assert.True(t, empty.Empty())
+	assert.Equal(t, "abc", empty.Redact("abc"))
+	assert.True(t, NewRedactor(nil).Empty())
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var output bytes.Buffer
+	w := NewRedactor([]string{"p@ssw0rd", "token"}).NewWriter(&output)
+
+	// Secret split across writes
+	w.Write([]byte("password=p@ss"))
+	assert.Equal(t, "password=", output.String())
+	w.Write([]byte("w0rd\ntok"))
+	assert.Equal(t, "password=******\n", output.String())
+	w.Write([]byte("ens"))
+	assert.Equal(t, "password=******\n******s", output.String())
+
+	// Held data is written at the end of stream
+	w.Write([]byte(" p@s"))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "password=******\n******s p@s", output.String())
+}
+
+func TestRedactingWriterLongestSecret(t *testing.T) {
+	var output bytes.Buffer
+	w := NewRedactor([]string{"abc", "abcdef"}).NewWriter(&output)
+	w.Write([]byte("abc"))
+	w.Write([]byte("def abc"))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "****** ******", output.String())
+}
+
+func TestRedactingWriterConcurrentFlush(t *testing.T) {
+	var output bytes.Buffer
+	w := NewRedactor([]string{"p@ssw0rd"}).NewWriter(&output)
+
+	// Output may still be copied when Flush is called after process exited
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			w.Write([]byte("line p@ssw0rd\n"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, w.Flush())
+	}
+	wg.Wait()
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, 1000, strings.Count(output.String(), "line ******\n"))
+}
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"io"
@@ -116,6 +117,19 @@ func ComputeMd5(filePath string) (string, error) {
 	return hex.EncodeToString(hash.Sum(result)), nil
 }
 
+func ComputeSha256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func ComputeStrMd5(str string) string {
 	h := md5.New()
 	h.Write([]byte(str))
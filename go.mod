@@ -44,4 +44,5 @@ require (
 	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e
 	golang.org/x/text v0.3.7
 	gopkg.in/ini.v1 v1.66.2
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/aliyun/aliyun_assist_client/agent/taskengine"
+)
+
+const historySubcommand = "history"
+
+// parseHistoryTime accepts either RFC3339 time or duration before now, e.g.,
+// 24h
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// runHistoryCommand implements `aliyun-service history [list|show <taskId>]`,
+// which reads local invocation history without connecting to server, and
+// returns exit code of process
+func runHistoryCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	action := "list"
+	if len(args) > 0 && (args[0] == "list" || args[0] == "show") {
+		action = args[0]
+		args = args[1:]
+	}
+
+	flagSet := pflag.NewFlagSet(historySubcommand, pflag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	since := flagSet.String("since", "", "only invocations ended after the time, in RFC3339 format or duration before now like 24h")
+	until := flagSet.String("until", "", "only invocations ended before the time, in RFC3339 format or duration before now like 1h")
+	status := flagSet.String("status", "", "only invocations of the status: finished, failed, timeout, idleTimeout, stopped or invalid")
+	commandId := flagSet.String("command-id", "", "only invocations of the command")
+	taskId := flagSet.String("task-id", "", "only invocations of the task")
+	limit := flagSet.IntP("limit", "n", 20, "maximum number of invocations listed, 0 means unlimited")
+	asJSON := flagSet.Bool("json", false, "print in JSON format")
+	flagSet.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s history [list] [options]\n", os.Args[0])
+		fmt.Fprintf(stderr, "       %s history show <taskId> [--json]\n", os.Args[0])
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Options:")
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if action == "show" {
+		if flagSet.NArg() != 1 {
+			flagSet.Usage()
+			return 2
+		}
+		record, err := taskengine.GetHistory(flagSet.Arg(0))
+		if err != nil {
+			fmt.Fprintln(stderr, "Failed to read invocation history:", err)
+			return 1
+		}
+		if *asJSON {
+			return printHistoryJSON(record, stdout, stderr)
+		}
+		fmt.Fprint(stdout, record.Detail())
+		if spoolPath, err := taskengine.SpooledOutputPath(record.TaskId); err == nil {
+			if _, err := os.Stat(spoolPath); err == nil {
+				fmt.Fprintf(stdout, "Full output of the latest invocation: %s --task-output %s\n", os.Args[0], record.TaskId)
+			}
+		}
+		return 0
+	}
+
+	if flagSet.NArg() != 0 {
+		flagSet.Usage()
+		return 2
+	}
+	now := time.Now()
+	filter := taskengine.HistoryFilter{
+		Status:    *status,
+		CommandId: *commandId,
+		TaskId:    *taskId,
+		Limit:     *limit,
+	}
+	var err error
+	if filter.Since, err = parseHistoryTime(*since, now); err != nil {
+		fmt.Fprintln(stderr, "Invalid --since:", err)
+		return 2
+	}
+	if filter.Until, err = parseHistoryTime(*until, now); err != nil {
+		fmt.Fprintln(stderr, "Invalid --until:", err)
+		return 2
+	}
+	records, err := taskengine.ListHistory(filter)
+	if err != nil {
+		fmt.Fprintln(stderr, "Failed to read invocation history:", err)
+		return 1
+	}
+	if *asJSON {
+		return printHistoryJSON(records, stdout, stderr)
+	}
+	fmt.Fprintf(stdout, "%-19s  %-9s %5s  %-24s %-24s %s\n", "END TIME", "STATUS", "EXIT", "TASK ID", "COMMAND ID", "USER")
+	for i := range records {
+		fmt.Fprintln(stdout, records[i].Brief())
+	}
+	return 0
+}
+
+func printHistoryJSON(v interface{}, stdout io.Writer, stderr io.Writer) int {
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintln(stderr, "Failed to encode invocation history:", err)
+		return 1
+	}
+	return 0
+}
@@ -162,6 +162,10 @@ func (p *program) run() {
 		log.GetLogger().Infoln("Start StartKdumpCheckTimer")
 	}
 
+	// Deliver results of invocations left by previous agent process before
+	// any task could be fetched, even via kick from server
+	taskengine.ReplayTaskJournal()
+
 	// Finally, fetching tasks could be allowed and agent starts to run normally.
 	taskengine.EnableFetchingTask()
 	log.GetLogger().Infoln("Started successfully")
@@ -191,6 +195,12 @@ func (p *program) run() {
 		}
 
 		taskengine.Fetch(false, "", taskengine.NormalTaskType, isColdstart)
+
+		// Saved scripts are collected after periodic tasks are registered,
+		// thus their scripts are protected from the first collection
+		if err := taskengine.InitScriptGCTimer(); err != nil {
+			log.GetLogger().WithError(err).Errorln("Failed to initialize script garbage collection timer")
+		}
 	})
 
 	time.Sleep(time.Duration(3*60) * time.Second)
@@ -229,6 +239,7 @@ type Options struct {
 	RunAsDaemon    bool
 	LogPath        string
 	IsVerbose      bool
+	TaskOutput     string
 }
 
 func parseOptions() Options {
@@ -255,8 +266,11 @@ func parseOptions() Options {
 	pflag.BoolVarP(&options.RunAsCommon, "common", "c", false, "run as common")
 	pflag.BoolVarP(&options.RunAsDaemon, "daemon", "d", false, "start as daemon")
 
+	pflag.StringVar(&options.TaskOutput, "task-output", "", "print full spooled output of specified task")
+
 	pflag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s history [list|show <taskId>] [options]\n", os.Args[0])
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Aliyun Assist Copyright (c) 2017-2020 Alibaba Group Holding Limited")
 		fmt.Fprintln(os.Stderr)
@@ -269,6 +283,11 @@ func parseOptions() Options {
 }
 
 func main() {
+	// Subcommands are dispatched before options of service are parsed
+	if len(os.Args) > 1 && os.Args[1] == historySubcommand {
+		os.Exit(runHistoryCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	options := parseOptions()
 	log.InitLog("aliyun_assist_main.log", options.LogPath)
 	if options.LogPath != "" {
@@ -300,6 +319,13 @@ func main() {
 		fmt.Println(version.GitCommitHash)
 		return
 	}
+	if options.TaskOutput != "" {
+		if err := taskengine.PrintSpooledOutput(options.TaskOutput, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to print spooled output of task:", err)
+			os.Exit(1)
+		}
+		return
+	}
 	if options.Register {
 		hybrid.Register(options.Region, options.ActivationCode, options.ActivationId, options.InstanceName, options.NetWorkMode, true)
 		return